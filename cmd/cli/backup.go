@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type backupOptions struct {
+	out     string
+	anonOut string
+}
+
+func newBackupCmd(root *rootOptions) *cobra.Command {
+	opts := &backupOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Copy both databases, safe while collect is running",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			anonOut := opts.anonOut
+			if anonOut == "" {
+				anonOut = anonBackupPath(opts.out)
+			}
+
+			if err := backupDB(cmd, root.dbPath, opts.out); err != nil {
+				return err
+			}
+			return backupDB(cmd, root.anonDBPath, anonOut)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.out, "out", "devstats.db.bak", "file to write the raw database backup to")
+	cmd.Flags().StringVar(&opts.anonOut, "anon-out", "", "file to write the anonymized database backup to (default: --out with an _anon suffix)")
+
+	return cmd
+}
+
+// backupDB writes a consistent copy of the database at dbPath to out
+func backupDB(cmd *cobra.Command, dbPath, out string) error {
+	if err := storage.Backup(dbPath, out); err != nil {
+		return err
+	}
+
+	size, err := fileSize(out)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "%s -> %s (%d bytes)\n", dbPath, out, size)
+	return nil
+}
+
+// anonBackupPath derives the anonymized backup's name from the raw one,
+// e.g. devstats-2024.db.bak becomes devstats-2024_anon.db.bak
+func anonBackupPath(out string) string {
+	dir, base := filepath.Split(out)
+	name, ext, found := strings.Cut(base, ".")
+	if !found {
+		return out + "_anon"
+	}
+	return filepath.Join(dir, name+"_anon."+ext)
+}
@@ -0,0 +1,778 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/anon"
+	"github.com/nilszeilon/devstats/internal/collector"
+	"github.com/nilszeilon/devstats/internal/control"
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/metrics"
+	"github.com/nilszeilon/devstats/internal/retention"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/nilszeilon/devstats/internal/version"
+	"github.com/spf13/cobra"
+)
+
+type collectOptions struct {
+	paths       []string
+	perKey      bool
+	metricsAddr string
+	dryRun      bool
+}
+
+func newCollectCmd(root *rootOptions) *cobra.Command {
+	opts := &collectOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "collect",
+		Short: "Run the collectors and anonymizers until interrupted",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCollect(root, opts)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&opts.paths, "paths", nil, "directories to watch for file changes (default: paths from the config file, or the home directory)")
+	cmd.Flags().BoolVar(&opts.perKey, "per-key", false, "anonymize keypresses into per-key counts instead of a single total")
+	cmd.Flags().StringVar(&opts.metricsAddr, "metrics-addr", "", "serve Prometheus metrics on this address, e.g. 127.0.0.1:9090 (disabled if empty)")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "log keypresses and file changes instead of saving them, no database is opened")
+
+	return cmd
+}
+
+func runCollect(root *rootOptions, opts *collectOptions) error {
+	log.Println("Starting devstats...")
+	startedAt := time.Now()
+
+	// Watch the configured paths and projects unless paths were given
+	paths := opts.paths
+	var projects []collector.Root
+	if len(paths) == 0 {
+		paths = root.config.Paths
+		for _, project := range root.config.Projects {
+			projects = append(projects, collector.Root{
+				Path:          project.Path,
+				Name:          project.Name,
+				BlacklistDirs: project.BlacklistDirs,
+			})
+		}
+	}
+	if opts.dryRun {
+		return runDryRun(root, paths, projects)
+	}
+
+	loc, err := root.config.Location()
+	if err != nil {
+		return err
+	}
+
+	// Create absolute paths for all files
+	dbPath, err := filepath.Abs(root.dbPath)
+	if err != nil {
+		return err
+	}
+	log.Printf("Using database at: %s", dbPath)
+
+	// Setup anonymizer stores
+	anonDBPath, err := filepath.Abs(root.anonDBPath)
+	if err != nil {
+		return err
+	}
+
+	// init sqlite storage
+	keypressStore, err := storage.NewSQLiteStore[domain.KeypressData](dbPath)
+	if err != nil {
+		return err
+	}
+	defer keypressStore.Close()
+
+	keypressAnonStore, err := storage.NewSQLiteStore[domain.KeypressAnonymousStats](anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer keypressAnonStore.Close()
+
+	// Key pairs are only recorded when enabled in the config
+	keypressOpts := []collector.KeypressOption{collector.WithKeyboardLayout(collector.KeyboardLayout(root.config.KeyboardLayout))}
+	var keySequenceStore *storage.SQLiteStore[domain.KeySequenceData]
+	if root.config.KeySequences {
+		keySequenceStore, err = storage.NewSQLiteStore[domain.KeySequenceData](dbPath)
+		if err != nil {
+			return err
+		}
+		defer keySequenceStore.Close()
+
+		keypressOpts = append(keypressOpts, collector.WithKeySequences(keySequenceStore, root.config.KeySequenceWindow.Duration))
+	}
+
+	// So are chords
+	var keyChordStore *storage.SQLiteStore[domain.KeyChordData]
+	if root.config.KeyChords {
+		keyChordStore, err = storage.NewSQLiteStore[domain.KeyChordData](dbPath)
+		if err != nil {
+			return err
+		}
+		defer keyChordStore.Close()
+
+		keypressOpts = append(keypressOpts, collector.WithKeyChords(keyChordStore, root.config.KeyChordLeaders, root.config.KeyChordTimeout.Duration))
+	}
+
+	// Count-only mode saves the keypress stats directly, the raw keypresses
+	// never reach the database
+	if root.config.KeypressCountOnly {
+		if opts.perKey {
+			return errors.New("--per-key needs the keys, it can't be combined with keypress_count_only")
+		}
+		keypressOpts = append(keypressOpts, collector.WithCountOnly(keypressAnonStore, root.config.IntervalFor("keypresses"), loc))
+		log.Println("Only counting keypresses, keys are not saved")
+	}
+
+	if root.config.KeypressSampleRate < 1 {
+		keypressOpts = append(keypressOpts, collector.WithSampleRate(root.config.KeypressSampleRate))
+		log.Printf("Saving %.0f%% of keypresses, the stats are estimated from them", root.config.KeypressSampleRate*100)
+	}
+
+	// Create keypress collector
+	keypressCollector := collector.NewKeypressCollector(keypressStore, keypressOpts...)
+
+	// Start collecting
+	if err := keypressCollector.Start(); err != nil {
+		return fmt.Errorf("failed to start keypress collector: %w", err)
+	}
+
+	// init sqlite storage
+	fileChangeStore, err := storage.NewSQLiteStore[domain.FileChangeData](dbPath)
+	if err != nil {
+		return err
+	}
+	defer fileChangeStore.Close()
+
+	fileCollector, err := collector.NewFileChangeCollector(fileChangeStore, paths, fileChangeOptions(root, projects)...)
+	if err != nil {
+		return err
+	}
+
+	// Start collecting
+	if err := fileCollector.Start(); err != nil {
+		return err
+	}
+
+	// init sqlite storage
+	mouseClickStore, err := storage.NewSQLiteStore[domain.MouseClickData](dbPath)
+	if err != nil {
+		return err
+	}
+	defer mouseClickStore.Close()
+
+	mouseCollector := collector.NewMouseClickCollector(mouseClickStore)
+
+	// Start collecting
+	if err := mouseCollector.Start(); err != nil {
+		return fmt.Errorf("failed to start mouse click collector: %w", err)
+	}
+
+	// init sqlite storage
+	appFocusStore, err := storage.NewSQLiteStore[domain.AppFocusData](dbPath)
+	if err != nil {
+		return err
+	}
+	defer appFocusStore.Close()
+
+	appFocusCollector := collector.NewAppFocusCollector(appFocusStore)
+
+	// Start collecting
+	if err := appFocusCollector.Start(); err != nil {
+		return fmt.Errorf("failed to start app focus collector: %w", err)
+	}
+
+	// init sqlite storage
+	commitStore, err := storage.NewSQLiteStore[domain.CommitData](dbPath)
+	if err != nil {
+		return err
+	}
+	defer commitStore.Close()
+
+	// Commits are found in the repositories of every watched tree
+	commitPaths := append([]string(nil), paths...)
+	for _, project := range projects {
+		commitPaths = append(commitPaths, project.Path)
+	}
+
+	commitCollector, err := collector.NewGitCommitCollector(commitStore, commitPaths)
+	if err != nil {
+		return err
+	}
+
+	// Start collecting
+	if err := commitCollector.Start(); err != nil {
+		return fmt.Errorf("failed to start git commit collector: %w", err)
+	}
+
+	// init sqlite storage
+	commandStore, err := storage.NewSQLiteStore[domain.CommandData](dbPath)
+	if err != nil {
+		return err
+	}
+	defer commandStore.Close()
+
+	// Not every shell keeps a history file, so the other collectors run without it
+	commandCollector, err := collector.NewShellHistoryCollector(commandStore, "")
+	if err == nil {
+		err = commandCollector.Start()
+	}
+	if err != nil {
+		log.Printf("Shell history collector disabled: %v", err)
+		commandCollector = nil
+	}
+
+	log.Println("Keypress collector started. Press Ctrl+C to stop.")
+
+	if opts.metricsAddr != "" {
+		metricsServer := newMetricsServer(opts.metricsAddr)
+		defer metricsServer.Close()
+	}
+
+	// Create stores for anonymous data
+	fileChangeAnonStore, err := storage.NewSQLiteStore[domain.FileChangeAnonymousStats](anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer fileChangeAnonStore.Close()
+
+	mouseClickAnonStore, err := storage.NewSQLiteStore[domain.MouseClickAnonymousStats](anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer mouseClickAnonStore.Close()
+
+	appFocusAnonStore, err := storage.NewSQLiteStore[domain.AppFocusAnonymousStats](anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer appFocusAnonStore.Close()
+
+	commitAnonStore, err := storage.NewSQLiteStore[domain.CommitAnonymousStats](anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer commitAnonStore.Close()
+
+	commandAnonStore, err := storage.NewSQLiteStore[domain.CommandAnonymousStats](anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer commandAnonStore.Close()
+
+	// Create anonymizer services. Keypresses are the busiest source, so they
+	// are streamed instead of loaded per interval.
+	var keypressAnonymizer interface {
+		ProcessIntervalStreaming(start, end time.Time) error
+		Resume() (time.Time, error)
+	}
+	if opts.perKey {
+		// Reads the same raw keypresses, aggregated per key
+		keypressPerKeyStore, err := storage.NewSQLiteStore[domain.KeypressPerKeyData](dbPath)
+		if err != nil {
+			return err
+		}
+		defer keypressPerKeyStore.Close()
+
+		keypressKeyAnonStore, err := storage.NewSQLiteStore[domain.KeypressKeyStats](anonDBPath)
+		if err != nil {
+			return err
+		}
+		defer keypressKeyAnonStore.Close()
+
+		keypressAnonymizer, err = anon.NewService[domain.KeypressPerKeyData, domain.KeypressKeyStats](
+			keypressPerKeyStore,
+			keypressKeyAnonStore,
+			anon.Config{
+				IntervalSize: root.config.IntervalFor("keypresses"),
+				Location:     loc,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	} else {
+		keypressAnonymizer, err = anon.NewService[domain.KeypressData, domain.KeypressAnonymousStats](
+			keypressStore,
+			keypressAnonStore,
+			anon.Config{
+				IntervalSize: root.config.IntervalFor("keypresses"),
+				Location:     loc,
+				ExportDir:    root.config.AnonExportDir,
+				ExportName:   "keypresses",
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	fileChangeAnonymizer, err := anon.NewService[domain.FileChangeData, domain.FileChangeAnonymousStats](
+		fileChangeStore,
+		fileChangeAnonStore,
+		anon.Config{
+			IntervalSize: root.config.IntervalFor("file_changes"),
+			Location:     loc,
+			ExportDir:    root.config.AnonExportDir,
+			ExportName:   "file_changes",
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	mouseClickAnonymizer, err := anon.NewService[domain.MouseClickData, domain.MouseClickAnonymousStats](
+		mouseClickStore,
+		mouseClickAnonStore,
+		anon.Config{
+			IntervalSize: root.config.IntervalFor("mouse_clicks"),
+			Location:     loc,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	appFocusAnonymizer, err := anon.NewService[domain.AppFocusData, domain.AppFocusAnonymousStats](
+		appFocusStore,
+		appFocusAnonStore,
+		anon.Config{
+			IntervalSize: root.config.IntervalFor("app_focus"),
+			Location:     loc,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	commitAnonymizer, err := anon.NewService[domain.CommitData, domain.CommitAnonymousStats](
+		commitStore,
+		commitAnonStore,
+		anon.Config{
+			IntervalSize: root.config.IntervalFor("commits"),
+			Location:     loc,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	commandAnonymizer, err := anon.NewService[domain.CommandData, domain.CommandAnonymousStats](
+		commandStore,
+		commandAnonStore,
+		anon.Config{
+			IntervalSize: root.config.IntervalFor("commands"),
+			Location:     loc,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Send the weekly summary if a webhook or mail server is configured
+	if root.config.Notify.Enabled() {
+		notifier, err := newNotifier(root.config, keypressAnonStore, fileChangeAnonStore)
+		if err != nil {
+			return err
+		}
+		notifier.Start()
+		defer notifier.Stop()
+	}
+
+	// Group raw keypresses into coding sessions
+	sessionStore, err := storage.NewSQLiteStore[domain.SessionData](anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer sessionStore.Close()
+
+	sessionService := anon.NewSessionService(
+		keypressStore,
+		sessionStore,
+		anon.SessionConfig{
+			IdleGap: root.config.SessionIdleGap.Duration,
+		},
+	)
+
+	// Delete raw data past its retention, the anonymous stats are kept
+	retentionTargets := []retention.Target{
+		{Name: "keypress", Store: keypressStore},
+		{Name: "file change", Store: fileChangeStore},
+		{Name: "mouse click", Store: mouseClickStore},
+		{Name: "app focus", Store: appFocusStore},
+		{Name: "commit", Store: commitStore},
+		{Name: "command", Store: commandStore},
+	}
+	if keySequenceStore != nil {
+		retentionTargets = append(retentionTargets, retention.Target{Name: "key sequence", Store: keySequenceStore})
+	}
+	if keyChordStore != nil {
+		retentionTargets = append(retentionTargets, retention.Target{Name: "key chord", Store: keyChordStore})
+	}
+	rawRetention := retention.NewPolicy(root.config.RawRetention.Duration, retentionTargets...)
+
+	// Create daily rollups of the anonymous stats
+	keypressDailyStore, err := storage.NewSQLiteStore[domain.KeypressDailyStats](anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer keypressDailyStore.Close()
+
+	fileChangeDailyStore, err := storage.NewSQLiteStore[domain.FileChangeDailyStats](anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer fileChangeDailyStore.Close()
+
+	keypressRollup := anon.NewRollupService[domain.KeypressAnonymousStats, domain.KeypressDailyStats](
+		keypressAnonStore,
+		keypressDailyStore,
+		anon.RollupConfig{Location: loc},
+	)
+	fileChangeRollup := anon.NewRollupService[domain.FileChangeAnonymousStats, domain.FileChangeDailyStats](
+		fileChangeAnonStore,
+		fileChangeDailyStore,
+		anon.RollupConfig{Location: loc},
+	)
+
+	// Each data type is anonymized on its own cadence
+	jobs := []anon.Job{
+		{
+			Name:     "keypress",
+			Interval: root.config.IntervalFor("keypresses"),
+			Process:  keypressAnonymizer.ProcessIntervalStreaming,
+			Resume:   keypressAnonymizer.Resume,
+		},
+		{
+			Name:     "file change",
+			Interval: root.config.IntervalFor("file_changes"),
+			Process:  fileChangeAnonymizer.ProcessInterval,
+			Resume:   fileChangeAnonymizer.Resume,
+		},
+		{
+			Name:     "mouse click",
+			Interval: root.config.IntervalFor("mouse_clicks"),
+			Process:  mouseClickAnonymizer.ProcessInterval,
+			Resume:   mouseClickAnonymizer.Resume,
+		},
+		{
+			Name:     "app focus",
+			Interval: root.config.IntervalFor("app_focus"),
+			Process:  appFocusAnonymizer.ProcessInterval,
+			Resume:   appFocusAnonymizer.Resume,
+		},
+		{
+			Name:     "commit",
+			Interval: root.config.IntervalFor("commits"),
+			Process:  commitAnonymizer.ProcessInterval,
+			Resume:   commitAnonymizer.Resume,
+		},
+		{
+			Name:     "command",
+			Interval: root.config.IntervalFor("commands"),
+			Process:  commandAnonymizer.ProcessInterval,
+			Resume:   commandAnonymizer.Resume,
+		},
+		{
+			Name:     "session",
+			Interval: root.config.IntervalFor("sessions"),
+			Process:  sessionService.ProcessInterval,
+			Resume:   sessionService.Resume,
+		},
+	}
+
+	if keySequenceStore != nil {
+		keySequenceAnonStore, err := storage.NewSQLiteStore[domain.KeySequenceStats](anonDBPath)
+		if err != nil {
+			return err
+		}
+		defer keySequenceAnonStore.Close()
+
+		keySequenceAnonymizer, err := anon.NewService[domain.KeySequenceData, domain.KeySequenceStats](
+			keySequenceStore,
+			keySequenceAnonStore,
+			anon.Config{
+				IntervalSize: root.config.IntervalFor("key_sequences"),
+				Location:     loc,
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		jobs = append(jobs, anon.Job{
+			Name:     "key sequence",
+			Interval: root.config.IntervalFor("key_sequences"),
+			Process:  keySequenceAnonymizer.ProcessInterval,
+			Resume:   keySequenceAnonymizer.Resume,
+		})
+	}
+
+	if keyChordStore != nil {
+		keyChordAnonStore, err := storage.NewSQLiteStore[domain.KeyChordStats](anonDBPath)
+		if err != nil {
+			return err
+		}
+		defer keyChordAnonStore.Close()
+
+		keyChordAnonymizer, err := anon.NewService[domain.KeyChordData, domain.KeyChordStats](
+			keyChordStore,
+			keyChordAnonStore,
+			anon.Config{
+				IntervalSize: root.config.IntervalFor("key_chords"),
+				Location:     loc,
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		jobs = append(jobs, anon.Job{
+			Name:     "key chord",
+			Interval: root.config.IntervalFor("key_chords"),
+			Process:  keyChordAnonymizer.ProcessInterval,
+			Resume:   keyChordAnonymizer.Resume,
+		})
+	}
+
+	// Without raw keypresses there is nothing to anonymize or group into sessions
+	if root.config.KeypressCountOnly {
+		jobs = slices.DeleteFunc(jobs, func(job anon.Job) bool {
+			return job.Name == "keypress" || job.Name == "session"
+		})
+	}
+
+	scheduler := anon.NewScheduler(jobs...)
+
+	// Keep today's summary current and finish yesterday's after midnight
+	rollup := func(t time.Time) {
+		for _, day := range []time.Time{t.AddDate(0, 0, -1), t} {
+			if err := keypressRollup.ProcessDay(day); err != nil {
+				log.Printf("Error rolling up keypress stats: %v", err)
+			}
+			if err := fileChangeRollup.ProcessDay(day); err != nil {
+				log.Printf("Error rolling up file change stats: %v", err)
+			}
+		}
+	}
+
+	// Run first anonymization immediately
+	scheduler.Start(time.Now())
+
+	// Wakes the loop below when the next job is due
+	timer := time.NewTimer(time.Until(scheduler.Next()))
+	defer timer.Stop()
+
+	// Flushes requested over the control socket run in the loop below, so
+	// they never overlap with a scheduled run
+	flushRequests := make(chan chan struct{})
+	shutdown := make(chan struct{})
+
+	var controlServer *control.Server
+	if root.config.ControlSocket != "" {
+		controlServer, err = control.Listen(root.config.ControlSocket, control.Handlers{
+			Status: func() control.Status {
+				watch := fileCollector.WatchStats()
+				events, err := metrics.Totals()
+				if err != nil {
+					log.Printf("Error reading event counts: %v", err)
+				}
+				return control.Status{
+					StartedAt:               startedAt,
+					Paused:                  keypressCollector.Paused(),
+					KeypressHookHealthy:     keypressCollector.Healthy(),
+					WatchedDirs:             watch.Watched,
+					WatchLimitReached:       watch.LimitReached,
+					SkippedDirs:             watch.Skipped,
+					WatchSystemLimitReached: watch.SystemLimitReached,
+					Version:                 version.Get(),
+					Events:                  events,
+				}
+			},
+			Pause: func() {
+				keypressCollector.Pause()
+				fileCollector.Pause()
+			},
+			Resume: func() {
+				keypressCollector.Resume()
+				fileCollector.Resume()
+			},
+			Flush: func() error {
+				done := make(chan struct{})
+				select {
+				case flushRequests <- done:
+				case <-shutdown:
+					return errors.New("devstats is shutting down")
+				}
+				<-done
+				return nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Listening for commands on %s", root.config.ControlSocket)
+	}
+
+	// Setup signal handling
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	// Anonymize whenever a job is due until interrupted
+	for done := false; !done; {
+		select {
+		case <-sigChan:
+			done = true
+		case flushed := <-flushRequests:
+			now := time.Now()
+			scheduler.RunAll(now)
+			rollup(now)
+			timer.Reset(time.Until(scheduler.Next()))
+			close(flushed)
+		case <-timer.C:
+			now := time.Now()
+			if scheduler.RunDue(now) {
+				rollup(now)
+
+				if err := rawRetention.Prune(now); err != nil {
+					log.Printf("Error pruning raw data: %v", err)
+				}
+			}
+			timer.Reset(time.Until(scheduler.Next()))
+		}
+	}
+
+	log.Println("Shutting down gracefully...")
+
+	close(shutdown)
+	if controlServer != nil {
+		controlServer.Close()
+	}
+
+	// Stop the collectors first so buffered data is saved before the final pass
+	keypressCollector.Stop()
+	fileCollector.Stop()
+	mouseCollector.Stop()
+	appFocusCollector.Stop()
+	commitCollector.Stop()
+	if commandCollector != nil {
+		commandCollector.Stop()
+	}
+
+	// Anonymize the partial intervals since each job last ran
+	now := time.Now()
+	scheduler.RunAll(now)
+	rollup(now)
+
+	// A checkpoint covers a whole database, so one store of each will do
+	if err := keypressStore.Flush(); err != nil {
+		log.Printf("Error flushing the raw database: %v", err)
+	}
+	if err := keypressAnonStore.Flush(); err != nil {
+		log.Printf("Error flushing the anonymized database: %v", err)
+	}
+
+	// The stores are closed by the deferred calls above
+	log.Println("Shutdown complete")
+	return nil
+}
+
+// newMetricsServer serves the Prometheus metrics of the running collectors in the background
+func newMetricsServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		log.Printf("Serving metrics on http://%s/metrics", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Error serving metrics: %v", err)
+		}
+	}()
+
+	return srv
+}
+
+// fileChangeOptions configures the file change collector from the config
+func fileChangeOptions(root *rootOptions, projects []collector.Root) []collector.FileChangeOption {
+	return []collector.FileChangeOption{
+		collector.WithConfig(collector.FileChangeConfig{
+			BlacklistDirs:      root.config.BlacklistDirs,
+			ExtensionLanguages: root.config.ExtensionLanguages,
+			FilenameLanguages:  root.config.FilenameLanguages,
+		}),
+		collector.WithRoots(projects...),
+		collector.WithFollowSymlinks(root.config.FollowSymlinks),
+		collector.WithMaxWatchedDirs(root.config.MaxWatchedDirs),
+		collector.WithDedupeWindow(root.config.DedupeWindow.Duration),
+		collector.WithRateLimit(root.config.FileChangeRateLimit),
+	}
+}
+
+// runDryRun runs the keypress and file change collectors with logging in
+// place of saving, to check what would be recorded. The stores are only
+// there to satisfy the collectors and never written to.
+func runDryRun(root *rootOptions, paths []string, projects []collector.Root) error {
+	log.Println("Dry run, nothing is saved")
+
+	keypressOpts := []collector.KeypressOption{
+		collector.WithKeypressDryRun(true),
+		collector.WithKeyboardLayout(collector.KeyboardLayout(root.config.KeyboardLayout)),
+	}
+	if root.config.KeySequences {
+		keypressOpts = append(keypressOpts, collector.WithKeySequences(storage.NewMemStore[domain.KeySequenceData](), root.config.KeySequenceWindow.Duration))
+	}
+	if root.config.KeyChords {
+		keypressOpts = append(keypressOpts, collector.WithKeyChords(storage.NewMemStore[domain.KeyChordData](), root.config.KeyChordLeaders, root.config.KeyChordTimeout.Duration))
+	}
+	if root.config.KeypressCountOnly {
+		loc, err := root.config.Location()
+		if err != nil {
+			return err
+		}
+		keypressOpts = append(keypressOpts, collector.WithCountOnly(storage.NewMemStore[domain.KeypressAnonymousStats](), root.config.IntervalFor("keypresses"), loc))
+	}
+	if root.config.KeypressSampleRate < 1 {
+		keypressOpts = append(keypressOpts, collector.WithSampleRate(root.config.KeypressSampleRate))
+	}
+	keypressCollector := collector.NewKeypressCollector(storage.NewMemStore[domain.KeypressData](), keypressOpts...)
+	if err := keypressCollector.Start(); err != nil {
+		return fmt.Errorf("failed to start keypress collector: %w", err)
+	}
+	defer keypressCollector.Stop()
+
+	fileOpts := append(fileChangeOptions(root, projects), collector.WithDryRun(true))
+	fileCollector, err := collector.NewFileChangeCollector(storage.NewMemStore[domain.FileChangeData](), paths, fileOpts...)
+	if err != nil {
+		return err
+	}
+	if err := fileCollector.Start(); err != nil {
+		return err
+	}
+	defer fileCollector.Stop()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	<-sigChan
+	log.Println("Shutting down...")
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/control"
+	"github.com/spf13/cobra"
+)
+
+func newStatusCmd(root *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show what the running collect daemon is doing",
+		// Only the daemon's control socket is used
+		Annotations: map[string]string{annotationNoDatabase: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := sendControl(root, control.CommandStatus)
+			if err != nil {
+				return err
+			}
+			if resp.Status == nil {
+				return errors.New("daemon returned no status")
+			}
+			printStatus(cmd, *resp.Status)
+			return nil
+		},
+	}
+}
+
+// newControlCmd returns a command that only sends command to the daemon
+func newControlCmd(root *rootOptions, command, short, done string) *cobra.Command {
+	return &cobra.Command{
+		Use:         command,
+		Short:       short,
+		Annotations: map[string]string{annotationNoDatabase: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := sendControl(root, command); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), done)
+			return nil
+		},
+	}
+}
+
+func newPauseCmd(root *rootOptions) *cobra.Command {
+	return newControlCmd(root, control.CommandPause, "Stop recording keypresses and file changes until resume", "Collectors paused")
+}
+
+func newResumeCmd(root *rootOptions) *cobra.Command {
+	return newControlCmd(root, control.CommandResume, "Record keypresses and file changes again after pause", "Collectors resumed")
+}
+
+func newFlushCmd(root *rootOptions) *cobra.Command {
+	return newControlCmd(root, control.CommandFlush, "Anonymize everything recorded so far without waiting for the interval", "Anonymization done")
+}
+
+// sendControl sends command to the daemon's control socket
+func sendControl(root *rootOptions, command string) (control.Response, error) {
+	if root.config.ControlSocket == "" {
+		return control.Response{}, errors.New("control_socket is disabled in the config")
+	}
+	return control.Send(root.config.ControlSocket, command)
+}
+
+func printStatus(cmd *cobra.Command, status control.Status) {
+	out := cmd.OutOrStdout()
+
+	state := "collecting"
+	if status.Paused {
+		state = "paused"
+	}
+	hook := "ok"
+	if !status.KeypressHookHealthy {
+		hook = "not running"
+	}
+	watched := fmt.Sprintf("%d", status.WatchedDirs)
+	switch {
+	case status.WatchSystemLimitReached:
+		watched += fmt.Sprintf(" (system watch limit reached, %d skipped)", status.SkippedDirs)
+	case status.WatchLimitReached:
+		watched += fmt.Sprintf(" (limit reached, %d skipped)", status.SkippedDirs)
+	}
+
+	fmt.Fprintf(out, "Version:       %s %s (%s)\n", status.Version.Version, status.Version.Commit, status.Version.GoVersion)
+	fmt.Fprintf(out, "State:         %s\n", state)
+	fmt.Fprintf(out, "Running for:   %s\n", time.Since(status.StartedAt).Round(time.Second))
+	fmt.Fprintf(out, "Keyboard hook: %s\n", hook)
+	fmt.Fprintf(out, "Watched dirs:  %s\n", watched)
+
+	if len(status.Events) == 0 {
+		return
+	}
+
+	kinds := make([]string, 0, len(status.Events))
+	for kind := range status.Events {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	fmt.Fprintln(out, "Recorded since start:")
+	for _, kind := range kinds {
+		fmt.Fprintf(out, "  %-14s %d\n", kind, status.Events[kind])
+	}
+}
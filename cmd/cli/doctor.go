@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/nilszeilon/devstats/internal/collector"
+	"github.com/spf13/cobra"
+)
+
+// check is a single diagnostic, err describes what to fix when it fails
+type check struct {
+	name string
+	err  error
+}
+
+func newDoctorCmd(root *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Check permissions, watched paths and databases before collecting",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(cmd, root)
+		},
+	}
+}
+
+func runDoctor(cmd *cobra.Command, root *rootOptions) error {
+	checks := []check{
+		{name: "keyboard hook can be installed", err: collector.CheckKeyHook()},
+	}
+
+	paths := append([]string(nil), root.config.Paths...)
+	for _, project := range root.config.Projects {
+		paths = append(paths, project.Path)
+	}
+	for _, p := range paths {
+		checks = append(checks, check{
+			name: "watched path " + p + " is readable",
+			err:  checkReadableDir(p),
+		})
+	}
+
+	checks = append(checks,
+		check{name: "raw database " + root.dbPath + " is writable", err: checkWritable(root.dbPath)},
+		check{name: "anonymized database " + root.anonDBPath + " is writable", err: checkWritable(root.anonDBPath)},
+		check{
+			name: fmt.Sprintf("open file limit allows %d watched directories", root.config.MaxWatchedDirs),
+			err:  checkFileLimit(root.config.MaxWatchedDirs),
+		},
+	)
+
+	failed := printChecks(cmd.OutOrStdout(), checks)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// printChecks prints a line per check and returns how many failed
+func printChecks(w io.Writer, checks []check) int {
+	failed := 0
+	for _, c := range checks {
+		if c.err == nil {
+			fmt.Fprintf(w, "[ OK ] %s\n", c.name)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "[FAIL] %s\n       %v\n", c.name, c.err)
+	}
+	return failed
+}
+
+// checkReadableDir makes sure the directory at p exists and can be listed
+func checkReadableDir(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("%w, fix or remove it in the config", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("cannot list %s: %w", p, err)
+	}
+	return nil
+}
+
+// checkWritable makes sure the database at p can be written, or created if
+// it doesn't exist yet, without touching its contents
+func checkWritable(p string) error {
+	f, err := os.OpenFile(p, os.O_WRONLY, 0)
+	if err == nil {
+		return f.Close()
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w, check the file's permissions", err)
+	}
+
+	// Not created yet, so its directory must be writable
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".devstats-doctor-*")
+	if err != nil {
+		return fmt.Errorf("cannot create the database: %w", err)
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// checkFileLimit makes sure the process may open a descriptor per watched
+// directory, with room to spare for the databases and sockets
+func checkFileLimit(maxWatchedDirs int) error {
+	limit, err := collector.FileDescriptorLimit()
+	if err != nil {
+		return err
+	}
+
+	if limit < uint64(maxWatchedDirs)+64 {
+		return fmt.Errorf("the limit is %d, raise it with `ulimit -n` or lower max_watched_dirs in the config", limit)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/calendar"
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// exporter writes one type from the database at dbPath to w in the given
+// format, only the records between start and end unless both are nil
+type exporter struct {
+	// raw types are read from the raw database instead of the anonymized one
+	raw    bool
+	export func(dbPath, format string, start, end interface{}, w io.Writer) error
+	// ics writes the type as calendar events, nil if it has no calendar form
+	ics func(dbPath string, start, end interface{}, w io.Writer) error
+}
+
+var exporters = map[string]exporter{
+	"keypresses":         {export: exportType[domain.KeypressAnonymousStats]},
+	"keypresses-per-key": {export: exportType[domain.KeypressKeyStats]},
+	"keypresses-daily":   {export: exportType[domain.KeypressDailyStats]},
+	"file-changes":       {export: exportType[domain.FileChangeAnonymousStats]},
+	"file-changes-daily": {export: exportType[domain.FileChangeDailyStats]},
+	"mouse-clicks":       {export: exportType[domain.MouseClickAnonymousStats]},
+	"app-focus":          {export: exportType[domain.AppFocusAnonymousStats]},
+	"commits":            {export: exportType[domain.CommitAnonymousStats]},
+	"commands":           {export: exportType[domain.CommandAnonymousStats]},
+	"key-sequences":      {export: exportType[domain.KeySequenceStats]},
+	"key-chords":         {export: exportType[domain.KeyChordStats]},
+	"sessions":           {export: exportType[domain.SessionData], ics: exportSessionsICS},
+
+	"raw-keypresses":    {raw: true, export: exportType[domain.KeypressData]},
+	"raw-file-changes":  {raw: true, export: exportType[domain.FileChangeData]},
+	"raw-mouse-clicks":  {raw: true, export: exportType[domain.MouseClickData]},
+	"raw-app-focus":     {raw: true, export: exportType[domain.AppFocusData]},
+	"raw-commits":       {raw: true, export: exportType[domain.CommitData]},
+	"raw-commands":      {raw: true, export: exportType[domain.CommandData]},
+	"raw-key-sequences": {raw: true, export: exportType[domain.KeySequenceData]},
+	"raw-key-chords":    {raw: true, export: exportType[domain.KeyChordData]},
+}
+
+type exportOptions struct {
+	dataType string
+	format   string
+	since    string
+	out      string
+}
+
+func newExportCmd(root *rootOptions) *cobra.Command {
+	opts := &exportOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export stats as CSV, JSON or a calendar of coding sessions",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExport(cmd, root, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.dataType, "type", "keypresses", "data to export: "+strings.Join(exporterNames(), ", "))
+	cmd.Flags().StringVar(&opts.format, "format", "csv", "output format: csv, json or ics (sessions only, the default type for ics)")
+	cmd.Flags().StringVar(&opts.since, "since", "", "only export records since this duration (30d, 24h) or date (2006-01-02) (default: everything)")
+	cmd.Flags().StringVar(&opts.out, "out", "", "file to write to (default: stdout)")
+
+	return cmd
+}
+
+func runExport(cmd *cobra.Command, root *rootOptions, opts *exportOptions) error {
+	// Sessions are the only type with a calendar form
+	if opts.format == "ics" && !cmd.Flags().Changed("type") {
+		opts.dataType = "sessions"
+	}
+
+	exp, ok := exporters[opts.dataType]
+	if !ok {
+		return fmt.Errorf("unknown type %q, expected one of: %s", opts.dataType, strings.Join(exporterNames(), ", "))
+	}
+	switch opts.format {
+	case "csv", "json":
+	case "ics":
+		if exp.ics == nil {
+			return fmt.Errorf("type %q can't be exported as ics, only sessions can", opts.dataType)
+		}
+	default:
+		return fmt.Errorf("unknown format %q, expected csv, json or ics", opts.format)
+	}
+
+	var start, end interface{}
+	if opts.since != "" {
+		loc, err := root.config.Location()
+		if err != nil {
+			return err
+		}
+		now := time.Now().In(loc)
+		if start, err = parseSince(opts.since, now); err != nil {
+			return err
+		}
+		end = now
+	}
+
+	w := cmd.OutOrStdout()
+	if opts.out != "" {
+		f, err := os.Create(opts.out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	dbPath := root.anonDBPath
+	if exp.raw {
+		dbPath = root.dbPath
+	}
+
+	if opts.format == "ics" {
+		return exp.ics(dbPath, start, end, w)
+	}
+	return exp.export(dbPath, opts.format, start, end, w)
+}
+
+func exportType[T any](dbPath, format string, start, end interface{}, w io.Writer) error {
+	store, err := storage.NewSQLiteStore[T](dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch {
+	case start == nil && format == "json":
+		return storage.ExportJSON[T](store, w)
+	case start == nil:
+		return storage.ExportCSV[T](store, w)
+	case format == "json":
+		return storage.ExportJSONBetween[T](store, start, end, w)
+	default:
+		return storage.ExportCSVBetween[T](store, start, end, w)
+	}
+}
+
+// exportSessionsICS writes the sessions that ended between start and end as
+// calendar events, all of them if both are nil
+func exportSessionsICS(dbPath string, start, end interface{}, w io.Writer) error {
+	store, err := storage.NewSQLiteStore[domain.SessionData](dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var sessions []domain.SessionData
+	if start == nil {
+		sessions, err = store.Get()
+	} else {
+		sessions, err = store.FindBetweenTyped(start, end)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read sessions: %w", err)
+	}
+
+	return calendar.WriteICS(w, sessions, time.Now())
+}
+
+func exporterNames() []string {
+	names := make([]string, 0, len(exporters))
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/analysis"
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// heatmapShades go from no activity to the busiest hour
+var heatmapShades = []string{"  ", "░░", "▒▒", "▓▓", "██"}
+
+type heatmapOptions struct {
+	since  string
+	output string
+}
+
+func newHeatmapCmd(root *rootOptions) *cobra.Command {
+	opts := &heatmapOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "heatmap",
+		Short: "Print keypresses by weekday and hour of day",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHeatmap(cmd, root, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.since, "since", "30d", "start of the range, as a duration (30d, 24h) or a date (2006-01-02)")
+	addOutputFlag(cmd, &opts.output)
+
+	return cmd
+}
+
+func runHeatmap(cmd *cobra.Command, root *rootOptions, opts *heatmapOptions) error {
+	out := cmd.OutOrStdout()
+	format, err := outputFormat(out, opts.output)
+	if err != nil {
+		return err
+	}
+
+	loc, err := root.config.Location()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().In(loc)
+	start, err := parseSince(opts.since, now)
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.NewSQLiteStore[domain.KeypressAnonymousStats](root.anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	stats, err := store.FindBetweenTyped(start, now)
+	if err != nil {
+		return err
+	}
+
+	heatmap := analysis.KeypressHeatmap(stats, loc)
+	if format == outputJSON {
+		// Rows are indexed by weekday, Sunday first, like the API's
+		return printJSON(out, heatmap)
+	}
+
+	max := heatmap.Max()
+	if max == 0 {
+		fmt.Fprintln(out, "No keypresses recorded in this period.")
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("    ")
+	for hour := 0; hour < 24; hour++ {
+		fmt.Fprintf(&b, "%-3d", hour)
+	}
+	b.WriteString("\n")
+
+	// Weeks start on Monday
+	for i := 1; i <= 7; i++ {
+		day := time.Weekday(i % 7)
+		fmt.Fprintf(&b, "%s ", day.String()[:3])
+		for _, count := range heatmap[day] {
+			b.WriteString(heatmapShade(count, max) + " ")
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "\nless %s more (busiest hour: %d keypresses)\n", strings.Join(heatmapShades[1:], ""), max)
+
+	_, err = fmt.Fprint(out, b.String())
+	return err
+}
+
+// heatmapShade picks the shade for count relative to the busiest hour. Any
+// activity at all gets at least the lightest shade.
+func heatmapShade(count, max int64) string {
+	if count == 0 {
+		return heatmapShades[0]
+	}
+	levels := int64(len(heatmapShades) - 1)
+	level := 1 + (count*levels-1)/max
+	return heatmapShades[level]
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// importers copy the raw records of one type from a JSON file store into
+// the database at dbPath and return how many were copied
+var importers = map[string]func(from, dbPath string) (int64, error){
+	"keypresses":   importType[domain.KeypressData],
+	"file-changes": importType[domain.FileChangeData],
+	"mouse-clicks": importType[domain.MouseClickData],
+	"app-focus":    importType[domain.AppFocusData],
+	"commits":      importType[domain.CommitData],
+	"commands":     importType[domain.CommandData],
+}
+
+type importOptions struct {
+	dataType string
+	from     string
+	to       string
+}
+
+func newImportCmd(root *rootOptions) *cobra.Command {
+	opts := &importOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Copy raw data saved by the JSON file store into the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImport(cmd, root, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.dataType, "type", "keypresses", "data in the file: "+strings.Join(importerNames(), ", "))
+	cmd.Flags().StringVar(&opts.from, "from", "", "JSON file written by the file store")
+	cmd.Flags().StringVar(&opts.to, "to", "", "database to import into (default: the raw database)")
+	cmd.MarkFlagRequired("from")
+
+	return cmd
+}
+
+func runImport(cmd *cobra.Command, root *rootOptions, opts *importOptions) error {
+	importer, ok := importers[opts.dataType]
+	if !ok {
+		return fmt.Errorf("unknown type %q, expected one of: %s", opts.dataType, strings.Join(importerNames(), ", "))
+	}
+
+	// The file store starts out empty rather than failing on a missing file
+	if _, err := os.Stat(opts.from); err != nil {
+		return err
+	}
+
+	to := opts.to
+	if to == "" {
+		to = root.dbPath
+	}
+
+	imported, err := importer(opts.from, to)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Imported %d %s records into %s\n", imported, opts.dataType, to)
+	return nil
+}
+
+func importType[T any](from, dbPath string) (int64, error) {
+	src, err := storage.NewFileStore[T](from)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", from, err)
+	}
+
+	dst, err := storage.NewSQLiteStore[T](dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	if err := storage.Migrate[T](src, dst); err != nil {
+		return 0, err
+	}
+	return src.Count(nil, nil)
+}
+
+func importerNames() []string {
+	names := make([]string, 0, len(importers))
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
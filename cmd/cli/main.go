@@ -1,159 +1,139 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"syscall"
-	"time"
 
-	"github.com/nilszeilon/devstats/internal/anon"
-	"github.com/nilszeilon/devstats/internal/collector"
-	"github.com/nilszeilon/devstats/internal/domain"
-	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/nilszeilon/devstats/internal/config"
+	"github.com/spf13/cobra"
 )
 
-func main() {
-	log.Println("Starting devstats...")
-	// Get the current working directory (where the program was started from)
-	baseDir, err := os.Getwd()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Get user's home directory from environment variable
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatal("Failed to get home directory:", err)
-	}
-
-	// Create the collector with paths to watch
-	paths := []string{
-		homeDir,
-		// Add more paths as needed
-	}
-
-	// Create absolute paths for all files
-	dbPath := filepath.Join(baseDir, "devstats.db")
-	log.Printf("Using database at: %s", dbPath)
+// Annotations a command sets to skip parts of the setup every command
+// otherwise gets before it runs
+const (
+	// annotationNoConfig skips loading the config, for commands that must
+	// work even if it is broken
+	annotationNoConfig = "devstats:no-config"
+	// annotationNoDatabase skips creating the database directory, for
+	// commands that don't open the databases
+	annotationNoDatabase = "devstats:no-database"
+)
 
-	// Setup anonymizer stores
-	anonDBPath := filepath.Join(baseDir, "devstats_anon.db")
+// rootOptions holds the flags shared by every command
+type rootOptions struct {
+	configPath string
+	dbPath     string
+	anonDBPath string
+	dbDir      string
 
-	// init sqlite storage
-	keypressStore, err := storage.NewSQLiteStore[domain.KeypressData](dbPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer keypressStore.Close()
-
-	// Create keypress collector
-	keypressCollector := collector.NewKeypressCollector(keypressStore)
+	config config.Config
+}
 
-	// Start collecting
-	if err := keypressCollector.Start(); err != nil {
-		log.Fatalf("Failed to start keypress collector: %v", err)
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
 	}
+}
 
-	// init sqlite storage
-	fileChangeStore, err := storage.NewSQLiteStore[domain.FileChangeData](dbPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer fileChangeStore.Close()
+func newRootCmd() *cobra.Command {
+	opts := &rootOptions{}
 
-	fileCollector, err := collector.NewFileChangeCollector(fileChangeStore, paths)
-	if err != nil {
-		log.Fatal(err)
-	}
+	defaultConfigPath, _ := config.DefaultPath()
 
-	// Start collecting
-	err = fileCollector.Start()
-	if err != nil {
-		log.Fatal(err)
+	cmd := &cobra.Command{
+		Use:          "devstats",
+		Short:        "Collect and report developer statistics",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if cobraBuiltin(cmd) || cmd.Annotations[annotationNoConfig] != "" {
+				return nil
+			}
+			if err := opts.loadConfig(cmd); err != nil {
+				return err
+			}
+			if cmd.Annotations[annotationNoDatabase] != "" {
+				return nil
+			}
+			return opts.createDatabaseDirs()
+		},
 	}
 
-	// Don't forget to stop it when done
-	defer fileCollector.Stop()
+	cmd.PersistentFlags().StringVar(&opts.configPath, "config", defaultConfigPath, "path to the config file")
+	cmd.PersistentFlags().StringVar(&opts.dbPath, "db", "", "path to the raw database (default: db_path from the config, or devstats.db in the data directory)")
+	cmd.PersistentFlags().StringVar(&opts.anonDBPath, "anon-db", "", "path to the anonymized database (default: anon_db_path from the config, or devstats_anon.db in the data directory)")
+	cmd.PersistentFlags().StringVar(&opts.dbDir, "db-dir", "", "directory to keep both databases in (default: $XDG_DATA_HOME/devstats or ~/.local/share/devstats)")
+
+	cmd.AddCommand(
+		newCollectCmd(opts),
+		newReportCmd(opts),
+		newExportCmd(opts),
+		newServeCmd(opts),
+		newMaintenanceCmd(opts),
+		newTUICmd(opts),
+		newBackupCmd(opts),
+		newTopKeysCmd(opts),
+		newHeatmapCmd(opts),
+		newStatusCmd(opts),
+		newPauseCmd(opts),
+		newResumeCmd(opts),
+		newFlushCmd(opts),
+		newDoctorCmd(opts),
+		newImportCmd(opts),
+		newNotifyCmd(opts),
+		newResetCmd(opts),
+		newVersionCmd(),
+	)
 
-	log.Println("Keypress collector started. Press Ctrl+C to stop.")
+	return cmd
+}
 
-	// Create stores for anonymous data
-	keypressAnonStore, err := storage.NewSQLiteStore[domain.KeypressAnonymousStats](anonDBPath)
+// loadConfig reads the config file. Database paths given as flags take
+// precedence over --db-dir, which takes precedence over the paths in the file.
+func (o *rootOptions) loadConfig(cmd *cobra.Command) error {
+	cfg, err := config.Load(o.configPath)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer keypressAnonStore.Close()
+	o.config = cfg
 
-	fileChangeAnonStore, err := storage.NewSQLiteStore[domain.FileChangeAnonymousStats](anonDBPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer fileChangeAnonStore.Close()
-
-	// Create anonymizer services
-	keypressAnonymizer, err := anon.NewService[domain.KeypressData, domain.KeypressAnonymousStats](
-		keypressStore,
-		keypressAnonStore,
-		anon.Config{
-			IntervalSize: 10 * time.Minute,
-		},
-	)
-	if err != nil {
-		log.Fatal(err)
+	if !cmd.Flags().Changed("db") {
+		o.dbPath = cfg.DBPath
+		if o.dbDir != "" {
+			o.dbPath = filepath.Join(o.dbDir, config.DBFileName)
+		}
 	}
-
-	fileChangeAnonymizer, err := anon.NewService[domain.FileChangeData, domain.FileChangeAnonymousStats](
-		fileChangeStore,
-		fileChangeAnonStore,
-		anon.Config{
-			IntervalSize: 10 * time.Minute,
-		},
-	)
-	if err != nil {
-		log.Fatal(err)
+	if !cmd.Flags().Changed("anon-db") {
+		o.anonDBPath = cfg.AnonDBPath
+		if o.dbDir != "" {
+			o.anonDBPath = filepath.Join(o.dbDir, config.AnonDBFileName)
+		}
 	}
 
-	// Start anonymization ticker
-	ticker := time.NewTicker(10 * time.Minute)
-	defer ticker.Stop()
+	return nil
+}
 
-	// Run first anonymization immediately
-	now := time.Now()
-	start := now.Add(-10 * time.Minute)
-	if err := keypressAnonymizer.ProcessInterval(start, now); err != nil {
-		log.Printf("Error processing keypress interval: %v", err)
-	}
-	if err := fileChangeAnonymizer.ProcessInterval(start, now); err != nil {
-		log.Printf("Error processing file change interval: %v", err)
+// createDatabaseDirs creates the directories of both databases, the
+// default data directory doesn't exist on a fresh install
+func (o *rootOptions) createDatabaseDirs() error {
+	for _, p := range []string{o.dbPath, o.anonDBPath} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return fmt.Errorf("failed to create database directory: %w", err)
+		}
 	}
 
-	// Setup signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Wait for either interrupt signal or ticker
-	for {
-		select {
-		case <-sigChan:
-			log.Println("Shutting down gracefully...")
-			keypressCollector.Stop()
-			fileCollector.Stop()
-			log.Println("Shutdown complete")
-			return
-		case t := <-ticker.C:
-			start := t.Add(-10 * time.Minute)
-			if err := keypressAnonymizer.ProcessInterval(start, t); err != nil {
-				log.Printf("Error processing keypress interval: %v", err)
-			}
-			if err := fileChangeAnonymizer.ProcessInterval(start, t); err != nil {
-				log.Printf("Error processing file change interval: %v", err)
-			}
+	return nil
+}
+
+// cobraBuiltin reports whether cmd is one of the commands cobra adds, help
+// and completion, or the hidden ones shells call for completions. None of
+// them needs the config or the databases.
+func cobraBuiltin(cmd *cobra.Command) bool {
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		switch c.Name() {
+		case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+			return true
 		}
 	}
-
-	log.Println("Shutting down gracefully...")
-	keypressCollector.Stop()
-	log.Println("Shutdown complete")
+	return false
 }
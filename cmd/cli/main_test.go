@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Commands that don't touch the data work with a broken config and don't
+// create the database directory
+func TestSetupSkippedForCommandsWithoutData(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte("interval: [broken\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dbDir := filepath.Join(dir, "data")
+
+	for _, args := range [][]string{
+		{"version"},
+		{"help"},
+		{"help", "report"},
+		{"completion", "bash"},
+	} {
+		cmd := newRootCmd()
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs(append([]string{"--config", configPath, "--db-dir", dbDir}, args...))
+		if err := cmd.Execute(); err != nil {
+			t.Errorf("%v: %v", args, err)
+		}
+	}
+
+	if _, err := os.Stat(dbDir); !os.IsNotExist(err) {
+		t.Errorf("database directory was created: %v", err)
+	}
+
+	// Commands reading the data still load the config
+	cmd := newRootCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs([]string{"--config", configPath, "--db-dir", dbDir, "report"})
+	if err := cmd.Execute(); err == nil {
+		t.Error("report ran with a broken config")
+	}
+}
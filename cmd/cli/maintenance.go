@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+func newMaintenanceCmd(root *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "maintenance",
+		Short: "Compact the databases to reclaim disk space",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, dbPath := range []string{root.dbPath, root.anonDBPath} {
+				if err := vacuumDB(cmd, dbPath); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// vacuumDB compacts the database at dbPath and prints how much space was freed
+func vacuumDB(cmd *cobra.Command, dbPath string) error {
+	before, err := fileSize(dbPath)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.Vacuum(dbPath); err != nil {
+		return err
+	}
+
+	after, err := fileSize(dbPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "%s: %d -> %d bytes\n", dbPath, before, after)
+	return nil
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/config"
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/notify"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type notifyOptions struct {
+	print bool
+}
+
+func newNotifyCmd(root *rootOptions) *cobra.Command {
+	opts := &notifyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Send the summary of the past week now, e.g. to test the notify config",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runNotify(cmd, root, opts)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.print, "print", false, "print the summary instead of sending it")
+
+	return cmd
+}
+
+func runNotify(cmd *cobra.Command, root *rootOptions, opts *notifyOptions) error {
+	if !opts.print && !root.config.Notify.Enabled() {
+		return errors.New("set notify.webhook_url or notify.smtp in the config to send summaries")
+	}
+
+	keypressStore, err := storage.NewSQLiteStore[domain.KeypressAnonymousStats](root.anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer keypressStore.Close()
+
+	fileChangeStore, err := storage.NewSQLiteStore[domain.FileChangeAnonymousStats](root.anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer fileChangeStore.Close()
+
+	notifier, err := newNotifier(root.config, keypressStore, fileChangeStore)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	summary, err := notifier.Summary(now.AddDate(0, 0, -7), now)
+	if err != nil {
+		return err
+	}
+
+	if opts.print {
+		fmt.Fprint(cmd.OutOrStdout(), summary.Text())
+		return nil
+	}
+
+	// Sent once without retries, the error is what needs fixing
+	for _, sender := range notifySenders(root.config.Notify) {
+		if err := sender.Send(summary); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), "Summary sent")
+	return nil
+}
+
+// newNotifier creates a notifier for the schedule and senders in cfg
+func newNotifier(cfg config.Config, keypresses storage.Store[domain.KeypressAnonymousStats], fileChanges storage.Store[domain.FileChangeAnonymousStats]) (*notify.Notifier, error) {
+	loc, err := cfg.Location()
+	if err != nil {
+		return nil, err
+	}
+	weekday, err := cfg.Notify.Day()
+	if err != nil {
+		return nil, err
+	}
+
+	return notify.NewNotifier(
+		notify.Stores{
+			Keypresses:  keypresses,
+			FileChanges: fileChanges,
+		},
+		notify.Schedule{
+			Weekday:  weekday,
+			Hour:     cfg.Notify.Hour,
+			Location: loc,
+		},
+		notifySenders(cfg.Notify)...,
+	), nil
+}
+
+// notifySenders returns a sender for each destination configured in cfg
+func notifySenders(cfg config.NotifyConfig) []notify.Sender {
+	var senders []notify.Sender
+	if cfg.WebhookURL != "" {
+		senders = append(senders, notify.Webhook{URL: cfg.WebhookURL})
+	}
+	if cfg.SMTP != nil {
+		senders = append(senders, notify.Email{
+			Addr:     net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+			To:       cfg.SMTP.To,
+		})
+	}
+	return senders
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Formats accepted by --output
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// addOutputFlag adds --output to a command that prints a table
+func addOutputFlag(cmd *cobra.Command, output *string) {
+	cmd.Flags().StringVar(output, "output", "", "output format, table or json (default: table on a terminal, json otherwise)")
+}
+
+// outputFormat returns the format to print to w in, the --output value if
+// given and otherwise a table only if w is a terminal, so piping into jq
+// just works
+func outputFormat(w io.Writer, output string) (string, error) {
+	switch output {
+	case outputTable, outputJSON:
+		return output, nil
+	case "":
+		if isTerminal(w) {
+			return outputTable, nil
+		}
+		return outputJSON, nil
+	}
+	return "", fmt.Errorf("unknown output %q, expected table or json", output)
+}
+
+// isTerminal reports whether w is a terminal rather than a file or pipe
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printJSON writes v to w as indented JSON
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
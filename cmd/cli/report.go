@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/analysis"
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// streakThresholds is the activity a day needs to extend a streak
+var streakThresholds = analysis.StreakThresholds{
+	Keypresses:  100,
+	FileChanges: 1,
+}
+
+type reportOptions struct {
+	since  string
+	host   string
+	output string
+}
+
+// dayReport holds the totals for a single day
+type dayReport struct {
+	Day        time.Time `json:"day"`
+	Keypresses int64     `json:"keypresses"`
+	PeakWPM    float64   `json:"peak_wpm"`
+	AvgWPM     float64   `json:"avg_wpm"`
+	// MedianGapMs and P90GapMs describe the pauses between keypresses
+	// while typing, see analysis.TypingRhythm
+	MedianGapMs int64            `json:"median_gap_ms"`
+	P90GapMs    int64            `json:"p90_gap_ms"`
+	FileChanges map[string]int64 `json:"file_changes"`
+	// EditRatio is the day's file changes per keypress
+	EditRatio float64 `json:"edit_ratio"`
+}
+
+func newReportCmd(root *rootOptions) *cobra.Command {
+	opts := &reportOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Print daily keypress, typing speed and file change totals",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReport(cmd, root, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.since, "since", "7d", "start of the report, as a duration (7d, 24h) or a date (2006-01-02)")
+	cmd.Flags().StringVar(&opts.host, "host", "", "only report the stats recorded on this machine (default: all machines)")
+	addOutputFlag(cmd, &opts.output)
+
+	return cmd
+}
+
+func runReport(cmd *cobra.Command, root *rootOptions, opts *reportOptions) error {
+	out := cmd.OutOrStdout()
+	format, err := outputFormat(out, opts.output)
+	if err != nil {
+		return err
+	}
+
+	loc, err := root.config.Location()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().In(loc)
+	start, err := parseSince(opts.since, now)
+	if err != nil {
+		return err
+	}
+
+	keypressStore, err := storage.NewSQLiteStore[domain.KeypressAnonymousStats](root.anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer keypressStore.Close()
+
+	fileChangeStore, err := storage.NewSQLiteStore[domain.FileChangeAnonymousStats](root.anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer fileChangeStore.Close()
+
+	// Typing speed needs the individual keypresses, so it comes from the raw database
+	rawKeypressStore, err := storage.NewSQLiteStore[domain.KeypressData](root.dbPath)
+	if err != nil {
+		return err
+	}
+	defer rawKeypressStore.Close()
+
+	keypresses, err := findHost(keypressStore, opts.host, start, now)
+	if err != nil {
+		return err
+	}
+
+	fileChanges, err := findHost(fileChangeStore, opts.host, start, now)
+	if err != nil {
+		return err
+	}
+
+	rawKeypresses, err := findHost(rawKeypressStore, opts.host, start, now)
+	if err != nil {
+		return err
+	}
+
+	days := make(map[time.Time]*dayReport)
+	reportFor := func(t time.Time) *dayReport {
+		day := dayStart(t.In(now.Location()))
+		if days[day] == nil {
+			days[day] = &dayReport{Day: day, FileChanges: make(map[string]int64)}
+		}
+		return days[day]
+	}
+
+	for _, stats := range keypresses {
+		reportFor(stats.Timestamp).Keypresses += stats.KeypressesCount
+	}
+
+	for _, wpm := range analysis.Daily(analysis.WPM(rawKeypresses), now.Location()) {
+		report := reportFor(wpm.Day)
+		report.PeakWPM = wpm.Peak
+		report.AvgWPM = wpm.Average
+	}
+
+	for _, rhythm := range analysis.TypingRhythm(rawKeypresses, 24*time.Hour, analysis.DefaultIdleGap, now.Location()) {
+		report := reportFor(rhythm.Timestamp)
+		report.MedianGapMs = rhythm.MedianGapMs
+		report.P90GapMs = rhythm.P90GapMs
+	}
+
+	languageSet := make(map[string]bool)
+	for _, stats := range fileChanges {
+		reportFor(stats.Timestamp).FileChanges[stats.Language] += stats.ChangesInSpan
+		languageSet[stats.Language] = true
+	}
+
+	// Stats anonymized at different cadences are joined on the longer one
+	ratioInterval := max(root.config.IntervalFor("keypresses"), root.config.IntervalFor("file_changes"))
+	editRatios := analysis.EditRatios(keypresses, fileChanges, ratioInterval, now.Location())
+	dayTotals := make(map[time.Time]*analysis.EditRatio)
+	for _, ratio := range editRatios {
+		day := dayStart(ratio.Start.In(now.Location()))
+		if dayTotals[day] == nil {
+			dayTotals[day] = &analysis.EditRatio{Start: day}
+		}
+		dayTotals[day].Keypresses += ratio.Keypresses
+		dayTotals[day].FileChanges += ratio.FileChanges
+	}
+	for day, totals := range dayTotals {
+		if totals.Keypresses > 0 {
+			reportFor(day).EditRatio = float64(totals.FileChanges) / float64(totals.Keypresses)
+		}
+	}
+
+	reports := make([]*dayReport, 0, len(days))
+	for _, report := range days {
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Day.Before(reports[j].Day)
+	})
+
+	if format == outputJSON {
+		return printJSON(out, reports)
+	}
+
+	if len(days) == 0 {
+		fmt.Fprintln(out, "No stats recorded in this period.")
+		return nil
+	}
+
+	languages := make([]string, 0, len(languageSet))
+	for lang := range languageSet {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "DATE\tKEYPRESSES\tPEAK WPM\tAVG WPM\tMEDIAN GAP\tP90 GAP\t")
+	for _, lang := range languages {
+		fmt.Fprintf(w, "%s\t", lang)
+	}
+	fmt.Fprintln(w)
+
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%.0f\t%.0f\t%dms\t%dms\t", report.Day.Format("2006-01-02"), report.Keypresses, report.PeakWPM, report.AvgWPM, report.MedianGapMs, report.P90GapMs)
+		for _, lang := range languages {
+			fmt.Fprintf(w, "%d\t", report.FileChanges[lang])
+		}
+		fmt.Fprintln(w)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	if err := printAverage(out, keypresses, "KeypressesCount", "keypresses", root.config.IntervalFor("keypresses"), func(s domain.KeypressAnonymousStats) time.Time {
+		return s.Timestamp
+	}); err != nil {
+		return err
+	}
+	if err := printAverage(out, fileChanges, "ChangesInSpan", "file changes", root.config.IntervalFor("file_changes"), func(s domain.FileChangeAnonymousStats) time.Time {
+		return s.Timestamp
+	}); err != nil {
+		return err
+	}
+	printEditRatioTrend(out, reports)
+	printSampling(out, keypresses)
+
+	streaks, err := codingStreaks(root, opts.host, now)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Current streak: %s\n", pluralDays(streaks.Current))
+	fmt.Fprintf(out, "Longest streak: %s\n", pluralDays(streaks.Longest))
+	return nil
+}
+
+// codingStreaks computes the streaks over every day in the daily rollups,
+// not just the reported range, only counting host's days if it isn't empty
+func codingStreaks(root *rootOptions, host string, now time.Time) (analysis.Streaks, error) {
+	keypressStore, err := storage.NewSQLiteStore[domain.KeypressDailyStats](root.anonDBPath)
+	if err != nil {
+		return analysis.Streaks{}, err
+	}
+	defer keypressStore.Close()
+
+	fileChangeStore, err := storage.NewSQLiteStore[domain.FileChangeDailyStats](root.anonDBPath)
+	if err != nil {
+		return analysis.Streaks{}, err
+	}
+	defer fileChangeStore.Close()
+
+	keypresses, err := findHost(keypressStore, host, nil, nil)
+	if err != nil {
+		return analysis.Streaks{}, err
+	}
+
+	fileChanges, err := findHost(fileChangeStore, host, nil, nil)
+	if err != nil {
+		return analysis.Streaks{}, err
+	}
+
+	active := analysis.ActiveDays(keypresses, fileChanges, streakThresholds, now.Location())
+	return analysis.CodingStreaks(active, now), nil
+}
+
+// findHost returns the records of store between start and end, only those
+// recorded on host if it isn't empty. Nil bounds leave the range open.
+func findHost[T any](store storage.Store[T], host string, start, end interface{}) ([]T, error) {
+	var conds map[string]interface{}
+	if host != "" {
+		conds = map[string]interface{}{"host": host}
+	}
+	return store.Find(conds, start, end)
+}
+
+// printAverage prints the average and peak per interval of the count field
+// of records, e.g. "avg 4,312 keypresses/10min, peak 19,004". Records are
+// split by host, language and so on, so the ones sharing a timestamp are
+// summed into their interval's total first. Nothing is printed without records.
+func printAverage[T any](w io.Writer, records []T, field, unit string, interval time.Duration, timestamp func(T) time.Time) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	values, err := analysis.FieldValues(records, field)
+	if err != nil {
+		return err
+	}
+
+	totals := make(map[time.Time]int64)
+	for i, record := range records {
+		totals[timestamp(record).UTC()] += values[i]
+	}
+	perInterval := make([]int64, 0, len(totals))
+	for _, total := range totals {
+		perInterval = append(perInterval, total)
+	}
+	summary := analysis.Summarize(perInterval)
+
+	fmt.Fprintf(w, "avg %s %s/%s, peak %s\n", formatCount(summary.Mean), unit, formatInterval(interval), formatCount(summary.Max))
+	return nil
+}
+
+// formatCount formats n with thousands separators, e.g. 19,004
+func formatCount(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return sign + digits
+}
+
+// formatInterval formats whole hours and minutes the short way, e.g. 10min
+func formatInterval(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dmin", d/time.Minute)
+	}
+	return d.String()
+}
+
+// printEditRatioTrend prints the overall file changes per keypress and a
+// sparkline of each day's, e.g. "0.012 edits/keystroke, by day ▂▃▅▁█".
+// Nothing is printed without keypresses.
+func printEditRatioTrend(w io.Writer, reports []*dayReport) {
+	var keypresses, changes int64
+	var peak float64
+	for _, report := range reports {
+		keypresses += report.Keypresses
+		for _, count := range report.FileChanges {
+			changes += count
+		}
+		peak = max(peak, report.EditRatio)
+	}
+	if keypresses == 0 {
+		return
+	}
+
+	var trend strings.Builder
+	for _, report := range reports {
+		i := 0
+		if peak > 0 {
+			i = int(report.EditRatio / peak * float64(len(sparkChars)-1))
+		}
+		trend.WriteRune(sparkChars[i])
+	}
+
+	fmt.Fprintf(w, "%.3f edits/keystroke, by day %s\n", float64(changes)/float64(keypresses), trend.String())
+}
+
+// printSampling notes when keypress counts were estimated from a sample,
+// e.g. "... from a sample of as little as 25%". Nothing is printed if
+// every keypress was recorded.
+func printSampling(w io.Writer, keypresses []domain.KeypressAnonymousStats) {
+	lowest := 1.0
+	for _, stats := range keypresses {
+		// Stats from before sampling existed have no rate
+		if stats.SampleRate > 0 {
+			lowest = min(lowest, stats.SampleRate)
+		}
+	}
+	if lowest < 1 {
+		fmt.Fprintf(w, "keypress counts are estimated from a sample of as little as %.0f%%\n", lowest*100)
+	}
+}
+
+// sparkChars are the bars of a sparkline, lowest first
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+func pluralDays(n int) string {
+	if n == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", n)
+}
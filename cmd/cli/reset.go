@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type resetOptions struct {
+	yes bool
+}
+
+// errResetAborted is returned when the reset isn't confirmed
+var errResetAborted = errors.New("reset aborted, nothing was deleted")
+
+func newResetCmd(root *rootOptions) *cobra.Command {
+	opts := &resetOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Delete every record from both databases, keeping the files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !opts.yes {
+				fmt.Fprintf(cmd.OutOrStdout(), "This deletes all data in %s and %s. Type yes to continue: ", root.dbPath, root.anonDBPath)
+				answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+				if strings.TrimSpace(answer) != "yes" {
+					return errResetAborted
+				}
+			}
+
+			// Every table of each database, the files and their schema
+			// version stay
+			rawTables := []func(string) error{
+				truncateTable[domain.KeypressData],
+				truncateTable[domain.FileChangeData],
+				truncateTable[domain.MouseClickData],
+				truncateTable[domain.AppFocusData],
+				truncateTable[domain.CommitData],
+				truncateTable[domain.CommandData],
+				truncateTable[domain.KeySequenceData],
+				truncateTable[domain.KeyChordData],
+			}
+			anonTables := []func(string) error{
+				truncateTable[domain.KeypressAnonymousStats],
+				truncateTable[domain.KeypressKeyStats],
+				truncateTable[domain.KeypressDailyStats],
+				truncateTable[domain.FileChangeAnonymousStats],
+				truncateTable[domain.FileChangeDailyStats],
+				truncateTable[domain.MouseClickAnonymousStats],
+				truncateTable[domain.AppFocusAnonymousStats],
+				truncateTable[domain.CommitAnonymousStats],
+				truncateTable[domain.CommandAnonymousStats],
+				truncateTable[domain.KeySequenceStats],
+				truncateTable[domain.KeyChordStats],
+				truncateTable[domain.SessionData],
+			}
+
+			for _, truncate := range rawTables {
+				if err := truncate(root.dbPath); err != nil {
+					return err
+				}
+			}
+			for _, truncate := range anonTables {
+				if err := truncate(root.anonDBPath); err != nil {
+					return err
+				}
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Deleted all data in %s and %s, run maintenance to reclaim the disk space\n", root.dbPath, root.anonDBPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.yes, "yes", false, "don't ask for confirmation")
+
+	return cmd
+}
+
+// truncateTable removes every record of T from the database at dbPath
+func truncateTable[T any](dbPath string) error {
+	store, err := storage.NewSQLiteStore[T](dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.Truncate()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/server"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// cacheTTL is how long the API and dashboard remember the result of a
+	// query over settled stats
+	cacheTTL = 5 * time.Minute
+	// cacheEntries is how many query results are remembered per store
+	cacheEntries = 256
+)
+
+type serveOptions struct {
+	addr string
+}
+
+func newServeCmd(root *rootOptions) *cobra.Command {
+	opts := &serveOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve anonymized stats as JSON over HTTP",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(root, opts)
+		},
+	}
+
+	// Only reachable from this machine unless explicitly changed
+	cmd.Flags().StringVar(&opts.addr, "addr", "127.0.0.1:8080", "address to listen on")
+
+	return cmd
+}
+
+func runServe(root *rootOptions, opts *serveOptions) error {
+	loc, err := root.config.Location()
+	if err != nil {
+		return err
+	}
+
+	keypressStore, err := storage.NewSQLiteStore[domain.KeypressAnonymousStats](root.anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer keypressStore.Close()
+
+	fileChangeStore, err := storage.NewSQLiteStore[domain.FileChangeAnonymousStats](root.anonDBPath)
+	if err != nil {
+		return err
+	}
+	defer fileChangeStore.Close()
+
+	srv := &http.Server{
+		Addr: opts.addr,
+		Handler: server.NewHandler(server.Stores{
+			// The previous bucket is rewritten when the collector restarts,
+			// so stats settle two intervals after they were recorded
+			Keypresses:  storage.NewCachingStore(keypressStore, 2*root.config.IntervalFor("keypresses"), cacheTTL, cacheEntries),
+			FileChanges: storage.NewCachingStore(fileChangeStore, 2*root.config.IntervalFor("file_changes"), cacheTTL, cacheEntries),
+		}, loc),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errChan := make(chan error, 1)
+	go func() {
+		log.Printf("Serving stats on http://%s", opts.addr)
+		errChan <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errChan:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		log.Println("Shutting down server...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
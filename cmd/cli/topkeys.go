@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type topKeysOptions struct {
+	since  string
+	limit  int
+	output string
+}
+
+// keyCount is how often a key was pressed and its share of all keypresses
+type keyCount struct {
+	Key   string  `json:"key"`
+	Count int64   `json:"count"`
+	Share float64 `json:"share"`
+}
+
+func newTopKeysCmd(root *rootOptions) *cobra.Command {
+	opts := &topKeysOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "top-keys",
+		Short: "Print the most pressed keys",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTopKeys(cmd, root, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.since, "since", "24h", "start of the range, as a duration (7d, 24h) or a date (2006-01-02)")
+	cmd.Flags().IntVar(&opts.limit, "limit", 20, "number of keys to print")
+	addOutputFlag(cmd, &opts.output)
+
+	return cmd
+}
+
+func runTopKeys(cmd *cobra.Command, root *rootOptions, opts *topKeysOptions) error {
+	if opts.limit <= 0 {
+		return fmt.Errorf("limit must be positive, got %d", opts.limit)
+	}
+
+	out := cmd.OutOrStdout()
+	format, err := outputFormat(out, opts.output)
+	if err != nil {
+		return err
+	}
+
+	loc, err := root.config.Location()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().In(loc)
+	start, err := parseSince(opts.since, now)
+	if err != nil {
+		return err
+	}
+
+	// Individual keys are only kept in the raw database
+	store, err := storage.NewSQLiteStore[domain.KeypressData](root.dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	// A sampled keypress stands for the ones skipped alongside it, so
+	// each counts as its weight rather than once
+	estimates := make(map[string]float64)
+	var total float64
+	err = store.StreamBetween(start, now, func(keypress domain.KeypressData) error {
+		estimates[keypress.Key] += keypress.Weight()
+		total += keypress.Weight()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(estimates) == 0 && format == outputTable {
+		fmt.Fprintln(out, "No keypresses recorded in this period.")
+		return nil
+	}
+
+	keys := make([]keyCount, 0, len(estimates))
+	for key, estimate := range estimates {
+		keys = append(keys, keyCount{
+			Key:   key,
+			Count: int64(math.Round(estimate)),
+			Share: estimate / total,
+		})
+	}
+
+	// Most pressed first, ties in key order
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Share != keys[j].Share {
+			return keys[i].Share > keys[j].Share
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if len(keys) > opts.limit {
+		keys = keys[:opts.limit]
+	}
+
+	if format == outputJSON {
+		return printJSON(out, keys)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tCOUNT\tSHARE")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%d\t%.1f%%\n", key.Key, key.Count, 100*key.Share)
+	}
+
+	return w.Flush()
+}
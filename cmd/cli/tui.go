@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/nilszeilon/devstats/internal/tui"
+	"github.com/spf13/cobra"
+)
+
+func newTUICmd(root *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "tui",
+		Short: "Show a live dashboard of today's stats",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			loc, err := root.config.Location()
+			if err != nil {
+				return err
+			}
+
+			keypressStore, err := storage.NewSQLiteStore[domain.KeypressAnonymousStats](root.anonDBPath)
+			if err != nil {
+				return err
+			}
+			defer keypressStore.Close()
+
+			fileChangeStore, err := storage.NewSQLiteStore[domain.FileChangeAnonymousStats](root.anonDBPath)
+			if err != nil {
+				return err
+			}
+			defer fileChangeStore.Close()
+
+			// Today is reloaded every few seconds, the part of it that has
+			// settled comes from the cache, see serve
+			return tui.Run(tui.Stores{
+				Keypresses:  storage.NewCachingStore(keypressStore, 2*root.config.IntervalFor("keypresses"), cacheTTL, cacheEntries),
+				FileChanges: storage.NewCachingStore(fileChangeStore, 2*root.config.IntervalFor("file_changes"), cacheTTL, cacheEntries),
+			}, root.config.IntervalFor("keypresses"), loc)
+		},
+	}
+}
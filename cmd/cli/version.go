@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nilszeilon/devstats/internal/version"
+	"github.com/spf13/cobra"
+)
+
+func newVersionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version, commit and build date",
+		// The version is printed even if the config is broken
+		Annotations: map[string]string{annotationNoConfig: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Fprintln(cmd.OutOrStdout(), version.Get())
+			return nil
+		},
+	}
+}
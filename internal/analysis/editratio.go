@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/anon"
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+// EditRatio is the number of file changes per keypress of one interval
+type EditRatio struct {
+	Start       time.Time `json:"start"`
+	Keypresses  int64     `json:"keypresses"`
+	FileChanges int64     `json:"file_changes"`
+	// Ratio is FileChanges / Keypresses, 0 for an interval without keypresses
+	Ratio float64 `json:"ratio"`
+}
+
+// EditRatios joins the keypress and file change stats on their timestamps
+// and returns the edits per keystroke of every interval either has stats
+// in, oldest first. Stats are added up over hosts, languages and projects,
+// and an interval missing from one side counts as zero there. Timestamps
+// are grouped into intervals of the given size counted from midnight in
+// loc, so stats anonymized at different cadences line up when interval is
+// the longer of the two.
+func EditRatios(keypresses []domain.KeypressAnonymousStats, fileChanges []domain.FileChangeAnonymousStats, interval time.Duration, loc *time.Location) []EditRatio {
+	byStart := make(map[time.Time]*EditRatio)
+	ratioFor := func(t time.Time) *EditRatio {
+		start := anon.IntervalStart(t, interval, loc)
+		if byStart[start] == nil {
+			byStart[start] = &EditRatio{Start: start}
+		}
+		return byStart[start]
+	}
+
+	for _, stats := range keypresses {
+		ratioFor(stats.Timestamp).Keypresses += stats.KeypressesCount
+	}
+	for _, stats := range fileChanges {
+		ratioFor(stats.Timestamp).FileChanges += stats.ChangesInSpan
+	}
+
+	ratios := make([]EditRatio, 0, len(byStart))
+	for _, ratio := range byStart {
+		if ratio.Keypresses > 0 {
+			ratio.Ratio = float64(ratio.FileChanges) / float64(ratio.Keypresses)
+		}
+		ratios = append(ratios, *ratio)
+	}
+	sort.Slice(ratios, func(i, j int) bool {
+		return ratios[i].Start.Before(ratios[j].Start)
+	})
+
+	return ratios
+}
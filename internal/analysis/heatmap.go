@@ -0,0 +1,35 @@
+package analysis
+
+import (
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+// Heatmap holds counts per weekday and hour of day. Rows are indexed by
+// time.Weekday, so Sunday comes first.
+type Heatmap [7][24]int64
+
+// KeypressHeatmap adds up the keypresses of each interval in the weekday and
+// hour its start falls on in loc
+func KeypressHeatmap(stats []domain.KeypressAnonymousStats, loc *time.Location) Heatmap {
+	var heatmap Heatmap
+	for _, s := range stats {
+		t := s.Timestamp.In(loc)
+		heatmap[t.Weekday()][t.Hour()] += s.KeypressesCount
+	}
+	return heatmap
+}
+
+// Max returns the largest count in the heatmap
+func (h Heatmap) Max() int64 {
+	var max int64
+	for _, hours := range h {
+		for _, count := range hours {
+			if count > max {
+				max = count
+			}
+		}
+	}
+	return max
+}
@@ -0,0 +1,72 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/anon"
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+// DefaultIdleGap is the longest pause between keypresses still counted as
+// part of typing
+const DefaultIdleGap = 2 * time.Second
+
+// TypingRhythmStats is the distribution of the pauses between consecutive
+// keypresses in one interval
+type TypingRhythmStats struct {
+	Timestamp   time.Time `json:"timestamp"`
+	MedianGapMs int64     `json:"median_gap_ms"`
+	P90GapMs    int64     `json:"p90_gap_ms"`
+}
+
+// TypingRhythm returns the median and 90th percentile of the gaps between
+// consecutive raw keypresses on the same host, per interval counted from midnight in loc,
+// oldest first. records must be oldest first, as the stores return them. A
+// gap belongs to the interval of the keypress that ends it. Gaps longer than
+// idleGap are breaks rather than typing and are left out, as are intervals
+// without any gap.
+func TypingRhythm(records []domain.KeypressData, interval, idleGap time.Duration, loc *time.Location) []TypingRhythmStats {
+	gaps := make(map[time.Time][]time.Duration)
+	previous := make(map[string]time.Time)
+	for _, record := range records {
+		last, ok := previous[record.Host]
+		previous[record.Host] = record.Timestamp
+		if !ok {
+			continue
+		}
+
+		gap := record.Timestamp.Sub(last)
+		if gap > idleGap {
+			continue
+		}
+		start := anon.IntervalStart(record.Timestamp, interval, loc)
+		gaps[start] = append(gaps[start], gap)
+	}
+
+	stats := make([]TypingRhythmStats, 0, len(gaps))
+	for start, intervalGaps := range gaps {
+		sort.Slice(intervalGaps, func(i, j int) bool {
+			return intervalGaps[i] < intervalGaps[j]
+		})
+		stats = append(stats, TypingRhythmStats{
+			Timestamp:   start,
+			MedianGapMs: percentile(intervalGaps, 0.5).Milliseconds(),
+			P90GapMs:    percentile(intervalGaps, 0.9).Milliseconds(),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Timestamp.Before(stats[j].Timestamp)
+	})
+
+	return stats
+}
+
+// percentile returns the nearest-rank p-th percentile of the sorted,
+// non-empty values
+func percentile[T any](sorted []T, p float64) T {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
@@ -0,0 +1,118 @@
+package analysis
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+func TestTypingRhythm(t *testing.T) {
+	// Midnight in Berlin is 22:00 UTC the day before, so a day interval
+	// only lines up in the right zone
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	start := time.Date(2024, 6, 1, 21, 59, 59, 0, time.UTC)
+
+	keypresses := func(host string, offsetsMs ...int) []domain.KeypressData {
+		records := make([]domain.KeypressData, len(offsetsMs))
+		for i, ms := range offsetsMs {
+			records[i] = domain.KeypressData{Key: "a", Host: host, Timestamp: start.Add(time.Duration(ms) * time.Millisecond)}
+		}
+		return records
+	}
+
+	tests := []struct {
+		name     string
+		records  []domain.KeypressData
+		interval time.Duration
+		loc      *time.Location
+		want     []TypingRhythmStats
+	}{
+		{
+			name:     "no keypresses",
+			interval: time.Minute,
+			loc:      time.UTC,
+			want:     []TypingRhythmStats{},
+		},
+		{
+			name:     "single keypress has no gap",
+			records:  keypresses("", 0),
+			interval: time.Minute,
+			loc:      time.UTC,
+			want:     []TypingRhythmStats{},
+		},
+		{
+			name:     "median and p90",
+			records:  keypresses("", 0, 100, 300, 600, 1000, 1500, 2100, 2800, 3600, 4500, 5500),
+			interval: 24 * time.Hour,
+			loc:      time.UTC,
+			want: []TypingRhythmStats{
+				{Timestamp: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), MedianGapMs: 500, P90GapMs: 900},
+			},
+		},
+		{
+			name:     "idle gaps are left out",
+			records:  keypresses("", 0, 100, 5100, 5300),
+			interval: 24 * time.Hour,
+			loc:      time.UTC,
+			want: []TypingRhythmStats{
+				{Timestamp: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), MedianGapMs: 100, P90GapMs: 200},
+			},
+		},
+		{
+			name:     "gap belongs to the interval it ends in",
+			records:  keypresses("", 0, 400, 1000),
+			interval: time.Minute,
+			loc:      time.UTC,
+			want: []TypingRhythmStats{
+				{Timestamp: time.Date(2024, 6, 1, 21, 59, 0, 0, time.UTC), MedianGapMs: 400, P90GapMs: 400},
+				{Timestamp: time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC), MedianGapMs: 600, P90GapMs: 600},
+			},
+		},
+		{
+			name:     "days start at midnight in loc",
+			records:  keypresses("", 0, 400, 1000),
+			interval: 24 * time.Hour,
+			loc:      berlin,
+			want: []TypingRhythmStats{
+				{Timestamp: time.Date(2024, 6, 1, 0, 0, 0, 0, berlin), MedianGapMs: 400, P90GapMs: 400},
+				{Timestamp: time.Date(2024, 6, 2, 0, 0, 0, 0, berlin), MedianGapMs: 600, P90GapMs: 600},
+			},
+		},
+		{
+			name:     "hosts typing at once have separate gaps",
+			records:  oldestFirst(append(keypresses("laptop", 0, 300), keypresses("desktop", 100, 200)...)),
+			interval: time.Hour,
+			loc:      time.UTC,
+			want: []TypingRhythmStats{
+				{Timestamp: time.Date(2024, 6, 1, 21, 0, 0, 0, time.UTC), MedianGapMs: 100, P90GapMs: 300},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TypingRhythm(tt.records, tt.interval, DefaultIdleGap, tt.loc)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d intervals %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if !got[i].Timestamp.Equal(tt.want[i].Timestamp) || got[i].MedianGapMs != tt.want[i].MedianGapMs || got[i].P90GapMs != tt.want[i].P90GapMs {
+					t.Errorf("interval %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// oldestFirst sorts records the way the stores return them
+func oldestFirst(records []domain.KeypressData) []domain.KeypressData {
+	slices.SortStableFunc(records, func(a, b domain.KeypressData) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return records
+}
@@ -0,0 +1,87 @@
+package analysis
+
+import (
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+// StreakThresholds is the activity a day needs to count towards a streak.
+// Reaching either one is enough.
+type StreakThresholds struct {
+	Keypresses  int64
+	FileChanges int64
+}
+
+// Streaks are the current and longest runs of consecutive active days
+type Streaks struct {
+	Current int
+	Longest int
+}
+
+// ActiveDays returns midnight in loc of every day whose keypresses or file
+// changes reach min. A day without any activity is never active, even with
+// zero thresholds.
+func ActiveDays(keypresses []domain.KeypressDailyStats, fileChanges []domain.FileChangeDailyStats, min StreakThresholds, loc *time.Location) map[time.Time]bool {
+	keys := make(map[time.Time]int64)
+	for _, stats := range keypresses {
+		keys[localDay(stats.Timestamp, loc)] += stats.KeypressesCount
+	}
+
+	// File changes have a row per language
+	changes := make(map[time.Time]int64)
+	for _, stats := range fileChanges {
+		changes[localDay(stats.Timestamp, loc)] += stats.ChangesInDay
+	}
+
+	active := make(map[time.Time]bool)
+	for day, count := range keys {
+		if count > 0 && count >= min.Keypresses {
+			active[day] = true
+		}
+	}
+	for day, count := range changes {
+		if count > 0 && count >= min.FileChanges {
+			active[day] = true
+		}
+	}
+
+	return active
+}
+
+// CodingStreaks counts the runs of consecutive days in active, which must be
+// in today's location. The current streak ends today, or yesterday if today
+// has no activity yet, since the day isn't over.
+func CodingStreaks(active map[time.Time]bool, today time.Time) Streaks {
+	var streaks Streaks
+
+	day := localDay(today, today.Location())
+	if !active[day] {
+		day = day.AddDate(0, 0, -1)
+	}
+	for active[day] {
+		streaks.Current++
+		day = day.AddDate(0, 0, -1)
+	}
+
+	// Only days starting a run are followed, so each day is visited once
+	for start := range active {
+		if active[start.AddDate(0, 0, -1)] {
+			continue
+		}
+
+		length := 0
+		for day := start; active[day]; day = day.AddDate(0, 0, 1) {
+			length++
+		}
+		streaks.Longest = max(streaks.Longest, length)
+	}
+
+	return streaks
+}
+
+// localDay returns midnight in loc of the day containing t
+func localDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,73 @@
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Summary describes the distribution of a set of counts
+type Summary struct {
+	Min    int64
+	Max    int64
+	Mean   int64
+	Median int64
+	P90    int64
+}
+
+// Summarize returns the distribution of values, the zero Summary if there
+// are none. The mean is rounded to the nearest integer, the median and P90
+// are nearest-rank like TypingRhythm's.
+func Summarize(values []int64) Summary {
+	if len(values) == 0 {
+		return Summary{}
+	}
+
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	var sum int64
+	for _, v := range sorted {
+		sum += v
+	}
+	n := int64(len(sorted))
+
+	return Summary{
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Mean:   (2*sum + n) / (2 * n),
+		Median: percentile(sorted, 0.5),
+		P90:    percentile(sorted, 0.9),
+	}
+}
+
+// FieldValues returns the integer field called name of every record, e.g.
+// FieldValues(stats, "KeypressesCount"), so any count column can be
+// summarized. It fails if T is not a struct or the field doesn't exist or
+// isn't an integer.
+func FieldValues[T any](records []T, name string) ([]int64, error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot read field %s of %s, it is not a struct", name, t)
+	}
+	field, ok := t.FieldByName(name)
+	if !ok {
+		return nil, fmt.Errorf("%s has no field %s", t, name)
+	}
+
+	var value func(reflect.Value) int64
+	switch field.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value = reflect.Value.Int
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		value = func(v reflect.Value) int64 { return int64(v.Uint()) }
+	default:
+		return nil, fmt.Errorf("field %s of %s is a %s, not an integer", name, t, field.Type)
+	}
+
+	values := make([]int64, len(records))
+	for i := range records {
+		values[i] = value(reflect.ValueOf(&records[i]).Elem().FieldByIndex(field.Index))
+	}
+	return values, nil
+}
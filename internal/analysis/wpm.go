@@ -0,0 +1,105 @@
+package analysis
+
+import (
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+// charsPerWord is the conventional word length used for typing speed
+const charsPerWord = 5
+
+// wpmWindow is the length of the rolling window keypresses are counted in
+const wpmWindow = time.Minute
+
+// WPMSample is the typing speed over the window ending at End
+type WPMSample struct {
+	End time.Time
+	WPM float64
+}
+
+// DailyWPM summarizes the typing speed of one day
+type DailyWPM struct {
+	Day     time.Time
+	Peak    float64
+	Average float64
+}
+
+// WPM estimates words per minute from raw keypresses, which must be oldest
+// first as the stores return them. Keypresses are counted in a rolling one
+// minute window, with one sample for the window ending at each counted
+// keypress. Only letters and digits count, so modifiers, arrows and
+// shortcuts don't inflate the result. Sampled keypresses count as their
+// Weight. Without any counted keypress there are no samples, rather than
+// samples of zero.
+func WPM(records []domain.KeypressData) []WPMSample {
+	var words []domain.KeypressData
+	for _, record := range records {
+		if isWordKey(record.Key) {
+			words = append(words, record)
+		}
+	}
+
+	samples := make([]WPMSample, 0, len(words))
+	var count float64
+	first := 0
+	for _, record := range words {
+		count += record.Weight()
+		// Drop the keypresses that fell out of the window ending here
+		for !words[first].Timestamp.After(record.Timestamp.Add(-wpmWindow)) {
+			count -= words[first].Weight()
+			first++
+		}
+
+		samples = append(samples, WPMSample{
+			End: record.Timestamp,
+			WPM: count / charsPerWord / wpmWindow.Minutes(),
+		})
+	}
+
+	return samples
+}
+
+// Daily groups samples by calendar day in loc and returns the peak and the
+// average over the day's samples, so the average is the speed the day's
+// keypresses were typed at
+func Daily(samples []WPMSample, loc *time.Location) []DailyWPM {
+	var days []DailyWPM
+	var daySamples int
+
+	for _, sample := range samples {
+		t := sample.End.In(loc)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+		// Samples are sorted, so a new day starts a new summary
+		if n := len(days); n == 0 || !days[n-1].Day.Equal(day) {
+			if n > 0 {
+				days[n-1].Average /= float64(daySamples)
+			}
+			days = append(days, DailyWPM{Day: day})
+			daySamples = 0
+		}
+
+		current := &days[len(days)-1]
+		current.Peak = max(current.Peak, sample.WPM)
+		current.Average += sample.WPM
+		daySamples++
+	}
+
+	if n := len(days); n > 0 {
+		days[n-1].Average /= float64(daySamples)
+	}
+
+	return days
+}
+
+// isWordKey reports whether key is a single letter or digit
+func isWordKey(key string) bool {
+	r, size := utf8.DecodeRuneInString(key)
+	if size == 0 || size != len(key) {
+		return false
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,83 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+func TestWPMWeightsSampledKeypresses(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var records []domain.KeypressData
+	// 50 letters sampled at a fifth stand for 250, 50 words
+	for i := 0; i < 50; i++ {
+		records = append(records, domain.KeypressData{Key: "a", Timestamp: start.Add(time.Duration(i) * time.Second), SampleRate: 0.2})
+	}
+	// Shortcuts don't count however they were sampled
+	records = append(records, domain.KeypressData{Key: "cmd+s", Timestamp: start.Add(50 * time.Second), SampleRate: 0.2})
+
+	samples := WPM(records)
+	if len(samples) != 50 {
+		t.Fatalf("got %d samples, want 50", len(samples))
+	}
+	if last := samples[len(samples)-1]; math.Abs(last.WPM-50) > 1e-9 {
+		t.Errorf("last sample: WPM = %f, want 50", last.WPM)
+	}
+}
+
+func TestWPMRollingWindow(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds ...int) []domain.KeypressData {
+		records := make([]domain.KeypressData, len(seconds))
+		for i, s := range seconds {
+			records[i] = domain.KeypressData{Key: "a", Timestamp: start.Add(time.Duration(s) * time.Second)}
+		}
+		return records
+	}
+
+	tests := []struct {
+		name    string
+		records []domain.KeypressData
+		want    []float64
+	}{
+		{
+			name: "no keypresses",
+		},
+		{
+			name:    "keypresses within a minute add up",
+			records: at(0, 10, 20, 30, 40),
+			want:    []float64{0.2, 0.4, 0.6, 0.8, 1},
+		},
+		{
+			// A fixed window starting at 12:00 would split these
+			name:    "burst across a minute boundary",
+			records: at(50, 55, 60, 65, 70),
+			want:    []float64{0.2, 0.4, 0.6, 0.8, 1},
+		},
+		{
+			name:    "keypresses leave the window a minute later",
+			records: at(0, 30, 60, 61, 200),
+			want:    []float64{0.2, 0.4, 0.4, 0.6, 0.2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := WPM(tt.records)
+			if len(samples) != len(tt.want) {
+				t.Fatalf("got %d samples, want %d", len(samples), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !samples[i].End.Equal(tt.records[i].Timestamp) {
+					t.Errorf("sample %d ends at %v, want %v", i, samples[i].End, tt.records[i].Timestamp)
+				}
+				if math.Abs(samples[i].WPM-want) > 1e-9 {
+					t.Errorf("sample %d: WPM = %f, want %f", i, samples[i].WPM, want)
+				}
+			}
+		})
+	}
+}
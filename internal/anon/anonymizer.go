@@ -1,38 +1,72 @@
 package anon
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/nilszeilon/devstats/internal/storage"
 )
 
-// Anonymizable defines the interface that source types must implement
-type Anonymizable[T any] interface {
+// Anonymizable defines the interface that source types S must implement to
+// be anonymized into T
+type Anonymizable[S, T any] interface {
 	GetTimestamp() time.Time
-	Anonymize([]any, time.Time) ([]T, error)
+	Anonymize([]S, time.Time) ([]T, error)
 }
 
+// Accumulable can be implemented by source types whose anonymization is a
+// running total. Accumulate adds the record to the stats of the interval
+// starting at intervalStart and returns them, so an interval can be
+// anonymized without holding all of its records.
+type Accumulable[T any] interface {
+	Accumulate(stats []T, intervalStart time.Time) []T
+}
+
+// ErrInvalidInterval is returned for a Config whose IntervalSize isn't positive
+var ErrInvalidInterval = errors.New("interval size must be greater than 0")
+
+// ErrNoExportName is returned for a Config with an ExportDir but no ExportName
+var ErrNoExportName = errors.New("export name must be set to export into a directory")
+
 // Config holds the configuration for the anonymizer service
 type Config struct {
 	IntervalSize time.Duration
+	// PurgeSourceAfterProcess deletes the raw records of an interval once
+	// its anonymized records have been saved
+	PurgeSourceAfterProcess bool
+	// Location is the time zone whose midnight intervals are aligned to.
+	// Defaults to time.Local.
+	Location *time.Location
+	// ExportDir additionally writes each day's anonymized records to a JSON
+	// file in this directory, named by ExportFileName. Empty disables it.
+	ExportDir string
+	// ExportName is the data type the export files are named after, e.g.
+	// "keypresses"
+	ExportName string
 }
 
 // Service handles the anonymization process
-type Service[S Anonymizable[T], T any] struct {
+type Service[S Anonymizable[S, T], T any] struct {
 	sourceStore storage.Store[S]
 	targetStore storage.Store[T]
 	config      Config
 }
 
 // NewService creates a new anonymizer service
-func NewService[S Anonymizable[T], T any](
+func NewService[S Anonymizable[S, T], T any](
 	sourceStore storage.Store[S],
 	targetStore storage.Store[T],
 	config Config,
 ) (*Service[S, T], error) {
-	if config.IntervalSize == 0 {
-		return nil, fmt.Errorf("interval size must be greater than 0")
+	if config.IntervalSize <= 0 {
+		return nil, ErrInvalidInterval
+	}
+	if config.ExportDir != "" && config.ExportName == "" {
+		return nil, ErrNoExportName
+	}
+	if config.Location == nil {
+		config.Location = time.Local
 	}
 
 	return &Service[S, T]{
@@ -42,10 +76,21 @@ func NewService[S Anonymizable[T], T any](
 	}, nil
 }
 
-// ProcessInterval processes and anonymizes data for a specific time interval
+// ProcessInterval anonymizes the records between start and end. Records
+// are grouped into the buckets of IntervalSize they fall in, aligned like
+// IntervalStart, and each bucket is read from its own start rather than
+// from start. A pass over part of a bucket, like the one on shutdown, and a
+// later pass over all of it thus produce the same canonical aggregates,
+// the later replacing the earlier.
 func (s *Service[S, T]) ProcessInterval(start, end time.Time) error {
+	return s.eachBucket(start, end, s.processBucket)
+}
+
+// processBucket anonymizes the records of the bucket starting at
+// bucketStart, up to end
+func (s *Service[S, T]) processBucket(bucketStart, end time.Time) error {
 	// Fetch records from source store
-	records, err := s.sourceStore.FindBetween(start, end)
+	records, err := s.sourceStore.FindBetweenTyped(bucketStart, end)
 	if err != nil {
 		return fmt.Errorf("failed to fetch records: %w", err)
 	}
@@ -54,24 +99,148 @@ func (s *Service[S, T]) ProcessInterval(start, end time.Time) error {
 		return nil
 	}
 
-	// Get a sample record to use for anonymization
-	sample, ok := records[0].(S)
-	if !ok {
-		return fmt.Errorf("failed to cast record to source type")
-	}
-
 	// Anonymize the records
-	anonymizedRecords, err := sample.Anonymize(records, start)
+	anonymizedRecords, err := records[0].Anonymize(records, bucketStart)
 	if err != nil {
 		return fmt.Errorf("failed to anonymize records: %w", err)
 	}
 
-	// Save each anonymized record
+	return s.replace(bucketStart, end, anonymizedRecords)
+}
+
+// ProcessIntervalStreaming anonymizes the same buckets as ProcessInterval,
+// but reads the records one at a time and folds them into the stats, so
+// memory stays flat however many records a bucket has. Types that don't
+// implement Accumulable are processed with ProcessInterval.
+func (s *Service[S, T]) ProcessIntervalStreaming(start, end time.Time) error {
+	var zero S
+	if _, ok := any(zero).(Accumulable[T]); !ok {
+		return s.ProcessInterval(start, end)
+	}
+
+	return s.eachBucket(start, end, func(bucketStart, end time.Time) error {
+		var anonymizedRecords []T
+		err := storage.ForEachBetween(s.sourceStore, bucketStart, end, func(record S) error {
+			anonymizedRecords = any(record).(Accumulable[T]).Accumulate(anonymizedRecords, bucketStart)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch records: %w", err)
+		}
+
+		if len(anonymizedRecords) == 0 {
+			return nil
+		}
+
+		return s.replace(bucketStart, end, anonymizedRecords)
+	})
+}
+
+// eachBucket calls process with the start of every bucket that overlaps
+// start to end, and the end of the part of it to process: the bucket's
+// last instant, or end for the last bucket. Both ends are inclusive like
+// FindBetween's.
+func (s *Service[S, T]) eachBucket(start, end time.Time, process func(bucketStart, end time.Time) error) error {
+	for bucketStart := s.IntervalStart(start); !bucketStart.After(end); bucketStart = bucketStart.Add(s.config.IntervalSize) {
+		// Stop just short of the next bucket so a record on the boundary
+		// isn't counted twice
+		bucketEnd := bucketStart.Add(s.config.IntervalSize - time.Nanosecond)
+		if bucketEnd.After(end) {
+			bucketEnd = end
+		}
+
+		if err := process(bucketStart, bucketEnd); err != nil {
+			return fmt.Errorf("failed to process interval starting %s: %w", bucketStart.Format(time.RFC3339), err)
+		}
+
+		// Export a day once its last bucket in the range is done rather
+		// than after every bucket, which matters when backfilling
+		next := bucketStart.Add(s.config.IntervalSize)
+		if s.config.ExportDir != "" && (next.After(end) || !sameDay(next, bucketStart, s.config.Location)) {
+			if err := s.exportDay(bucketStart); err != nil {
+				return fmt.Errorf("failed to export anonymized data: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// replace saves the anonymized records of the bucket starting at
+// bucketStart in place of any earlier ones, then purges the source records
+// if configured to. A bucket's source records are only purged once it is
+// complete, a later pass reads them again to replace the partial aggregates.
+func (s *Service[S, T]) replace(bucketStart, end time.Time, anonymizedRecords []T) error {
+	// Replace any aggregates from an earlier run over the same bucket
+	if _, err := s.targetStore.Delete(bucketStart, bucketStart); err != nil {
+		return fmt.Errorf("failed to delete previous anonymized data: %w", err)
+	}
+
+	// Save each anonymized record, upserting so a concurrent run over the
+	// same bucket can't leave duplicates behind
 	for _, record := range anonymizedRecords {
-		if err := s.targetStore.Save(record); err != nil {
+		if err := storage.SaveUnique(s.targetStore, record); err != nil {
 			return fmt.Errorf("failed to save anonymized data: %w", err)
 		}
 	}
 
+	// Only purge once everything is saved so a failure never loses raw data
+	complete := !end.Before(bucketStart.Add(s.config.IntervalSize - time.Nanosecond))
+	if s.config.PurgeSourceAfterProcess && complete {
+		if _, err := s.sourceStore.Delete(bucketStart, end); err != nil {
+			return fmt.Errorf("failed to purge source records: %w", err)
+		}
+	}
+
 	return nil
 }
+
+// IntervalStart returns the start of the interval containing t, see the
+// package level IntervalStart
+func (s *Service[S, T]) IntervalStart(t time.Time) time.Time {
+	return IntervalStart(t, s.config.IntervalSize, s.config.Location)
+}
+
+// IntervalStart returns the start of the interval of the given size
+// containing t. Intervals are counted from midnight in loc, so they line up
+// with calendar days even across a DST change.
+func IntervalStart(t time.Time, size time.Duration, loc *time.Location) time.Time {
+	local := t.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	return midnight.Add(local.Sub(midnight).Truncate(size))
+}
+
+// ProcessRange processes every IntervalSize bucket between start and end,
+// end excluded
+func (s *Service[S, T]) ProcessRange(start, end time.Time) error {
+	return s.ProcessInterval(start, end.Add(-time.Nanosecond))
+}
+
+// Resume returns where anonymizing has to pick up after a break, like the
+// daemon not running: the start of the newest anonymized bucket, which may
+// be partial, or the oldest raw record if nothing was anonymized yet. It is
+// zero if there are no raw records either.
+func (s *Service[S, T]) Resume() (time.Time, error) {
+	latest, err := storage.LatestTimestamp(s.targetStore)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read latest anonymized data: %w", err)
+	}
+	if !latest.IsZero() {
+		return s.IntervalStart(latest), nil
+	}
+
+	// Raw records are saved as they happen, so the first is the oldest
+	oldest, _, err := s.sourceStore.FindAfter(0, 1)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read oldest record: %w", err)
+	}
+	if len(oldest) == 0 {
+		return time.Time{}, nil
+	}
+	return oldest[0].GetTimestamp(), nil
+}
+
+// ProcessSince backfills every interval from t up to now
+func (s *Service[S, T]) ProcessSince(t time.Time) error {
+	return s.ProcessRange(t, time.Now())
+}
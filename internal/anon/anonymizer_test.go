@@ -0,0 +1,158 @@
+package anon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+)
+
+func TestIntervalStartAcrossDSTChange(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		t.Skipf("time zone Europe/Stockholm not available: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		size time.Duration
+		want time.Time
+	}{
+		{
+			name: "hour after the clocks go forward",
+			t:    time.Date(2024, 3, 31, 3, 30, 0, 0, stockholm),
+			size: time.Hour,
+			want: time.Date(2024, 3, 31, 3, 0, 0, 0, stockholm),
+		},
+		{
+			name: "first 02:30 when the clocks go back",
+			t:    time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC),
+			size: time.Hour,
+			want: time.Date(2024, 10, 27, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "second 02:30 when the clocks go back",
+			t:    time.Date(2024, 10, 27, 1, 30, 0, 0, time.UTC),
+			size: time.Hour,
+			want: time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "quarter hour after local midnight, before UTC midnight",
+			t:    time.Date(2024, 10, 26, 22, 20, 0, 0, time.UTC),
+			size: 15 * time.Minute,
+			want: time.Date(2024, 10, 27, 0, 15, 0, 0, stockholm),
+		},
+		{
+			name: "last interval of the 25 hour day",
+			t:    time.Date(2024, 10, 27, 23, 59, 0, 0, stockholm),
+			size: time.Hour,
+			want: time.Date(2024, 10, 27, 23, 0, 0, 0, stockholm),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := IntervalStart(tt.t, tt.size, stockholm)
+			if !got.Equal(tt.want) {
+				t.Errorf("IntervalStart(%s, %s) = %s, want %s", tt.t, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceResume(t *testing.T) {
+	source := storage.NewMemStore[domain.KeypressData]()
+	target := storage.NewMemStore[domain.KeypressAnonymousStats]()
+	service, err := NewService[domain.KeypressData, domain.KeypressAnonymousStats](source, target, Config{
+		IntervalSize: 10 * time.Minute,
+		Location:     time.UTC,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	if resume := mustResume(t, service); !resume.IsZero() {
+		t.Errorf("Resume without records = %s, want zero", resume)
+	}
+
+	first := time.Date(2024, 6, 1, 9, 3, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := source.Save(domain.KeypressData{Key: "a", Timestamp: first.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	// Nothing anonymized yet, so everything is
+	if resume := mustResume(t, service); !resume.Equal(first) {
+		t.Errorf("Resume before anonymizing = %s, want the oldest record at %s", resume, first)
+	}
+
+	// The bucket of the newest stats may be partial, so it is processed again
+	if err := service.ProcessInterval(first, first.Add(time.Hour+5*time.Minute)); err != nil {
+		t.Fatalf("ProcessInterval: %v", err)
+	}
+	want := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	if resume := mustResume(t, service); !resume.Equal(want) {
+		t.Errorf("Resume after anonymizing = %s, want %s", resume, want)
+	}
+}
+
+func mustResume[S Anonymizable[S, T], T any](t *testing.T, service *Service[S, T]) time.Time {
+	t.Helper()
+	resume, err := service.Resume()
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	return resume
+}
+
+// A partial pass, like the one on shutdown, and a later pass over the whole
+// interval must end up in the same bucket, the later replacing the earlier
+func TestProcessIntervalCanonicalBucket(t *testing.T) {
+	source := storage.NewMemStore[domain.KeypressData]()
+	target := storage.NewMemStore[domain.KeypressAnonymousStats]()
+	service, err := NewService[domain.KeypressData, domain.KeypressAnonymousStats](source, target, Config{
+		IntervalSize: 10 * time.Minute,
+		Location:     time.UTC,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	bucket := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	save := func(minutes ...int) {
+		for _, m := range minutes {
+			if err := source.Save(domain.KeypressData{Key: "a", Timestamp: bucket.Add(time.Duration(m) * time.Minute)}); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+		}
+	}
+
+	now := bucket.Add(8 * time.Minute)
+	save(1, 5, 7)
+	if err := service.ProcessInterval(now.Add(-3*time.Minute), now); err != nil {
+		t.Fatalf("ProcessInterval: %v", err)
+	}
+
+	now = bucket.Add(9 * time.Minute)
+	save(9)
+	if err := service.ProcessInterval(now.Add(-10*time.Minute), now); err != nil {
+		t.Fatalf("ProcessInterval: %v", err)
+	}
+
+	stats, err := target.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("got %d buckets, want 1: %+v", len(stats), stats)
+	}
+	if !stats[0].Timestamp.Equal(bucket) {
+		t.Errorf("bucket starts at %s, want %s", stats[0].Timestamp, bucket)
+	}
+	if stats[0].KeypressesCount != 4 {
+		t.Errorf("bucket counts %d keypresses, want 4", stats[0].KeypressesCount)
+	}
+}
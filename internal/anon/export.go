@@ -0,0 +1,70 @@
+package anon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ExportFileName returns the name of the file the anonymized records of
+// name on day are exported to, e.g. keypresses-2024-06-01.json
+func ExportFileName(name string, day time.Time) string {
+	return fmt.Sprintf("%s-%s.json", name, day.Format("2006-01-02"))
+}
+
+// sameDay reports whether a and b fall on the same calendar day in loc
+func sameDay(a, b time.Time, loc *time.Location) bool {
+	ay, am, ad := a.In(loc).Date()
+	by, bm, bd := b.In(loc).Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// exportDay writes every anonymized record of the day containing t to its
+// file in ExportDir as a JSON array, replacing the file of an earlier pass.
+// Days without records get no file.
+func (s *Service[S, T]) exportDay(t time.Time) error {
+	local := t.In(s.config.Location)
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.config.Location)
+	dayEnd := dayStart.AddDate(0, 0, 1).Add(-time.Nanosecond)
+
+	records, err := s.targetStore.FindBetweenTyped(dayStart, dayEnd)
+	if err != nil {
+		return fmt.Errorf("failed to read anonymized data: %w", err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode anonymized data: %w", err)
+	}
+
+	if err := os.MkdirAll(s.config.ExportDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	// Write next to the file and rename it into place, so a reader never
+	// sees a half written day
+	path := filepath.Join(s.config.ExportDir, ExportFileName(s.config.ExportName, dayStart))
+	tmp, err := os.CreateTemp(s.config.ExportDir, ".export-*")
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+
+	return nil
+}
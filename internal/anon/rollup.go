@@ -0,0 +1,89 @@
+package anon
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/storage"
+)
+
+// Rollupable defines the interface that anonymous stats types must implement
+// to be summarized into coarser daily rows
+type Rollupable[S, D any] interface {
+	Rollup([]S, time.Time) ([]D, error)
+}
+
+// RollupConfig holds the configuration for the rollup service
+type RollupConfig struct {
+	// PruneAfter deletes the fine-grained rows of a day once it has been
+	// rolled up and is older than this. Zero keeps them forever.
+	PruneAfter time.Duration
+	// Location is the time zone whose calendar days are rolled up.
+	// Defaults to time.Local.
+	Location *time.Location
+}
+
+// RollupService summarizes interval stats into one row per day
+type RollupService[S Rollupable[S, D], D any] struct {
+	sourceStore storage.Store[S]
+	targetStore storage.Store[D]
+	config      RollupConfig
+}
+
+// NewRollupService creates a new rollup service
+func NewRollupService[S Rollupable[S, D], D any](
+	sourceStore storage.Store[S],
+	targetStore storage.Store[D],
+	config RollupConfig,
+) *RollupService[S, D] {
+	if config.Location == nil {
+		config.Location = time.Local
+	}
+
+	return &RollupService[S, D]{
+		sourceStore: sourceStore,
+		targetStore: targetStore,
+		config:      config,
+	}
+}
+
+// ProcessDay rolls up the calendar day containing day, in the configured
+// location. Re-processing a day replaces its previous summary.
+func (r *RollupService[S, D]) ProcessDay(day time.Time) error {
+	day = day.In(r.config.Location)
+	dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	dayEnd := dayStart.AddDate(0, 0, 1).Add(-time.Nanosecond)
+
+	records, err := r.sourceStore.FindBetweenTyped(dayStart, dayEnd)
+	if err != nil {
+		return fmt.Errorf("failed to fetch records: %w", err)
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	summaries, err := records[0].Rollup(records, dayStart)
+	if err != nil {
+		return fmt.Errorf("failed to roll up records: %w", err)
+	}
+
+	if _, err := r.targetStore.Delete(dayStart, dayStart); err != nil {
+		return fmt.Errorf("failed to delete previous summary: %w", err)
+	}
+
+	for _, summary := range summaries {
+		if err := storage.SaveUnique(r.targetStore, summary); err != nil {
+			return fmt.Errorf("failed to save summary: %w", err)
+		}
+	}
+
+	// Only prune days that are summarized and old enough
+	if r.config.PruneAfter > 0 && dayEnd.Before(time.Now().Add(-r.config.PruneAfter)) {
+		if _, err := r.sourceStore.Delete(dayStart, dayEnd); err != nil {
+			return fmt.Errorf("failed to prune rolled up records: %w", err)
+		}
+	}
+
+	return nil
+}
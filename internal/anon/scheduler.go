@@ -0,0 +1,113 @@
+package anon
+
+import (
+	"log"
+	"time"
+)
+
+// Job is an anonymization pass that runs on its own cadence
+type Job struct {
+	// Name identifies the job in log messages
+	Name     string
+	Interval time.Duration
+	// Process anonymizes everything recorded between start and end
+	Process func(start, end time.Time) error
+	// Resume returns where the job left off, e.g. Service.Resume, so Start
+	// backfills the time the daemon wasn't running. Nil, or a zero time,
+	// starts one Interval before now.
+	Resume func() (time.Time, error)
+}
+
+// Scheduler runs each of its jobs once per the job's Interval, so busy data
+// like keypresses can be anonymized more often than coarse data like file
+// changes. It is not safe for concurrent use.
+type Scheduler struct {
+	jobs          []Job
+	lastProcessed []time.Time
+}
+
+// NewScheduler creates a scheduler for jobs. Nothing runs until Start.
+func NewScheduler(jobs ...Job) *Scheduler {
+	return &Scheduler{
+		jobs:          jobs,
+		lastProcessed: make([]time.Time, len(jobs)),
+	}
+}
+
+// Start runs every job from where it left off, or over the interval before
+// now, then schedules each job's next run one Interval after now
+func (s *Scheduler) Start(now time.Time) {
+	for i, job := range s.jobs {
+		start := now.Add(-job.Interval)
+		if job.Resume != nil {
+			resume, err := job.Resume()
+			if err != nil {
+				log.Printf("Error finding where %s processing left off: %v", job.Name, err)
+			} else if !resume.IsZero() && resume.Before(start) {
+				start = resume
+			}
+		}
+		s.run(i, start, now)
+	}
+}
+
+// Next returns when the earliest job is due
+func (s *Scheduler) Next() time.Time {
+	var next time.Time
+	for i, job := range s.jobs {
+		due := s.lastProcessed[i].Add(job.Interval)
+		if next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+	return next
+}
+
+// RunDue runs every job whose Interval has passed by now, over the time since
+// its last run, and reports whether any job ran. After a gap, like the
+// machine sleeping, the whole gap is caught up on.
+func (s *Scheduler) RunDue(now time.Time) bool {
+	ran := false
+	for i, job := range s.jobs {
+		if now.Before(s.lastProcessed[i].Add(job.Interval)) {
+			continue
+		}
+		s.run(i, s.lastProcessed[i], now)
+		ran = true
+	}
+	return ran
+}
+
+// RunAll runs every job over the time since its last run whether it is due
+// or not, e.g. to flush partial intervals on shutdown
+func (s *Scheduler) RunAll(now time.Time) {
+	for i := range s.jobs {
+		s.run(i, s.lastProcessed[i], now)
+	}
+}
+
+// run processes job i between start and end. A range longer than the job's
+// Interval is caught up on one Interval at a time, so a backfill never reads
+// more raw records at once than a regular run. A failed step is logged and
+// still counts as run, the next one covers only the time after it.
+func (s *Scheduler) run(i int, start, end time.Time) {
+	job := s.jobs[i]
+	if end.Sub(start) > 2*job.Interval {
+		log.Printf("Catching up on %s data since %s", job.Name, start.Format(time.RFC3339))
+	}
+
+	for from := start; ; {
+		to := from.Add(job.Interval)
+		if job.Interval <= 0 || !to.Before(end) {
+			to = end
+		}
+		if err := job.Process(from, to); err != nil {
+			log.Printf("Error processing %s interval: %v", job.Name, err)
+		}
+		if !to.Before(end) {
+			break
+		}
+		from = to
+	}
+	s.lastProcessed[i] = end
+}
@@ -0,0 +1,102 @@
+package anon
+
+import (
+	"testing"
+	"time"
+)
+
+type processedRange struct {
+	start, end time.Time
+}
+
+// recordingJob returns a job that records the ranges it processes
+func recordingJob(interval time.Duration, resume func() (time.Time, error)) (Job, *[]processedRange) {
+	var ranges []processedRange
+	return Job{
+		Name:     "test",
+		Interval: interval,
+		Process: func(start, end time.Time) error {
+			ranges = append(ranges, processedRange{start, end})
+			return nil
+		},
+		Resume: resume,
+	}, &ranges
+}
+
+// checkCovered fails unless ranges are contiguous from start to end and
+// none is longer than interval
+func checkCovered(t *testing.T, ranges []processedRange, start, end time.Time, interval time.Duration) {
+	t.Helper()
+	if len(ranges) == 0 {
+		t.Fatal("nothing was processed")
+	}
+	if !ranges[0].start.Equal(start) {
+		t.Errorf("processing started at %s, want %s", ranges[0].start, start)
+	}
+	for i, r := range ranges {
+		if r.end.Sub(r.start) > interval {
+			t.Errorf("range %d is %s long, longer than the interval", i, r.end.Sub(r.start))
+		}
+		if i > 0 && !r.start.Equal(ranges[i-1].end) {
+			t.Errorf("range %d starts at %s, the previous ended at %s", i, r.start, ranges[i-1].end)
+		}
+	}
+	if last := ranges[len(ranges)-1].end; !last.Equal(end) {
+		t.Errorf("processing ended at %s, want %s", last, end)
+	}
+}
+
+func TestSchedulerStartResumes(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	resume := now.Add(-3*time.Hour - 20*time.Minute)
+
+	job, ranges := recordingJob(time.Hour, func() (time.Time, error) {
+		return resume, nil
+	})
+	NewScheduler(job).Start(now)
+
+	checkCovered(t, *ranges, resume, now, time.Hour)
+	if len(*ranges) != 4 {
+		t.Errorf("processed %d ranges, want 4", len(*ranges))
+	}
+}
+
+func TestSchedulerStartWithoutResume(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, resume := range map[string]func() (time.Time, error){
+		"no resume":      nil,
+		"nothing stored": func() (time.Time, error) { return time.Time{}, nil },
+		"recent":         func() (time.Time, error) { return now.Add(-time.Minute), nil },
+	} {
+		t.Run(name, func(t *testing.T) {
+			job, ranges := recordingJob(10*time.Minute, resume)
+			NewScheduler(job).Start(now)
+
+			checkCovered(t, *ranges, now.Add(-10*time.Minute), now, 10*time.Minute)
+		})
+	}
+}
+
+func TestSchedulerRunDueCatchesUpOnGap(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	job, ranges := recordingJob(10*time.Minute, nil)
+	scheduler := NewScheduler(job)
+	scheduler.Start(start)
+
+	if scheduler.RunDue(start.Add(5 * time.Minute)) {
+		t.Error("RunDue ran a job before its interval passed")
+	}
+
+	// The machine slept for most of an hour
+	*ranges = nil
+	wake := start.Add(55 * time.Minute)
+	if !scheduler.RunDue(wake) {
+		t.Fatal("RunDue didn't run the overdue job")
+	}
+	checkCovered(t, *ranges, start, wake, 10*time.Minute)
+
+	if next := scheduler.Next(); !next.Equal(wake.Add(10 * time.Minute)) {
+		t.Errorf("next run at %s, want %s", next, wake.Add(10*time.Minute))
+	}
+}
@@ -0,0 +1,109 @@
+package anon
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+)
+
+// defaultIdleGap is the pause in typing that ends a session
+const defaultIdleGap = 5 * time.Minute
+
+// SessionConfig holds the configuration for the session service
+type SessionConfig struct {
+	// IdleGap is the longest pause between keypresses within one session.
+	// Zero uses the default of 5 minutes.
+	IdleGap time.Duration
+}
+
+// SessionService turns raw keypresses into coding sessions. Unlike Service it
+// is not bound to fixed intervals, a session may continue across them.
+type SessionService struct {
+	sourceStore storage.Store[domain.KeypressData]
+	targetStore storage.Store[domain.SessionData]
+	config      SessionConfig
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(
+	sourceStore storage.Store[domain.KeypressData],
+	targetStore storage.Store[domain.SessionData],
+	config SessionConfig,
+) *SessionService {
+	if config.IdleGap <= 0 {
+		config.IdleGap = defaultIdleGap
+	}
+
+	return &SessionService{
+		sourceStore: sourceStore,
+		targetStore: targetStore,
+		config:      config,
+	}
+}
+
+// ProcessInterval records the sessions of the keypresses between start and
+// end. A session that ended within the idle gap before start is reopened and
+// extended, so the raw keypresses must be kept at least that long.
+func (s *SessionService) ProcessInterval(start, end time.Time) error {
+	// Sessions are stored by end time, so this finds any that may continue
+	openFrom := start.Add(-s.config.IdleGap)
+	open, err := s.targetStore.FindBetweenTyped(openFrom, end)
+	if err != nil {
+		return fmt.Errorf("failed to fetch open sessions: %w", err)
+	}
+
+	from := start
+	for _, session := range open {
+		if session.Start.Before(from) {
+			from = session.Start
+		}
+	}
+
+	records, err := s.sourceStore.FindBetweenTyped(from, end)
+	if err != nil {
+		return fmt.Errorf("failed to fetch records: %w", err)
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	sessions := domain.BuildSessions(records, s.config.IdleGap)
+
+	// Replace the reopened sessions with the rebuilt ones
+	if _, err := s.targetStore.Delete(openFrom, end); err != nil {
+		return fmt.Errorf("failed to delete open sessions: %w", err)
+	}
+
+	if err := s.targetStore.SaveBatch(sessions); err != nil {
+		return fmt.Errorf("failed to save sessions: %w", err)
+	}
+
+	return nil
+}
+
+// Resume returns where grouping keypresses into sessions has to pick up
+// after a break: the end of the newest session, which ProcessInterval
+// reopens, or the oldest keypress if there are no sessions yet. It is zero
+// if there are no keypresses either.
+func (s *SessionService) Resume() (time.Time, error) {
+	latest, err := storage.LatestTimestamp(s.targetStore)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read latest session: %w", err)
+	}
+	if !latest.IsZero() {
+		return latest, nil
+	}
+
+	// Keypresses are saved as they happen, so the first is the oldest
+	oldest, _, err := s.sourceStore.FindAfter(0, 1)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read oldest keypress: %w", err)
+	}
+	if len(oldest) == 0 {
+		return time.Time{}, nil
+	}
+	return oldest[0].Timestamp, nil
+}
@@ -0,0 +1,97 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+// maxLineLength is the longest content line RFC 5545 allows, in octets
+// without the line break. Longer lines are folded.
+const maxLineLength = 75
+
+// utcFormat is a DATE-TIME in UTC, which every calendar app shows in its
+// own time zone without needing a VTIMEZONE definition
+const utcFormat = "20060102T150405Z"
+
+// WriteICS writes sessions to w as an iCalendar (RFC 5545) file with one
+// "Coding" event each, for importing into a calendar app. now is the
+// DTSTAMP of the events.
+func WriteICS(w io.Writer, sessions []domain.SessionData, now time.Time) error {
+	bw := bufio.NewWriter(w)
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:-//devstats//coding sessions//EN")
+	writeLine(bw, "CALSCALE:GREGORIAN")
+
+	stamp := now.UTC().Format(utcFormat)
+	for _, session := range sessions {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+eventUID(session))
+		writeLine(bw, "DTSTAMP:"+stamp)
+		writeLine(bw, "DTSTART:"+session.Start.UTC().Format(utcFormat))
+		writeLine(bw, "DTEND:"+session.End.UTC().Format(utcFormat))
+		writeLine(bw, "SUMMARY:Coding")
+
+		description := fmt.Sprintf("%d keypresses in %s", session.Keypresses, formatDuration(session.Duration()))
+		if session.Host != "" {
+			description += " on " + session.Host
+		}
+		writeLine(bw, "DESCRIPTION:"+escapeText(description))
+		writeLine(bw, "END:VEVENT")
+	}
+
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+// eventUID identifies a session across exports, so importing an overlapping
+// range again updates its events instead of duplicating them. A session is
+// identified by its host and start, its end moves while it is open.
+func eventUID(session domain.SessionData) string {
+	host := session.Host
+	if host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s-%s@devstats", session.Start.UTC().Format(utcFormat), escapeText(host))
+}
+
+// formatDuration formats d in whole minutes, e.g. 1h05m or 25m
+func formatDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
+
+// escapeText escapes the characters RFC 5545 reserves in TEXT values
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// writeLine writes a content line ending in CRLF, folding it after every
+// maxLineLength octets by continuing on a line starting with a space.
+// Folds never split a UTF-8 character. Write errors are reported by Flush.
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		// Back up to the start of the character at the cut
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the continuation line's length
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"log"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+)
+
+// appFocusPollInterval is how often the frontmost application is checked
+const appFocusPollInterval = 5 * time.Second
+
+// AppFocusCollector records which application has focus. The focus is
+// only known on macOS.
+type AppFocusCollector struct {
+	store    storage.Store[domain.AppFocusData]
+	stopChan chan struct{}
+	lastApp  string
+}
+
+// NewAppFocusCollector creates a new app focus collector
+func NewAppFocusCollector(store storage.Store[domain.AppFocusData]) *AppFocusCollector {
+	return &AppFocusCollector{
+		store:    store,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins polling the frontmost application
+func (ac *AppFocusCollector) Start() error {
+	go func() {
+		ticker := time.NewTicker(appFocusPollInterval)
+		defer ticker.Stop()
+
+		ac.poll()
+		for {
+			select {
+			case <-ac.stopChan:
+				return
+			case <-ticker.C:
+				ac.poll()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// poll records the frontmost application if it changed since the last poll
+func (ac *AppFocusCollector) poll() {
+	app := frontmostApp()
+	if app == "" || app == ac.lastApp {
+		return
+	}
+	ac.lastApp = app
+
+	data := domain.AppFocusData{
+		AppName:   app,
+		Host:      hostname,
+		Timestamp: time.Now(),
+	}
+
+	if err := ac.store.Save(data); err != nil {
+		log.Printf("Error saving app focus: %v", err)
+	}
+}
+
+// Stop stops polling the frontmost application
+func (ac *AppFocusCollector) Stop() {
+	close(ac.stopChan)
+}
@@ -0,0 +1,30 @@
+package collector
+
+import "unsafe"
+
+// #cgo CFLAGS: -x objective-c
+// #cgo LDFLAGS: -framework Cocoa
+// #import <Cocoa/Cocoa.h>
+// #include <stdlib.h>
+// #include <string.h>
+//
+// static char* frontmostAppName() {
+//     @autoreleasepool {
+//         NSRunningApplication *app = [[NSWorkspace sharedWorkspace] frontmostApplication];
+//         if (app == nil || app.localizedName == nil) {
+//             return NULL;
+//         }
+//         return strdup([app.localizedName UTF8String]);
+//     }
+// }
+import "C"
+
+// frontmostApp returns the name of the focused application, or "" if unknown
+func frontmostApp() string {
+	name := C.frontmostAppName()
+	if name == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(name))
+	return C.GoString(name)
+}
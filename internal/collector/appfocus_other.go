@@ -0,0 +1,9 @@
+//go:build !darwin
+
+package collector
+
+// frontmostApp returns "", the focused application isn't known on this
+// platform yet, so nothing is recorded
+func frontmostApp() string {
+	return ""
+}
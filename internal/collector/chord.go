@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+// modifierKeys are the names of keys that only modify others. Hooks that
+// report them as keypresses of their own would otherwise break up chords.
+var modifierKeys = []string{
+	"shift", "right_shift", "command", "control", "right_control",
+	"option", "right_option", "fn", "capslock",
+}
+
+// chordDetector recognizes chords like "cmd+k cmd+s": one of the leader
+// shortcuts followed by another key within timeout. It is not safe for
+// concurrent use.
+type chordDetector struct {
+	leaders map[string]bool
+	timeout time.Duration
+	// pending is the leader waiting for its second key, zero if none
+	pending domain.KeypressData
+}
+
+func newChordDetector(leaders []string, timeout time.Duration) *chordDetector {
+	d := &chordDetector{
+		leaders: make(map[string]bool, len(leaders)),
+		timeout: timeout,
+	}
+	for _, leader := range leaders {
+		d.leaders[leader] = true
+	}
+	return d
+}
+
+// next feeds the detector the next keypress and returns the chord it
+// completes, if any. Keypresses are recorded as usual either way.
+func (d *chordDetector) next(data domain.KeypressData) (domain.KeyChordData, bool) {
+	if isModifierKey(data.Key) {
+		return domain.KeyChordData{}, false
+	}
+
+	leader := d.pending
+	d.pending = domain.KeypressData{}
+
+	if !leader.Timestamp.IsZero() && data.Timestamp.Sub(leader.Timestamp) <= d.timeout {
+		return domain.KeyChordData{
+			Sequence:  leader.Key + " " + data.Key,
+			Host:      data.Host,
+			Timestamp: data.Timestamp,
+		}, true
+	}
+
+	if d.leaders[data.Key] {
+		d.pending = data
+	}
+	return domain.KeyChordData{}, false
+}
+
+// isModifierKey reports whether key is a modifier on its own, possibly
+// while other modifiers are held, e.g. "shift" or "cmd+shift"
+func isModifierKey(key string) bool {
+	for _, name := range modifierKeys {
+		if key == name || strings.HasSuffix(key, "+"+name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package collector
+
+// eventBufferSize is how many events a subscriber may fall behind before
+// further events are dropped
+const eventBufferSize = 100
+
+// sendEvent delivers an event to subscribers without blocking. Collection
+// must never wait on a slow consumer, so the event is dropped if the buffer
+// is full.
+func sendEvent[T any](events chan T, event T) {
+	select {
+	case events <- event:
+	default:
+	}
+}
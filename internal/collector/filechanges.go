@@ -1,43 +1,244 @@
 package collector
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/metrics"
 	"github.com/nilszeilon/devstats/internal/storage"
 )
 
-const maxWatchedDirs = 1000 // Adjust this number based on your needs
+// defaultMaxWatchedDirs is how many directories are watched unless
+// WithMaxWatchedDirs says otherwise
+const defaultMaxWatchedDirs = 1000
+
+// defaultDebounceWindow is how long a path must be quiet before its change is recorded
+const defaultDebounceWindow = 500 * time.Millisecond
 
 type FileChangeCollector struct {
 	store    storage.Store[domain.FileChangeData]
 	watcher  *fsnotify.Watcher
 	stopChan chan struct{}
-	paths    []string
+	roots    []watchRoot
+
+	watchMu        sync.Mutex
+	watched        map[string]bool
+	ignores        map[string]*gitignore
+	maxWatchedDirs int
+	limitReached   bool
+	// systemLimitReached is set once the OS refused to add another watch
+	systemLimitReached bool
+	skipped            int
+
+	followSymlinks bool
+	visited        map[fileID]bool
+	// linkRoots maps the targets of followed symlinks to the root the link
+	// is in, for targets outside every root
+	linkRoots map[string]watchRoot
+
+	blacklist map[string]bool
+	languages map[string]string
+	filenames map[string]string
+
+	lines *lineCache
+
+	debounceWindow time.Duration
+	pendingMu      sync.Mutex
+	pending        map[string]*pendingChange
+	// recording counts the debounced changes being recorded, so Stop can
+	// wait for them
+	recording sync.WaitGroup
+
+	dedupeWindow time.Duration
+	dedupeMu     sync.Mutex
+	lastRecorded map[string]recordedChange
+
+	// limiter drops changes over the per language rate, nil if unlimited
+	limiter *languageLimiter
+
+	// filter classifies changed files in place of the language map if set
+	filter FileFilter
+
+	eventsMu     sync.Mutex
+	events       chan domain.FileChangeData
+	eventsClosed bool
+
+	paused atomic.Bool
+
+	// dryRun logs changes instead of saving them
+	dryRun bool
 }
 
-func NewFileChangeCollector(store storage.Store[domain.FileChangeData], paths []string) (*FileChangeCollector, error) {
-	// Increase system file descriptor limit
-	var rLimit syscall.Rlimit
-	err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit)
-	if err != nil {
-		return nil, fmt.Errorf("error getting rlimit: %v", err)
+// pendingChange is a file change waiting for its path to go quiet
+type pendingChange struct {
+	timer *time.Timer
+	path  string
+	op    fsnotify.Op
+	data  domain.FileChangeData
+}
+
+// recordedChange is the last change saved for a path, used to drop duplicates
+type recordedChange struct {
+	language   string
+	changeType string
+	at         time.Time
+}
+
+// Root is a directory tree watched as one project
+type Root struct {
+	Path string
+	// Name identifies the project in recorded changes. Defaults to the
+	// directory name.
+	Name string
+	// BlacklistDirs are directory names skipped only within this root
+	BlacklistDirs []string
+}
+
+// watchRoot is a Root resolved to an absolute path
+type watchRoot struct {
+	path      string
+	name      string
+	blacklist map[string]bool
+}
+
+// fileID identifies a directory independently of the path it was reached by
+type fileID struct {
+	dev, ino uint64
+}
+
+// FileChangeOption configures optional FileChangeCollector settings
+type FileChangeOption func(*FileChangeCollector)
+
+// FileFilter decides whether a change to path is recorded and under which
+// language. Returning keep false drops the change.
+type FileFilter func(path string, op fsnotify.Op) (language string, keep bool)
+
+// FileChangeConfig customizes which directories are walked and which files are tracked
+type FileChangeConfig struct {
+	// BlacklistDirs are directory names to skip
+	BlacklistDirs []string
+	// ExtensionLanguages maps file extensions (including the dot) to a language
+	ExtensionLanguages map[string]string
+	// FilenameLanguages maps whole file names, e.g. "Dockerfile", to a language
+	FilenameLanguages map[string]string
+	// ReplaceDefaults uses only the values above instead of merging them
+	// with the built-in blacklist and language map
+	ReplaceDefaults bool
+}
+
+// WithConfig applies a user supplied blacklist and language map
+func WithConfig(cfg FileChangeConfig) FileChangeOption {
+	return func(fc *FileChangeCollector) {
+		if cfg.ReplaceDefaults {
+			fc.blacklist = make(map[string]bool)
+			fc.languages = make(map[string]string)
+			fc.filenames = make(map[string]string)
+		}
+		for _, dir := range cfg.BlacklistDirs {
+			fc.blacklist[dir] = true
+		}
+		for ext, lang := range cfg.ExtensionLanguages {
+			fc.languages[ext] = lang
+		}
+		for name, lang := range cfg.FilenameLanguages {
+			fc.filenames[name] = lang
+		}
 	}
+}
 
-	// Set to a higher value, but keep it under the system maximum
-	newLimit := syscall.Rlimit{
-		Cur: 10240, // Soft limit
-		Max: rLimit.Max,
+// WithRoots watches additional project roots, each with its own name and
+// blacklist
+func WithRoots(roots ...Root) FileChangeOption {
+	return func(fc *FileChangeCollector) {
+		for _, root := range roots {
+			fc.addRoot(root)
+		}
 	}
-	err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &newLimit)
-	if err != nil {
-		log.Printf("Warning: Could not increase file descriptor limit: %v", err)
+}
+
+// WithFollowSymlinks makes the walk descend into symlinked directories and
+// watch their targets. Directories reached twice, e.g. through a link to a
+// parent, are only walked once. Off by default.
+func WithFollowSymlinks(follow bool) FileChangeOption {
+	return func(fc *FileChangeCollector) {
+		fc.followSymlinks = follow
+	}
+}
+
+// WithMaxWatchedDirs sets how many directories are watched at most.
+// Directories found after the limit is reached are not watched, see
+// WatchStats. Defaults to 1000.
+func WithMaxWatchedDirs(n int) FileChangeOption {
+	return func(fc *FileChangeCollector) {
+		fc.maxWatchedDirs = n
+	}
+}
+
+// WithFilter classifies changed files with filter instead of by extension,
+// e.g. to count Dockerfiles and Makefiles. Blacklisted directories and
+// ignored files are skipped before the filter is asked.
+func WithFilter(filter FileFilter) FileChangeOption {
+	return func(fc *FileChangeCollector) {
+		fc.filter = filter
+	}
+}
+
+// WithDebounceWindow sets how long a path must be quiet before a change is
+// recorded. Editors often fire several events for a single save. Zero
+// records every event.
+func WithDebounceWindow(window time.Duration) FileChangeOption {
+	return func(fc *FileChangeCollector) {
+		fc.debounceWindow = window
+	}
+}
+
+// WithDryRun logs every change that would be saved as a "DRYRUN
+// file_change" line instead of saving it, to try out a configuration
+func WithDryRun(dryRun bool) FileChangeOption {
+	return func(fc *FileChangeCollector) {
+		fc.dryRun = dryRun
+	}
+}
+
+// WithDedupeWindow drops a change if the previous change saved for the same
+// path had the same language and change type and happened less than window
+// ago, as rapid autosaves do. Unlike debouncing this compares the changes
+// themselves, not just the time between events. Zero, the default, saves
+// every change.
+func WithDedupeWindow(window time.Duration) FileChangeOption {
+	return func(fc *FileChangeCollector) {
+		fc.dedupeWindow = window
+	}
+}
+
+// WithRateLimit records at most perSecond changes per second for each
+// language, with bursts of up to a second's worth, so tools regenerating many
+// files at once don't inflate the counts. Changes over the limit are dropped
+// and counted in devstats_file_changes_dropped_total. Zero, the default,
+// records every change.
+func WithRateLimit(perSecond float64) FileChangeOption {
+	return func(fc *FileChangeCollector) {
+		if perSecond > 0 {
+			fc.limiter = newLanguageLimiter(perSecond)
+		} else {
+			fc.limiter = nil
+		}
+	}
+}
+
+func NewFileChangeCollector(store storage.Store[domain.FileChangeData], paths []string, opts ...FileChangeOption) (*FileChangeCollector, error) {
+	if err := raiseFileDescriptorLimit(); err != nil {
+		return nil, err
 	}
 
 	watcher, err := fsnotify.NewWatcher()
@@ -45,61 +246,333 @@ func NewFileChangeCollector(store storage.Store[domain.FileChangeData], paths []
 		return nil, err
 	}
 
-	return &FileChangeCollector{
-		store:    store,
-		watcher:  watcher,
-		stopChan: make(chan struct{}),
-		paths:    paths,
-	}, nil
+	fc := &FileChangeCollector{
+		store:          store,
+		watcher:        watcher,
+		stopChan:       make(chan struct{}),
+		watched:        make(map[string]bool),
+		ignores:        make(map[string]*gitignore),
+		maxWatchedDirs: defaultMaxWatchedDirs,
+		visited:        make(map[fileID]bool),
+		linkRoots:      make(map[string]watchRoot),
+		blacklist:      make(map[string]bool, len(defaultBlacklistDirs)),
+		languages:      make(map[string]string, len(defaultExtensionLanguages)),
+		filenames:      make(map[string]string, len(defaultFilenameLanguages)),
+		lines:          newLineCache(maxCachedLineCounts),
+		debounceWindow: defaultDebounceWindow,
+		pending:        make(map[string]*pendingChange),
+		lastRecorded:   make(map[string]recordedChange),
+		events:         make(chan domain.FileChangeData, eventBufferSize),
+	}
+	for dir := range defaultBlacklistDirs {
+		fc.blacklist[dir] = true
+	}
+	for ext, lang := range defaultExtensionLanguages {
+		fc.languages[ext] = lang
+	}
+	for name, lang := range defaultFilenameLanguages {
+		fc.filenames[name] = lang
+	}
+	for _, path := range paths {
+		fc.addRoot(Root{Path: path})
+	}
+	for _, opt := range opts {
+		opt(fc)
+	}
+
+	return fc, nil
+}
+
+// addRoot resolves root and adds it to the trees to watch
+func (fc *FileChangeCollector) addRoot(root Root) {
+	path, err := filepath.Abs(root.Path)
+	if err != nil {
+		path = filepath.Clean(root.Path)
+	}
+
+	name := root.Name
+	if name == "" {
+		name = filepath.Base(path)
+	}
+
+	blacklist := make(map[string]bool, len(root.BlacklistDirs))
+	for _, dir := range root.BlacklistDirs {
+		blacklist[dir] = true
+	}
+
+	fc.roots = append(fc.roots, watchRoot{path: path, name: name, blacklist: blacklist})
+}
+
+// rootOf returns the innermost root containing path. A path under the
+// target of a followed symlink outside every root belongs to the root the
+// link is in.
+func (fc *FileChangeCollector) rootOf(path string) (watchRoot, bool) {
+	var best watchRoot
+	var bestDir string
+	found := false
+	consider := func(dir string, root watchRoot) {
+		if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return
+		}
+		if !found || len(dir) > len(bestDir) {
+			best, bestDir = root, dir
+			found = true
+		}
+	}
+
+	for _, root := range fc.roots {
+		consider(root.path, root)
+	}
+	if found {
+		return best, true
+	}
+
+	fc.watchMu.Lock()
+	defer fc.watchMu.Unlock()
+	for target, root := range fc.linkRoots {
+		consider(target, root)
+	}
+	return best, found
 }
 
 func (fc *FileChangeCollector) Start() error {
-	watchedDirs := 0
-	// Add paths to watch
-	for _, path := range fc.paths {
-		err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-			// Handle permission errors and other access issues
-			if err != nil {
-				// log.Printf("Error accessing path %s: %v", path, err)
+	// Add roots to watch
+	for _, root := range fc.roots {
+		if err := fc.addTree(root.path); err != nil {
+			return fmt.Errorf("error walking path %s: %v", root.path, err)
+		}
+	}
+
+	stats := fc.WatchStats()
+	switch {
+	case stats.SystemLimitReached:
+		log.Printf("Watching %d directories, skipped %d more after reaching the system's watch limit, changes in them are not recorded. "+
+			"On Linux raise fs.inotify.max_user_watches, e.g. `sudo sysctl fs.inotify.max_user_watches=524288`", stats.Watched, stats.Skipped)
+	case stats.LimitReached:
+		log.Printf("Reached maximum number of watched directories (%d), skipped %d more, changes in them are not recorded", fc.maxWatchedDirs, stats.Skipped)
+	default:
+		log.Printf("Watching %d directories", stats.Watched)
+	}
+
+	go fc.watch()
+	return nil
+}
+
+// WatchStatus describes how much of the watched paths is actually watched
+type WatchStatus struct {
+	Watched int
+	// Skipped counts the directories left unwatched because a limit was
+	// reached. Their subdirectories aren't visited, so they aren't counted.
+	Skipped int
+	// LimitReached is set once the WithMaxWatchedDirs limit was reached
+	LimitReached bool
+	// SystemLimitReached is set once the OS refused to add more watches,
+	// e.g. because of inotify's per-user limit or the open file limit
+	SystemLimitReached bool
+}
+
+// WatchStats returns the number of watched directories and whether some
+// were left unwatched because of a limit
+func (fc *FileChangeCollector) WatchStats() WatchStatus {
+	fc.watchMu.Lock()
+	defer fc.watchMu.Unlock()
+
+	return WatchStatus{
+		Watched:            len(fc.watched),
+		Skipped:            fc.skipped,
+		LimitReached:       fc.limitReached,
+		SystemLimitReached: fc.systemLimitReached,
+	}
+}
+
+// addTree walks root and adds every eligible directory to the watcher
+func (fc *FileChangeCollector) addTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		// Handle permission errors and other access issues
+		if err != nil {
+			// log.Printf("Error accessing path %s: %v", path, err)
+			return filepath.SkipDir
+		}
+
+		// filepath.Walk doesn't follow links, so walk the target separately
+		if info.Mode()&os.ModeSymlink != 0 {
+			if fc.followSymlinks {
+				fc.addSymlinkTree(path)
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			base := filepath.Base(path)
+			// Skip hidden directories (starting with a dot)
+			if len(base) > 0 && base[0] == '.' {
+				// log.Printf("Skipping hidden directory: %s", path)
 				return filepath.SkipDir
 			}
 
-			if info.IsDir() {
-				base := filepath.Base(path)
-				// Skip hidden directories (starting with a dot)
-				if len(base) > 0 && base[0] == '.' {
-					// log.Printf("Skipping hidden directory: %s", path)
-					return filepath.SkipDir
-				}
+			// Skip blacklisted directories
+			if fc.isBlacklistedDir(path) {
+				// log.Printf("Skipping blacklisted directory: %s", path)
+				return filepath.SkipDir
+			}
 
-				// Skip blacklisted directories
-				if isBlacklistedDir(path) {
-					// log.Printf("Skipping blacklisted directory: %s", path)
-					return filepath.SkipDir
-				}
+			// Skip directories ignored by a .gitignore we've already seen
+			if fc.isIgnored(path, true) {
+				return filepath.SkipDir
+			}
 
-				// Check if we've hit the watch limit
-				if watchedDirs >= maxWatchedDirs {
-					log.Printf("Reached maximum number of watched directories (%d), skipping: %s", maxWatchedDirs, path)
-					return filepath.SkipDir
-				}
+			// Symlinks can lead back into a tree we're already walking
+			if fc.followSymlinks && !fc.markVisited(info) {
+				return filepath.SkipDir
+			}
 
-				// Try to add the directory to the watcher
-				if err := fc.watcher.Add(path); err != nil {
-					log.Printf("Error watching directory %s: %v", path, err)
-					return filepath.SkipDir
-				}
-				watchedDirs++
+			if !fc.addWatch(path) {
+				return filepath.SkipDir
 			}
-			return nil
-		})
-		if err != nil {
-			return fmt.Errorf("error walking path %s: %v", path, err)
+			fc.loadIgnores(path)
 		}
+		return nil
+	})
+}
+
+// addSymlinkTree walks the target of link if it is a directory
+func (fc *FileChangeCollector) addSymlinkTree(link string) {
+	target, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return
 	}
 
-	go fc.watch()
-	return nil
+	info, err := os.Stat(target)
+	if err != nil || !info.IsDir() {
+		return
+	}
+
+	// Changes under the target count towards the link's project and skip
+	// its root's blacklisted directories
+	if _, ok := fc.rootOf(target); !ok {
+		if root, ok := fc.rootOf(link); ok {
+			fc.watchMu.Lock()
+			fc.linkRoots[target] = root
+			fc.watchMu.Unlock()
+		}
+	}
+
+	if err := fc.addTree(target); err != nil {
+		log.Printf("Error walking symlinked directory %s: %v", link, err)
+	}
+}
+
+// markVisited records the directory described by info and reports whether
+// it was seen for the first time
+func (fc *FileChangeCollector) markVisited(info os.FileInfo) bool {
+	id, ok := dirID(info)
+	if !ok {
+		return true
+	}
+
+	fc.watchMu.Lock()
+	defer fc.watchMu.Unlock()
+
+	if fc.visited[id] {
+		return false
+	}
+	fc.visited[id] = true
+	return true
+}
+
+// loadIgnores reads the .gitignore in dir, if any, so its patterns apply below it
+func (fc *FileChangeCollector) loadIgnores(dir string) {
+	g, err := loadGitignore(dir)
+	if err != nil {
+		log.Printf("Error reading .gitignore in %s: %v", dir, err)
+		return
+	}
+	if g == nil {
+		return
+	}
+
+	fc.watchMu.Lock()
+	fc.ignores[dir] = g
+	fc.watchMu.Unlock()
+}
+
+// isIgnored reports whether path is excluded by a .gitignore in one of its
+// parent directories. Deeper .gitignore files take precedence.
+func (fc *FileChangeCollector) isIgnored(path string, isDir bool) bool {
+	fc.watchMu.Lock()
+	defer fc.watchMu.Unlock()
+
+	dir := filepath.Dir(path)
+	for {
+		if g := fc.ignores[dir]; g != nil {
+			if ignored, matched := g.match(path, isDir); matched {
+				return ignored
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+// addWatch adds a single directory to the watcher, respecting the watch limit
+func (fc *FileChangeCollector) addWatch(path string) bool {
+	fc.watchMu.Lock()
+	defer fc.watchMu.Unlock()
+
+	if fc.watched[path] {
+		return true
+	}
+
+	// Once the OS refused a watch, trying more only fills the log
+	if fc.systemLimitReached {
+		fc.skipped++
+		return false
+	}
+
+	// Check if we've hit the watch limit
+	if len(fc.watched) >= fc.maxWatchedDirs {
+		// Only the first skipped directory is logged, Start reports the rest
+		if !fc.limitReached {
+			log.Printf("Reached maximum number of watched directories (%d), skipping: %s", fc.maxWatchedDirs, path)
+			fc.limitReached = true
+		}
+		fc.skipped++
+		return false
+	}
+
+	// Try to add the directory to the watcher
+	if err := fc.watcher.Add(path); err != nil {
+		// inotify fails with ENOSPC once max_user_watches is used up, and
+		// kqueue with EMFILE once no descriptors are left
+		if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE) {
+			log.Printf("ERROR: the system refused to watch more directories after %d, skipping: %s: %v", len(fc.watched), path, err)
+			fc.systemLimitReached = true
+			fc.skipped++
+			return false
+		}
+		log.Printf("Error watching directory %s: %v", path, err)
+		return false
+	}
+	fc.watched[path] = true
+	return true
+}
+
+// removeWatch forgets a watched directory that was removed or renamed.
+// fsnotify drops the watch itself, so only the bookkeeping is updated.
+func (fc *FileChangeCollector) removeWatch(path string) bool {
+	fc.watchMu.Lock()
+	defer fc.watchMu.Unlock()
+
+	if !fc.watched[path] {
+		return false
+	}
+	delete(fc.watched, path)
+	delete(fc.ignores, path)
+	return true
 }
 
 func (fc *FileChangeCollector) watch() {
@@ -112,8 +585,21 @@ func (fc *FileChangeCollector) watch() {
 				return
 			}
 
-			// Skip non-code files (you might want to customize this)
-			if !isCodeFile(event.Name) {
+			// Keep coverage current as directories come and go
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := fc.addTree(event.Name); err != nil {
+						log.Printf("Error watching new directory %s: %v", event.Name, err)
+					}
+					continue
+				}
+			}
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && fc.removeWatch(event.Name) {
+				continue
+			}
+
+			// Directories are still tracked while paused, only changes are dropped
+			if fc.paused.Load() {
 				continue
 			}
 
@@ -126,19 +612,23 @@ func (fc *FileChangeCollector) watch() {
 				continue
 			}
 
-			language := getLanguage(event.Name)
-			if language == "" {
+			if fc.isIgnored(event.Name, false) {
 				continue
 			}
 
-			data := domain.FileChangeData{
-				Language:  language,
-				Timestamp: time.Now(),
+			// Skip non-code files
+			language, keep := fc.classify(event.Name, event.Op)
+			if !keep || language == "" {
+				continue
 			}
 
-			if err := fc.store.Save(data); err != nil {
-				log.Printf("Error saving file change: %v", err)
-			}
+			root, _ := fc.rootOf(event.Name)
+			fc.debounce(event.Name, event.Op, domain.FileChangeData{
+				Project:   root.name,
+				Language:  language,
+				Host:      hostname,
+				Timestamp: time.Now(),
+			})
 
 		case err, ok := <-fc.watcher.Errors:
 			if !ok {
@@ -149,87 +639,271 @@ func (fc *FileChangeCollector) watch() {
 	}
 }
 
+// debounce delays saving data until path has been quiet for the debounce
+// window, replacing any change still pending for the same path
+func (fc *FileChangeCollector) debounce(path string, op fsnotify.Op, data domain.FileChangeData) {
+	if fc.debounceWindow <= 0 {
+		fc.record(&pendingChange{path: path, op: op, data: data})
+		return
+	}
+
+	fc.pendingMu.Lock()
+	defer fc.pendingMu.Unlock()
+
+	if prev, ok := fc.pending[path]; ok {
+		prev.timer.Stop()
+		// Keep track of everything that happened to the path, e.g. Create then Write
+		op |= prev.op
+	}
+
+	p := &pendingChange{path: path, op: op, data: data}
+	p.timer = time.AfterFunc(fc.debounceWindow, func() {
+		fc.pendingMu.Lock()
+		// A newer event for this path superseded us
+		if fc.pending[path] != p {
+			fc.pendingMu.Unlock()
+			return
+		}
+		delete(fc.pending, path)
+		fc.recording.Add(1)
+		fc.pendingMu.Unlock()
+
+		defer fc.recording.Done()
+		fc.record(p)
+	})
+	fc.pending[path] = p
+}
+
+// record fills in the change type and line delta for a change and saves it
+func (fc *FileChangeCollector) record(p *pendingChange) {
+	p.data.ChangeType = changeType(p.path, p.op)
+	// The line cache is left alone, so the next saved change includes the lines
+	if fc.isDuplicate(p.path, p.data) {
+		return
+	}
+	if fc.limiter != nil && !fc.limiter.allow(p.data.Language, p.data.Timestamp) {
+		metrics.FileChangesDropped.WithLabelValues(p.data.Language).Inc()
+		return
+	}
+	p.data.LinesChanged = fc.lines.delta(p.path, p.op)
+
+	if fc.dryRun {
+		log.Printf("DRYRUN file_change path=%q project=%q language=%q change=%s lines=%d",
+			p.path, p.data.Project, p.data.Language, p.data.ChangeType, p.data.LinesChanged)
+	} else if err := fc.store.Save(p.data); err != nil {
+		log.Printf("Error saving file change: %v", err)
+	} else {
+		metrics.FileChangesTotal.WithLabelValues(p.data.Language).Inc()
+	}
+
+	// A debounce timer may still fire while stopping
+	fc.eventsMu.Lock()
+	if !fc.eventsClosed {
+		sendEvent(fc.events, p.data)
+	}
+	fc.eventsMu.Unlock()
+}
+
+// isDuplicate reports whether data repeats the last change saved for path
+// within the dedupe window, and remembers it otherwise
+func (fc *FileChangeCollector) isDuplicate(path string, data domain.FileChangeData) bool {
+	if fc.dedupeWindow <= 0 {
+		return false
+	}
+
+	fc.dedupeMu.Lock()
+	defer fc.dedupeMu.Unlock()
+
+	if last, ok := fc.lastRecorded[path]; ok &&
+		last.language == data.Language &&
+		last.changeType == data.ChangeType &&
+		data.Timestamp.Sub(last.at) < fc.dedupeWindow {
+		return true
+	}
+
+	// Forget paths that are quiet for longer than the window before growing
+	if len(fc.lastRecorded) >= maxCachedLineCounts {
+		for p, last := range fc.lastRecorded {
+			if data.Timestamp.Sub(last.at) >= fc.dedupeWindow {
+				delete(fc.lastRecorded, p)
+			}
+		}
+	}
+
+	fc.lastRecorded[path] = recordedChange{
+		language:   data.Language,
+		changeType: data.ChangeType,
+		at:         data.Timestamp,
+	}
+	return false
+}
+
+// changeType classifies the events seen for path during the debounce window.
+// A removed file that exists again was replaced, as editors do on save.
+func changeType(path string, op fsnotify.Op) string {
+	if op&fsnotify.Remove == fsnotify.Remove {
+		if _, err := os.Stat(path); err != nil {
+			return domain.ChangeRemove
+		}
+		return domain.ChangeWrite
+	}
+	if op&fsnotify.Create == fsnotify.Create {
+		return domain.ChangeCreate
+	}
+	return domain.ChangeWrite
+}
+
+// Pause drops file changes until Resume is called. Directories keep being
+// watched so nothing is missed after resuming. Safe to call from any goroutine.
+func (fc *FileChangeCollector) Pause() {
+	fc.paused.Store(true)
+}
+
+// Resume records file changes again after Pause
+func (fc *FileChangeCollector) Resume() {
+	fc.paused.Store(false)
+}
+
+// Paused reports whether file changes are currently dropped
+func (fc *FileChangeCollector) Paused() bool {
+	return fc.paused.Load()
+}
+
+// Events returns a channel that receives every file change as it is
+// recorded. Changes are dropped if the consumer falls behind. The channel is
+// closed by Stop.
+func (fc *FileChangeCollector) Events() <-chan domain.FileChangeData {
+	return fc.events
+}
+
 func (fc *FileChangeCollector) Stop() {
 	close(fc.stopChan)
 	fc.watcher.Close()
+
+	// Flush changes still waiting for their debounce window. A timer that
+	// already fired is still waiting for the lock, and gives up once its
+	// change is no longer pending.
+	fc.pendingMu.Lock()
+	var flush []*pendingChange
+	for path, p := range fc.pending {
+		p.timer.Stop()
+		flush = append(flush, p)
+		delete(fc.pending, path)
+	}
+	fc.pendingMu.Unlock()
+
+	for _, p := range flush {
+		fc.record(p)
+	}
+	// Timers that took their change before us may still be saving it
+	fc.recording.Wait()
+
+	fc.eventsMu.Lock()
+	fc.eventsClosed = true
+	close(fc.events)
+	fc.eventsMu.Unlock()
+}
+
+// defaultBlacklistDirs are directory names skipped while walking
+var defaultBlacklistDirs = map[string]bool{
+	// macOS system directories
+	"Library":      true,
+	"Applications": true,
+	"System":       true,
+	"Volumes":      true,
+	"cores":        true,
+	"private":      true,
+
+	// Development related directories to skip
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+	"coverage":     true,
+	"tmp":          true,
+	"temp":         true,
+	"go":           true,
+	"rails":        true,
+
+	// Package manager directories
+	"bower_components": true,
+	"jspm_packages":    true,
+	"packages":         true,
+
+	// IDE and editor directories
+	".idea":     true,
+	".vscode":   true,
+	".eclipse":  true,
+	".settings": true,
+
+	// Version control
+	".git": true,
+	".svn": true,
+	".hg":  true,
+
+	// macOS specific
+	".Trash": true,
+	".cache": true,
+	".npm":   true,
+	".yarn":  true,
+}
+
+// defaultExtensionLanguages maps file extensions to the language they are recorded as
+var defaultExtensionLanguages = map[string]string{
+	".go":     "go",
+	".js":     "javascript",
+	".ts":     "typescript",
+	".svelte": "svelte",
+	".py":     "python",
+	".rb":     "ruby",
+	".md":     "markdown",
+	".java":   "java",
+	".c":      "c",
+	".rs":     "rust",
+	".css":    "css",
+	".html":   "html",
+	".sql":    "sql",
+	".sh":     "shell",
+	".yaml":   "yaml",
+	".yml":    "yaml",
 }
 
 // isBlacklistedDir returns true if the directory should be skipped
-func isBlacklistedDir(path string) bool {
+func (fc *FileChangeCollector) isBlacklistedDir(path string) bool {
 	base := filepath.Base(path)
-	blacklist := map[string]bool{
-		// macOS system directories
-		"Library":      true,
-		"Applications": true,
-		"System":       true,
-		"Volumes":      true,
-		"cores":        true,
-		"private":      true,
-
-		// Development related directories to skip
-		"node_modules": true,
-		"vendor":       true,
-		"dist":         true,
-		"build":        true,
-		"target":       true,
-		"coverage":     true,
-		"tmp":          true,
-		"temp":         true,
-		"go":           true,
-		"rails":        true,
-
-		// Package manager directories
-		"bower_components": true,
-		"jspm_packages":    true,
-		"packages":         true,
-
-		// IDE and editor directories
-		".idea":     true,
-		".vscode":   true,
-		".eclipse":  true,
-		".settings": true,
-
-		// Version control
-		".git": true,
-		".svn": true,
-		".hg":  true,
-
-		// macOS specific
-		".Trash": true,
-		".cache": true,
-		".npm":   true,
-		".yarn":  true,
-	}
-	return blacklist[base]
-}
-
-func getLanguage(path string) string {
+	if fc.blacklist[base] {
+		return true
+	}
+
+	root, ok := fc.rootOf(path)
+	return ok && root.blacklist[base]
+}
+
+// getLanguage returns the language of path by its extension, else by its
+// name, else by its shebang line. Only created or written files without an
+// extension are read: scripts rarely have one, and reading on every write
+// of e.g. a .log file would cost more than it finds.
+func (fc *FileChangeCollector) getLanguage(path string, op fsnotify.Op) string {
 	ext := filepath.Ext(path)
-	languageMap := map[string]string{
-		".go":     "go",
-		".js":     "javascript",
-		".ts":     "typescript",
-		".svelte": "svelte",
-		".py":     "python",
-		".rb":     "ruby",
-		".md":     "markdown",
-		".java":   "java",
-		".c":      "c",
-		".rs":     "rust",
-		".css":    "css",
-		".html":   "html",
-		".sql":    "sql",
-		".sh":     "shell",
-		".yaml":   "yaml",
-		".yml":    "yaml",
-	}
-
-	if lang, exists := languageMap[ext]; exists {
+	if lang, exists := fc.languages[ext]; exists {
 		return lang
 	}
+	if lang, exists := fc.filenames[filepath.Base(path)]; exists {
+		return lang
+	}
+	if ext == "" && op&(fsnotify.Create|fsnotify.Write) != 0 {
+		return shebangLanguage(path)
+	}
 	return ""
 }
 
-func isCodeFile(path string) bool {
-	return getLanguage(path) != ""
+// classify returns the language of a changed file and whether the change
+// is recorded, asking the filter if one is set
+func (fc *FileChangeCollector) classify(path string, op fsnotify.Op) (string, bool) {
+	if fc.filter != nil {
+		return fc.filter(path, op)
+	}
+	language := fc.getLanguage(path, op)
+	return language, language != ""
 }
@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+)
+
+func TestStopRecordsChangeWhoseDebounceFired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := storage.NewMemStore[domain.FileChangeData]()
+	const window = 10 * time.Millisecond
+	fc, err := NewFileChangeCollector(store, nil, WithDebounceWindow(window))
+	if err != nil {
+		t.Fatalf("NewFileChangeCollector: %v", err)
+	}
+
+	fc.debounce(path, fsnotify.Write, domain.FileChangeData{Language: "go", Timestamp: time.Now()})
+
+	// Hold the lock so Stop queues up for it first, then the timer fires
+	// and queues up behind it
+	fc.pendingMu.Lock()
+	stopped := make(chan struct{})
+	go func() {
+		fc.Stop()
+		close(stopped)
+	}()
+	time.Sleep(5 * window)
+	fc.pendingMu.Unlock()
+	<-stopped
+
+	records, err := store.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("saved %d changes, want 1", len(records))
+	}
+}
+
+func TestFollowedSymlinkTargetBelongsToLinkRoot(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootPath := filepath.Join(dir, "root")
+	target := filepath.Join(dir, "elsewhere", "lib")
+	for _, d := range []string{rootPath, filepath.Join(target, "src"), filepath.Join(target, "generated")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(target, filepath.Join(rootPath, "lib")); err != nil {
+		t.Skipf("can't create symlinks: %v", err)
+	}
+
+	fc, err := NewFileChangeCollector(storage.NewMemStore[domain.FileChangeData](), nil,
+		WithRoots(Root{Path: rootPath, Name: "app", BlacklistDirs: []string{"generated"}}),
+		WithFollowSymlinks(true))
+	if err != nil {
+		t.Fatalf("NewFileChangeCollector: %v", err)
+	}
+	defer fc.watcher.Close()
+
+	if err := fc.addTree(rootPath); err != nil {
+		t.Fatalf("addTree: %v", err)
+	}
+
+	if root, ok := fc.rootOf(filepath.Join(target, "src", "main.go")); !ok || root.name != "app" {
+		t.Errorf("rootOf a file under the link target = %q, %v, want app", root.name, ok)
+	}
+	if !fc.watched[filepath.Join(target, "src")] {
+		t.Errorf("%s under the link target isn't watched", filepath.Join(target, "src"))
+	}
+	if fc.watched[filepath.Join(target, "generated")] {
+		t.Error("the root's blacklisted directory under the link target is watched")
+	}
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+
+package collector
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+)
+
+// fileDescriptorLimit is the soft limit on open files the collector raises
+// the process to, since each watch may hold a descriptor
+const fileDescriptorLimit = 10240
+
+// FileDescriptorLimit returns the limit on open files a FileChangeCollector
+// will run with, see raisedLimit
+func FileDescriptorLimit() (uint64, error) {
+	var rLimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit); err != nil {
+		return 0, fmt.Errorf("error getting rlimit: %v", err)
+	}
+	return raisedLimit(rLimit), nil
+}
+
+// raiseFileDescriptorLimit raises the soft limit on open files to
+// raisedLimit, if that is higher than it already is
+func raiseFileDescriptorLimit() error {
+	var rLimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit); err != nil {
+		return fmt.Errorf("error getting rlimit: %v", err)
+	}
+
+	limit := raisedLimit(rLimit)
+	if limit <= rLimit.Cur {
+		return nil
+	}
+
+	newLimit := syscall.Rlimit{
+		Cur: limit, // Soft limit
+		Max: rLimit.Max,
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &newLimit); err != nil {
+		log.Printf("Warning: Could not increase file descriptor limit: %v", err)
+	}
+	return nil
+}
+
+// raisedLimit returns the soft limit on open files raised to
+// fileDescriptorLimit, capped by the hard limit. A soft limit that is
+// already higher is kept rather than lowered.
+func raisedLimit(rLimit syscall.Rlimit) uint64 {
+	return max(rLimit.Cur, min(fileDescriptorLimit, rLimit.Max))
+}
+
+// dirID returns the device and inode of the directory described by info
+func dirID(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+
+package collector
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestRaisedLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		cur, max uint64
+		want     uint64
+	}{
+		{"low soft limit is raised", 256, 1 << 20, fileDescriptorLimit},
+		{"raise is capped by the hard limit", 256, 4096, 4096},
+		{"higher soft limit is kept", 65536, 1 << 20, 65536},
+		{"soft limit at the hard limit is kept", 4096, 4096, 4096},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := raisedLimit(syscall.Rlimit{Cur: tt.cur, Max: tt.max}); got != tt.want {
+				t.Errorf("raisedLimit(%d, %d) = %d, want %d", tt.cur, tt.max, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package collector
+
+import (
+	"math"
+	"os"
+)
+
+// FileDescriptorLimit returns no real limit, Windows doesn't cap the
+// handles a process may open the way RLIMIT_NOFILE does
+func FileDescriptorLimit() (uint64, error) {
+	return math.MaxUint64, nil
+}
+
+// raiseFileDescriptorLimit does nothing, there is no limit to raise
+func raiseFileDescriptorLimit() error {
+	return nil
+}
+
+// dirID reports that directories can't be identified from os.Stat on
+// Windows, so symlink loops are only bounded by max_watched_dirs
+func dirID(os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
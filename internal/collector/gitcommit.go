@@ -0,0 +1,215 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/metrics"
+	"github.com/nilszeilon/devstats/internal/storage"
+)
+
+// GitCommitCollector records commits by tailing the HEAD reflog of each repository
+type GitCommitCollector struct {
+	store    storage.Store[domain.CommitData]
+	watcher  *fsnotify.Watcher
+	stopChan chan struct{}
+	logs     map[string]*repoLog
+}
+
+// repoLog tracks how far a repository's HEAD reflog has been read
+type repoLog struct {
+	repo   string
+	offset int64
+}
+
+// NewGitCommitCollector creates a collector for the repositories containing paths
+func NewGitCommitCollector(store storage.Store[domain.CommitData], paths []string) (*GitCommitCollector, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	gc := &GitCommitCollector{
+		store:    store,
+		watcher:  watcher,
+		stopChan: make(chan struct{}),
+		logs:     make(map[string]*repoLog),
+	}
+
+	for _, path := range paths {
+		root, ok := findRepoRoot(path)
+		if !ok {
+			log.Printf("No git repository found for %s", path)
+			continue
+		}
+
+		logPath := filepath.Join(root, ".git", "logs", "HEAD")
+		if _, exists := gc.logs[logPath]; exists {
+			continue
+		}
+		gc.logs[logPath] = &repoLog{repo: filepath.Base(root)}
+	}
+
+	return gc, nil
+}
+
+// findRepoRoot walks up from path until it finds a directory containing .git
+func findRepoRoot(path string) (string, bool) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		if info, err := os.Stat(filepath.Join(dir, ".git")); err == nil && info.IsDir() {
+			return dir, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// Start begins watching the reflogs for new commits
+func (gc *GitCommitCollector) Start() error {
+	for logPath, rl := range gc.logs {
+		// Only commits made from now on are recorded
+		info, err := os.Stat(logPath)
+		if err != nil {
+			log.Printf("Error reading reflog %s: %v", logPath, err)
+			continue
+		}
+		rl.offset = info.Size()
+
+		if err := gc.watcher.Add(logPath); err != nil {
+			return fmt.Errorf("error watching reflog %s: %v", logPath, err)
+		}
+	}
+
+	go gc.watch()
+	return nil
+}
+
+func (gc *GitCommitCollector) watch() {
+	for {
+		select {
+		case <-gc.stopChan:
+			return
+		case event, ok := <-gc.watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Op&fsnotify.Write != fsnotify.Write {
+				continue
+			}
+
+			rl, ok := gc.logs[event.Name]
+			if !ok {
+				continue
+			}
+
+			if err := gc.readNewCommits(event.Name, rl); err != nil {
+				log.Printf("Error reading reflog %s: %v", event.Name, err)
+			}
+
+		case err, ok := <-gc.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Watcher error: %v", err)
+		}
+	}
+}
+
+// readNewCommits saves every commit appended to the reflog since the last read
+func (gc *GitCommitCollector) readNewCommits(logPath string, rl *repoLog) error {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// The reflog was rewritten (e.g. by git gc), start over from its end
+	if info.Size() < rl.offset {
+		rl.offset = info.Size()
+		return nil
+	}
+
+	if _, err := f.Seek(rl.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Leave partially written lines for the next event
+			break
+		}
+		rl.offset += int64(len(line))
+
+		data, ok := parseReflogCommit(rl.repo, strings.TrimSuffix(line, "\n"))
+		if !ok {
+			continue
+		}
+
+		if err := gc.store.Save(data); err != nil {
+			log.Printf("Error saving commit: %v", err)
+		} else {
+			metrics.CommitsTotal.Inc()
+		}
+	}
+
+	return nil
+}
+
+// parseReflogCommit parses a reflog line of the form
+// "<old> <new> <name> <email> <unix time> <tz>\t<message>"
+// and reports whether it describes a commit
+func parseReflogCommit(repo, line string) (domain.CommitData, bool) {
+	header, message, found := strings.Cut(line, "\t")
+	if !found || !strings.HasPrefix(message, "commit") {
+		return domain.CommitData{}, false
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) < 4 {
+		return domain.CommitData{}, false
+	}
+
+	timestamp := time.Now()
+	if unix, err := strconv.ParseInt(fields[len(fields)-2], 10, 64); err == nil {
+		timestamp = time.Unix(unix, 0)
+	}
+
+	return domain.CommitData{
+		Repo:      repo,
+		Hash:      fields[1],
+		Host:      hostname,
+		Timestamp: timestamp,
+	}, true
+}
+
+// Stop stops watching the reflogs
+func (gc *GitCommitCollector) Stop() {
+	close(gc.stopChan)
+	gc.watcher.Close()
+}
@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignoreRule is a single parsed line of a .gitignore file
+type gitignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// gitignore holds the rules of one .gitignore file, relative to its directory
+type gitignore struct {
+	base  string
+	rules []gitignoreRule
+}
+
+// loadGitignore parses dir/.gitignore. It returns nil if the file doesn't exist.
+func loadGitignore(dir string) (*gitignore, error) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	g := &gitignore{base: dir}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule gitignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// A slash anywhere but the end anchors the pattern to this directory
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		rule.pattern = line
+		g.rules = append(g.rules, rule)
+	}
+
+	return g, scanner.Err()
+}
+
+// match reports whether p is ignored by these rules. matched is false if no
+// rule applied, so callers can fall back to rules from parent directories.
+func (g *gitignore) match(p string, isDir bool) (ignored, matched bool) {
+	rel, err := filepath.Rel(g.base, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false, false
+	}
+	rel = filepath.ToSlash(rel)
+
+	// Later rules take precedence over earlier ones
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		var ok bool
+		if rule.anchored {
+			ok = matchGlob(strings.Split(rule.pattern, "/"), strings.Split(rel, "/"))
+		} else {
+			ok, _ = path.Match(rule.pattern, path.Base(rel))
+		}
+
+		if ok {
+			ignored = !rule.negate
+			matched = true
+		}
+	}
+
+	return ignored, matched
+}
+
+// matchGlob matches path segments against pattern segments, where "**"
+// matches any number of segments
+func matchGlob(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchGlob(pattern[1:], segments[1:])
+}
@@ -0,0 +1,19 @@
+package collector
+
+import (
+	"log"
+	"os"
+)
+
+// hostname is recorded with every event, so the stats of several machines
+// sharing a store stay apart. Empty if the system doesn't report one.
+var hostname = currentHostname()
+
+func currentHostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		log.Printf("Warning: Could not get the hostname: %v", err)
+		return ""
+	}
+	return name
+}
@@ -3,48 +3,36 @@ package collector
 import (
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 
+	"github.com/nilszeilon/devstats/internal/anon"
 	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/metrics"
 	"github.com/nilszeilon/devstats/internal/storage"
 )
 
-// #cgo CFLAGS: -x objective-c
-// #cgo LDFLAGS: -framework Cocoa -framework ApplicationServices
-// #import <ApplicationServices/ApplicationServices.h>
-// void external_go_callback(void*, int64_t);
-//
-// static CGEventRef eventCallback(CGEventTapProxy proxy, CGEventType type, CGEventRef event, void *refcon) {
-//     if (type == kCGEventKeyDown) {
-//         int64_t keycode = CGEventGetIntegerValueField(event, kCGKeyboardEventKeycode);
-//         external_go_callback(refcon, keycode);
-//     }
-//     return event;
-// }
-//
-// static void startEventTap(void* callback) {
-//     CGEventMask mask = CGEventMaskBit(kCGEventKeyDown);
-//     CFMachPortRef tap = CGEventTapCreate(
-//         kCGSessionEventTap,
-//         kCGHeadInsertEventTap,
-//         kCGEventTapOptionDefault,
-//         mask,
-//         eventCallback,
-//         callback
-//     );
-//
-//     if (!tap) {
-//         return;
-//     }
-//
-//     CFRunLoopSourceRef runLoopSource = CFMachPortCreateRunLoopSource(kCFAllocatorDefault, tap, 0);
-//     CFRunLoopAddSource(CFRunLoopGetCurrent(), runLoopSource, kCFRunLoopCommonModes);
-//     CGEventTapEnable(tap, true);
-//     CFRunLoopRun();
-// }
-import "C"
+const (
+	// keypressBatchSize is the number of buffered keypresses that triggers a flush
+	keypressBatchSize = 50
+	// keypressFlushInterval is the maximum time a keypress stays buffered
+	keypressFlushInterval = time.Second
+	// maxPendingCounts is the number of intervals whose keypress count
+	// failed to save that are kept to retry, the oldest is dropped beyond it
+	maxPendingCounts = 64
+)
+
+// Modifier bits of macOS's CGEventFlags. Hooks on other platforms translate
+// their modifier state to the same bits.
+const (
+	flagMaskShift     = 0x00020000
+	flagMaskControl   = 0x00040000
+	flagMaskAlternate = 0x00080000
+	flagMaskCommand   = 0x00100000
+)
 
 var (
 	globalCallback *KeypressCollector
@@ -55,166 +43,387 @@ var (
 type KeypressCollector struct {
 	store    storage.Store[domain.KeypressData]
 	stopChan chan struct{}
-	keyChan  chan int64
+	doneChan chan struct{}
+	keyChan  chan keyEvent
+	events   chan domain.KeypressData
+	paused   atomic.Bool
+	// healthy is set while the platform hook is delivering keypresses
+	healthy atomic.Bool
+
+	// sequenceStore receives the key pairs typed within sequenceWindow of
+	// each other, if set
+	sequenceStore  storage.Store[domain.KeySequenceData]
+	sequenceWindow time.Duration
+
+	// chordStore receives the chords found by chords, if set
+	chordStore storage.Store[domain.KeyChordData]
+	chords     *chordDetector
+
+	// dryRun logs keypresses instead of saving them
+	dryRun bool
+
+	// countStore receives only the number of keypresses per countInterval,
+	// in place of the keypresses themselves, if set
+	countStore    storage.Store[domain.KeypressAnonymousStats]
+	countInterval time.Duration
+	countLocation *time.Location
+
+	// layout names the keys whose character depends on the keyboard layout
+	layout KeyboardLayout
+
+	// sampleRate is the fraction of keypresses saved, see WithSampleRate
+	sampleRate float64
+}
+
+// KeypressOption configures optional KeypressCollector settings
+type KeypressOption func(*KeypressCollector)
+
+// WithKeySequences also saves every pair of consecutive keys pressed less
+// than window apart to store, for analyzing common sequences
+func WithKeySequences(store storage.Store[domain.KeySequenceData], window time.Duration) KeypressOption {
+	return func(kc *KeypressCollector) {
+		kc.sequenceStore = store
+		kc.sequenceWindow = window
+	}
+}
+
+// WithKeyChords also saves chords like "cmd+k cmd+s" to store: one of the
+// leaders followed by another key less than timeout later. The keys of a
+// chord are still recorded as keypresses of their own.
+func WithKeyChords(store storage.Store[domain.KeyChordData], leaders []string, timeout time.Duration) KeypressOption {
+	return func(kc *KeypressCollector) {
+		kc.chordStore = store
+		kc.chords = newChordDetector(leaders, timeout)
+	}
+}
+
+// keyEvent is a keycode together with the modifier flags held at the time
+type keyEvent struct {
+	keycode int64
+	flags   int64
+}
+
+// WithKeypressDryRun logs every keypress (and key sequence) that would be
+// saved as a "DRYRUN keypress" line instead of saving it
+func WithKeypressDryRun(dryRun bool) KeypressOption {
+	return func(kc *KeypressCollector) {
+		kc.dryRun = dryRun
+	}
+}
+
+// WithCountOnly counts keypresses in memory instead of saving them, and adds
+// the count of each interval to its row in store once the interval is over.
+// The keys themselves are never written anywhere, not even briefly, so key
+// sequences can't be recorded alongside. Intervals are aligned like the
+// anonymizer's, counted from midnight in loc.
+func WithCountOnly(store storage.Store[domain.KeypressAnonymousStats], interval time.Duration, loc *time.Location) KeypressOption {
+	return func(kc *KeypressCollector) {
+		kc.countStore = store
+		kc.countInterval = interval
+		kc.countLocation = loc
+	}
+}
+
+// WithSampleRate saves only a random fraction rate (0 < rate <= 1) of the
+// keypresses, each with its own chance, to write less while still getting
+// unbiased totals. Saved keypresses carry the rate, which the anonymizer
+// scales the counts back up by. Key sequences and chords still see every
+// keypress.
+func WithSampleRate(rate float64) KeypressOption {
+	return func(kc *KeypressCollector) {
+		kc.sampleRate = rate
+	}
 }
 
 // NewKeypressCollector creates a new keypress collector
-func NewKeypressCollector(store storage.Store[domain.KeypressData]) *KeypressCollector {
-	return &KeypressCollector{
-		store:    store,
-		stopChan: make(chan struct{}),
+func NewKeypressCollector(store storage.Store[domain.KeypressData], opts ...KeypressOption) *KeypressCollector {
+	kc := &KeypressCollector{
+		store:      store,
+		stopChan:   make(chan struct{}),
+		events:     make(chan domain.KeypressData, eventBufferSize),
+		layout:     DefaultKeyboardLayout,
+		sampleRate: 1,
+	}
+	for _, opt := range opts {
+		opt(kc)
+	}
+	return kc
+}
+
+// Events returns a channel that receives every keypress as it is recorded.
+// Keypresses are dropped if the consumer falls behind. The channel is
+// closed once the collector has stopped.
+func (kc *KeypressCollector) Events() <-chan domain.KeypressData {
+	return kc.events
+}
+
+// sendKey queues a keypress from the platform hook for the running collector
+func sendKey(keycode, flags int64) {
+	// Stop unregisters the collector under the same lock, so nothing is
+	// sent on keyChan once it has been stopped
+	callbackMutex.Lock()
+	if globalCallback != nil && globalCallback.keyChan != nil && !globalCallback.paused.Load() {
+		globalCallback.keyChan <- keyEvent{keycode: keycode, flags: flags}
 	}
+	callbackMutex.Unlock()
 }
 
-//export external_go_callback
-func external_go_callback(_ unsafe.Pointer, keycode int64) {
+// setHookHealthy records whether the platform hook is delivering keypresses
+// to the running collector
+func setHookHealthy(healthy bool) {
 	callbackMutex.Lock()
-	if globalCallback != nil && globalCallback.keyChan != nil {
-		globalCallback.keyChan <- keycode
+	if globalCallback != nil {
+		globalCallback.healthy.Store(healthy)
 	}
 	callbackMutex.Unlock()
+
+	if healthy {
+		metrics.KeypressHookUp.Set(1)
+	} else {
+		metrics.KeypressHookUp.Set(0)
+	}
+}
+
+// keyWithModifiers returns the key name, prefixed with the held modifiers
+// when it is part of a shortcut, e.g. "cmd+s" or "cmd+shift+z". Shift on its
+// own is just typing and is not recorded as a shortcut.
+func keyWithModifiers(keycode, flags int64, layout KeyboardLayout) string {
+	key := keyCodeToString(keycode, layout)
+
+	var modifiers []string
+	if flags&flagMaskCommand != 0 {
+		modifiers = append(modifiers, "cmd")
+	}
+	if flags&flagMaskControl != 0 {
+		modifiers = append(modifiers, "ctrl")
+	}
+	if flags&flagMaskAlternate != 0 {
+		modifiers = append(modifiers, "opt")
+	}
+	if len(modifiers) == 0 {
+		return key
+	}
+	if flags&flagMaskShift != 0 {
+		modifiers = append(modifiers, "shift")
+	}
+
+	return strings.Join(modifiers, "+") + "+" + key
 }
 
-// keyCodeToString converts a macOS keycode to a string representation
-func keyCodeToString(keycode int64) string {
-	keycodeMap := map[int64]string{
-		0:   "a",
-		1:   "s",
-		2:   "d",
-		3:   "f",
-		4:   "h",
-		5:   "g",
-		6:   "z",
-		7:   "x",
-		8:   "c",
-		9:   "v",
-		10:  "§", // Section symbol on some keyboards
-		11:  "b",
-		12:  "q",
-		13:  "w",
-		14:  "e",
-		15:  "r",
-		16:  "y",
-		17:  "t",
-		18:  "1",
-		19:  "2",
-		20:  "3",
-		21:  "4",
-		22:  "6",
-		23:  "5",
-		24:  "´",
-		25:  "9",
-		26:  "7",
-		27:  "+",
-		28:  "8",
-		29:  "0",
-		30:  "¨",
-		31:  "o",
-		32:  "u",
-		33:  "å",
-		34:  "i",
-		35:  "p",
-		36:  "return",
-		37:  "l",
-		38:  "j",
-		39:  "ä",
-		40:  "k",
-		41:  "ö",
-		42:  "'",
-		43:  ",",
-		44:  "-",
-		45:  "n",
-		46:  "m",
-		47:  ".",
-		48:  "tab",
-		49:  "space",
-		50:  "<",
-		51:  "delete",
-		53:  "escape",
-		55:  "command",
-		56:  "shift",
-		57:  "capslock",
-		58:  "option",
-		59:  "control",
-		60:  "right_shift",
-		61:  "right_option",
-		62:  "right_control",
-		63:  "fn",
-		64:  "f17",
-		65:  "keypad_decimal",
-		67:  "keypad_multiply",
-		69:  "keypad_plus",
-		71:  "keypad_clear",
-		75:  "keypad_divide",
-		76:  "keypad_enter",
-		78:  "keypad_minus",
-		79:  "f18",
-		80:  "f19",
-		81:  "keypad_equals",
-		82:  "keypad_0",
-		83:  "keypad_1",
-		84:  "keypad_2",
-		85:  "keypad_3",
-		86:  "keypad_4",
-		87:  "keypad_5",
-		88:  "keypad_6",
-		89:  "keypad_7",
-		91:  "keypad_8",
-		92:  "keypad_9",
-		96:  "f5",
-		97:  "f6",
-		98:  "f7",
-		99:  "f3",
-		100: "f8",
-		101: "f9",
-		102: "f11",
-		103: "f13",
-		104: "f16",
-		105: "f14",
-		106: "f10",
-		107: "f12",
-		108: "f15",
-		109: "f4",
-		110: "f2",
-		111: "f1",
-		114: "help",
-		115: "home",
-		116: "page_up",
-		117: "forward_delete",
-		118: "f4",
-		119: "end",
-		120: "f2",
-		121: "page_down",
-		122: "f1",
-		123: "left_arrow",
-		124: "right_arrow",
-		125: "down_arrow",
-		126: "up_arrow",
-	}
-
-	if str, ok := keycodeMap[keycode]; ok {
-		return str
-	}
-	return fmt.Sprintf("key_%d", keycode)
+// CheckKeyHook reports whether the platform's keyboard hook can be
+// installed, e.g. whether macOS granted the permissions it needs. It does
+// not start collecting.
+func CheckKeyHook() error {
+	return checkKeyHook()
 }
 
 // Start begins collecting keypress data
 func (kc *KeypressCollector) Start() error {
-	kc.keyChan = make(chan int64, 100)
+	kc.keyChan = make(chan keyEvent, 100)
+	kc.doneChan = make(chan struct{})
 
 	go func() {
+		defer close(kc.doneChan)
+		defer close(kc.events)
+
+		ticker := time.NewTicker(keypressFlushInterval)
+		defer ticker.Stop()
+
+		buffer := make([]domain.KeypressData, 0, keypressBatchSize)
+		var sequences []domain.KeySequenceData
+		var chords []domain.KeyChordData
+		var previous domain.KeypressData
+		var counted domain.KeypressAnonymousStats
+		// pendingCounts are the counts of earlier intervals that failed to
+		// save, retried on every flush
+		var pendingCounts []domain.KeypressAnonymousStats
+
+		// saveCount adds stats to their interval's stats, which an earlier
+		// partial flush may have saved already
+		saveCount := func(stats domain.KeypressAnonymousStats) error {
+			total := stats
+			existing, err := kc.countStore.FindBetweenTyped(stats.Timestamp, stats.Timestamp)
+			if err != nil {
+				return fmt.Errorf("failed to read keypress counts: %w", err)
+			}
+			for _, e := range existing {
+				if e.Host == total.Host {
+					total.KeypressesCount += e.KeypressesCount
+					total.ShortcutsCount += e.ShortcutsCount
+				}
+			}
+
+			if err := storage.SaveUnique(kc.countStore, total); err != nil {
+				return fmt.Errorf("failed to save keypress counts: %w", err)
+			}
+			metrics.KeypressesTotal.Add(float64(stats.KeypressesCount))
+			return nil
+		}
+
+		// flushCount saves the keypresses counted so far, after retrying
+		// the counts of earlier intervals that failed to save
+		flushCount := func() {
+			remaining := pendingCounts[:0]
+			for _, stats := range pendingCounts {
+				if err := saveCount(stats); err != nil {
+					log.Printf("Error saving keypress counts, retrying later: %v", err)
+					remaining = append(remaining, stats)
+				}
+			}
+			pendingCounts = remaining
+
+			if counted.KeypressesCount == 0 {
+				return
+			}
+			if kc.dryRun {
+				log.Printf("DRYRUN keypress_count interval=%s keypresses=%d shortcuts=%d",
+					counted.Timestamp.Format(time.RFC3339), counted.KeypressesCount, counted.ShortcutsCount)
+				counted.KeypressesCount, counted.ShortcutsCount = 0, 0
+				return
+			}
+
+			if err := saveCount(counted); err != nil {
+				log.Printf("Error saving keypress counts, retrying later: %v", err)
+				return
+			}
+			counted.KeypressesCount, counted.ShortcutsCount = 0, 0
+		}
+
+		// count adds the keypress to the count of its interval, saving the
+		// previous interval's count first. A count that fails to save is
+		// kept to retry instead of being lost with its interval.
+		count := func(data domain.KeypressData) {
+			start := anon.IntervalStart(data.Timestamp, kc.countInterval, kc.countLocation)
+			if !start.Equal(counted.Timestamp) {
+				flushCount()
+				if counted.KeypressesCount > 0 {
+					if len(pendingCounts) >= maxPendingCounts {
+						dropped := pendingCounts[0]
+						log.Printf("ERROR: Dropped %d keypresses counted in the interval starting %s, their count could not be saved",
+							dropped.KeypressesCount, dropped.Timestamp.Format(time.RFC3339))
+						pendingCounts = pendingCounts[1:]
+					}
+					pendingCounts = append(pendingCounts, counted)
+				}
+				counted = domain.KeypressAnonymousStats{Timestamp: start, Host: data.Host, SampleRate: 1}
+			}
+
+			counted.KeypressesCount++
+			if domain.IsShortcut(data.Key) {
+				counted.ShortcutsCount++
+			}
+		}
+
+		flush := func() {
+			if kc.dryRun {
+				for _, sequence := range sequences {
+					log.Printf("DRYRUN key_sequence first=%q second=%q", sequence.First, sequence.Second)
+				}
+				for _, chord := range chords {
+					log.Printf("DRYRUN key_chord sequence=%q", chord.Sequence)
+				}
+				chords = chords[:0]
+				for _, data := range buffer {
+					log.Printf("DRYRUN keypress key=%q", data.Key)
+				}
+				sequences = sequences[:0]
+				buffer = buffer[:0]
+				return
+			}
+
+			if len(sequences) > 0 {
+				if err := kc.sequenceStore.SaveBatch(sequences); err != nil {
+					log.Printf("Error saving key sequences: %v", err)
+				}
+				sequences = sequences[:0]
+			}
+
+			if len(chords) > 0 {
+				if err := kc.chordStore.SaveBatch(chords); err != nil {
+					log.Printf("Error saving key chords: %v", err)
+				}
+				chords = chords[:0]
+			}
+
+			if len(buffer) == 0 {
+				return
+			}
+			if err := kc.store.SaveBatch(buffer); err != nil {
+				log.Printf("Error saving keypresses: %v", err)
+			} else {
+				metrics.KeypressesTotal.Add(float64(len(buffer)))
+			}
+			buffer = buffer[:0]
+		}
+
+		add := func(event keyEvent) {
+			data := domain.KeypressData{
+				Key:        keyWithModifiers(event.keycode, event.flags, kc.layout),
+				Host:       hostname,
+				Timestamp:  time.Now(),
+				SampleRate: kc.sampleRate,
+			}
+			sendEvent(kc.events, data)
+			if kc.countStore != nil {
+				count(data)
+				return
+			}
+			if kc.sampleRate >= 1 || rand.Float64() < kc.sampleRate {
+				buffer = append(buffer, data)
+			}
+
+			// Pair the key with the previous one if they were typed in one go
+			if kc.sequenceStore != nil {
+				if !previous.Timestamp.IsZero() && data.Timestamp.Sub(previous.Timestamp) <= kc.sequenceWindow {
+					sequences = append(sequences, domain.KeySequenceData{
+						First:     previous.Key,
+						Second:    data.Key,
+						Host:      hostname,
+						Timestamp: data.Timestamp,
+					})
+				}
+				previous = data
+			}
+
+			if kc.chordStore != nil {
+				if chord, ok := kc.chords.next(data); ok {
+					chords = append(chords, chord)
+				}
+			}
+
+			if len(buffer) >= keypressBatchSize {
+				flush()
+			}
+		}
+
 		for {
 			select {
 			case <-kc.stopChan:
-				return
-			case keycode := <-kc.keyChan:
-				data := domain.KeypressData{
-					Key:       keyCodeToString(keycode),
-					Timestamp: time.Now(),
-				}
+				// Keep the keypresses that were queued before Stop
+				for {
+					select {
+					case event := <-kc.keyChan:
+						add(event)
+					default:
+						flush()
+						flushCount()
 
-				if err := kc.store.Save(data); err != nil {
-					log.Printf("Error saving keypress: %v", err)
+						lost := counted.KeypressesCount
+						for _, stats := range pendingCounts {
+							lost += stats.KeypressesCount
+						}
+						if lost > 0 {
+							log.Printf("ERROR: Dropped %d counted keypresses on shutdown, their counts could not be saved", lost)
+						}
+						return
+					}
+				}
+			case event := <-kc.keyChan:
+				add(event)
+			case now := <-ticker.C:
+				flush()
+				if kc.countStore != nil && (len(pendingCounts) > 0 || !anon.IntervalStart(now, kc.countInterval, kc.countLocation).Equal(counted.Timestamp)) {
+					flushCount()
 				}
 			}
 		}
@@ -225,27 +434,62 @@ func (kc *KeypressCollector) Start() error {
 	globalCallback = kc
 	callbackMutex.Unlock()
 
-	// Start the event tap in a separate goroutine
-	go C.startEventTap(nil)
+	// Start the platform's keyboard hook
+	if err := startKeyHook(); err != nil {
+		kc.Stop()
+		return err
+	}
 
 	return nil
 }
 
-// Stop stops collecting keypress data
+// Stop stops collecting keypress data. It returns once every queued
+// keypress has been saved.
 func (kc *KeypressCollector) Stop() {
+	stopKeyHook()
+	setHookHealthy(false)
+
 	callbackMutex.Lock()
 	if globalCallback == kc {
 		globalCallback = nil
 	}
 	callbackMutex.Unlock()
 	close(kc.stopChan)
+
+	if kc.doneChan != nil {
+		<-kc.doneChan
+	}
+}
+
+// Pause drops keypresses until Resume is called. Safe to call from any goroutine.
+func (kc *KeypressCollector) Pause() {
+	kc.paused.Store(true)
+}
+
+// Resume records keypresses again after Pause
+func (kc *KeypressCollector) Resume() {
+	kc.paused.Store(false)
+}
+
+// Paused reports whether keypresses are currently dropped
+func (kc *KeypressCollector) Paused() bool {
+	return kc.paused.Load()
+}
+
+// Healthy reports whether the keyboard hook is running and delivering
+// keypresses. It is false before the hook has started, when it could not be
+// started, and when the system disabled it without it being re-enabled.
+func (kc *KeypressCollector) Healthy() bool {
+	return kc.healthy.Load()
 }
 
 // Record saves a keypress event (mainly for testing)
 func (kc *KeypressCollector) Record(key string) error {
 	data := domain.KeypressData{
-		Key:       key,
-		Timestamp: time.Now(),
+		Key:        key,
+		Host:       hostname,
+		Timestamp:  time.Now(),
+		SampleRate: 1,
 	}
 	return kc.store.Save(data)
 }
@@ -0,0 +1,297 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"unsafe"
+)
+
+// #cgo CFLAGS: -x objective-c
+// #cgo LDFLAGS: -framework Cocoa -framework ApplicationServices
+// #import <ApplicationServices/ApplicationServices.h>
+// void external_go_callback(void*, int64_t, int64_t);
+// void external_go_tap_status(int64_t);
+//
+// #define TAP_RUNNING 0
+// #define TAP_CREATE_FAILED 1
+// #define TAP_REENABLED_AFTER_TIMEOUT 2
+// #define TAP_REENABLED_AFTER_USER_INPUT 3
+// #define TAP_REENABLE_FAILED 4
+//
+// static CFMachPortRef keyTap;
+//
+// static CGEventRef eventCallback(CGEventTapProxy proxy, CGEventType type, CGEventRef event, void *refcon) {
+//     // macOS turns the tap off when a callback is too slow or on some user
+//     // input, and only tells the callback about it
+//     if (type == kCGEventTapDisabledByTimeout || type == kCGEventTapDisabledByUserInput) {
+//         CGEventTapEnable(keyTap, true);
+//         if (!CGEventTapIsEnabled(keyTap)) {
+//             external_go_tap_status(TAP_REENABLE_FAILED);
+//         } else if (type == kCGEventTapDisabledByTimeout) {
+//             external_go_tap_status(TAP_REENABLED_AFTER_TIMEOUT);
+//         } else {
+//             external_go_tap_status(TAP_REENABLED_AFTER_USER_INPUT);
+//         }
+//         return event;
+//     }
+//
+//     if (type == kCGEventKeyDown) {
+//         int64_t keycode = CGEventGetIntegerValueField(event, kCGKeyboardEventKeycode);
+//         int64_t flags = (int64_t)CGEventGetFlags(event);
+//         external_go_callback(refcon, keycode, flags);
+//     }
+//     return event;
+// }
+//
+// static void startEventTap(void* callback) {
+//     CGEventMask mask = CGEventMaskBit(kCGEventKeyDown);
+//     CFMachPortRef tap = CGEventTapCreate(
+//         kCGSessionEventTap,
+//         kCGHeadInsertEventTap,
+//         kCGEventTapOptionDefault,
+//         mask,
+//         eventCallback,
+//         callback
+//     );
+//
+//     if (!tap) {
+//         external_go_tap_status(TAP_CREATE_FAILED);
+//         return;
+//     }
+//     keyTap = tap;
+//
+//     CFRunLoopSourceRef runLoopSource = CFMachPortCreateRunLoopSource(kCFAllocatorDefault, tap, 0);
+//     CFRunLoopAddSource(CFRunLoopGetCurrent(), runLoopSource, kCFRunLoopCommonModes);
+//     CGEventTapEnable(tap, true);
+//     external_go_tap_status(TAP_RUNNING);
+//     CFRunLoopRun();
+// }
+//
+// static int canCreateEventTap() {
+//     CFMachPortRef tap = CGEventTapCreate(
+//         kCGSessionEventTap,
+//         kCGHeadInsertEventTap,
+//         kCGEventTapOptionListenOnly,
+//         CGEventMaskBit(kCGEventKeyDown),
+//         eventCallback,
+//         NULL
+//     );
+//
+//     if (!tap) {
+//         return 0;
+//     }
+//
+//     CFMachPortInvalidate(tap);
+//     CFRelease(tap);
+//     return 1;
+// }
+import "C"
+
+//export external_go_callback
+func external_go_callback(_ unsafe.Pointer, keycode int64, flags int64) {
+	sendKey(keycode, flags)
+}
+
+// tap is the state of the running event tap
+var (
+	tapMu sync.Mutex
+	tap   tapHealth
+)
+
+//export external_go_tap_status
+func external_go_tap_status(status int64) {
+	tapMu.Lock()
+	next, message := tap.next(tapStatus(status))
+	tap = next
+	tapMu.Unlock()
+
+	if message != "" {
+		log.Print(message)
+	}
+	setHookHealthy(next.healthy)
+}
+
+// startKeyHook starts the event tap, which runs until the process exits
+func startKeyHook() error {
+	go C.startEventTap(nil)
+	return nil
+}
+
+// checkKeyHook creates and releases an event tap, which fails unless the
+// process was granted accessibility access
+func checkKeyHook() error {
+	if C.canCreateEventTap() == 0 {
+		return errors.New("could not create a keyboard event tap, allow devstats (or the terminal running it) under Accessibility and Input Monitoring in System Settings > Privacy & Security")
+	}
+	return nil
+}
+
+// stopKeyHook leaves the tap running, sendKey drops events once the
+// collector is unregistered
+func stopKeyHook() {}
+
+// layoutKeycodes names the macOS keycodes whose character depends on the
+// keyboard layout. Apple's British layout only differs from the US one in
+// shifted characters, which aren't recorded.
+var layoutKeycodes = map[KeyboardLayout]map[int64]string{
+	LayoutUS: {
+		10: "§",
+		24: "=",
+		27: "-",
+		30: "]",
+		33: "[",
+		39: "'",
+		41: ";",
+		42: "\\",
+		43: ",",
+		44: "/",
+		47: ".",
+		50: "`",
+	},
+	LayoutUK: {
+		10: "§",
+		24: "=",
+		27: "-",
+		30: "]",
+		33: "[",
+		39: "'",
+		41: ";",
+		42: "\\",
+		43: ",",
+		44: "/",
+		47: ".",
+		50: "`",
+	},
+	LayoutNordic: {
+		10: "§",
+		24: "´",
+		27: "+",
+		30: "¨",
+		33: "å",
+		39: "ä",
+		41: "ö",
+		42: "'",
+		43: ",",
+		44: "-",
+		47: ".",
+		50: "<",
+	},
+}
+
+// keyCodeToString converts a macOS keycode to a string representation, the
+// layout dependent keys named after layout
+func keyCodeToString(keycode int64, layout KeyboardLayout) string {
+	if str, ok := layoutKeycodes[layout][keycode]; ok {
+		return str
+	}
+
+	keycodeMap := map[int64]string{
+		0:   "a",
+		1:   "s",
+		2:   "d",
+		3:   "f",
+		4:   "h",
+		5:   "g",
+		6:   "z",
+		7:   "x",
+		8:   "c",
+		9:   "v",
+		11:  "b",
+		12:  "q",
+		13:  "w",
+		14:  "e",
+		15:  "r",
+		16:  "y",
+		17:  "t",
+		18:  "1",
+		19:  "2",
+		20:  "3",
+		21:  "4",
+		22:  "6",
+		23:  "5",
+		25:  "9",
+		26:  "7",
+		28:  "8",
+		29:  "0",
+		31:  "o",
+		32:  "u",
+		34:  "i",
+		35:  "p",
+		36:  "return",
+		37:  "l",
+		38:  "j",
+		40:  "k",
+		45:  "n",
+		46:  "m",
+		48:  "tab",
+		49:  "space",
+		51:  "delete",
+		53:  "escape",
+		55:  "command",
+		56:  "shift",
+		57:  "capslock",
+		58:  "option",
+		59:  "control",
+		60:  "right_shift",
+		61:  "right_option",
+		62:  "right_control",
+		63:  "fn",
+		64:  "f17",
+		65:  "keypad_decimal",
+		67:  "keypad_multiply",
+		69:  "keypad_plus",
+		71:  "keypad_clear",
+		75:  "keypad_divide",
+		76:  "keypad_enter",
+		78:  "keypad_minus",
+		79:  "f18",
+		80:  "f19",
+		81:  "keypad_equals",
+		82:  "keypad_0",
+		83:  "keypad_1",
+		84:  "keypad_2",
+		85:  "keypad_3",
+		86:  "keypad_4",
+		87:  "keypad_5",
+		88:  "keypad_6",
+		89:  "keypad_7",
+		91:  "keypad_8",
+		92:  "keypad_9",
+		96:  "f5",
+		97:  "f6",
+		98:  "f7",
+		99:  "f3",
+		100: "f8",
+		101: "f9",
+		102: "f11",
+		103: "f13",
+		104: "f16",
+		105: "f14",
+		106: "f10",
+		107: "f12",
+		108: "f15",
+		109: "f4",
+		110: "f2",
+		111: "f1",
+		114: "help",
+		115: "home",
+		116: "page_up",
+		117: "forward_delete",
+		118: "f4",
+		119: "end",
+		120: "f2",
+		121: "page_down",
+		122: "f1",
+		123: "left_arrow",
+		124: "right_arrow",
+		125: "down_arrow",
+		126: "up_arrow",
+	}
+
+	if str, ok := keycodeMap[keycode]; ok {
+		return str
+	}
+	return fmt.Sprintf("key_%d", keycode)
+}
@@ -0,0 +1,25 @@
+//go:build !darwin && !windows
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errKeyHookUnsupported = errors.New("keypress collection is not supported on this platform")
+
+// startKeyHook fails, there is no keyboard hook for this platform yet
+func startKeyHook() error {
+	return errKeyHookUnsupported
+}
+
+func checkKeyHook() error {
+	return errKeyHookUnsupported
+}
+
+func stopKeyHook() {}
+
+func keyCodeToString(keycode int64, _ KeyboardLayout) string {
+	return fmt.Sprintf("key_%d", keycode)
+}
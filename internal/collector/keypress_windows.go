@@ -0,0 +1,255 @@
+package collector
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32                  = windows.NewLazySystemDLL("user32.dll")
+	procSetWindowsHookExW   = user32.NewProc("SetWindowsHookExW")
+	procUnhookWindowsHookEx = user32.NewProc("UnhookWindowsHookEx")
+	procCallNextHookEx      = user32.NewProc("CallNextHookEx")
+	procGetMessageW         = user32.NewProc("GetMessageW")
+	procPostThreadMessageW  = user32.NewProc("PostThreadMessageW")
+	procGetAsyncKeyState    = user32.NewProc("GetAsyncKeyState")
+)
+
+const (
+	whKeyboardLL = 13
+	wmQuit       = 0x0012
+	wmKeyDown    = 0x0100
+	wmSysKeyDown = 0x0104
+)
+
+// kbdllHookStruct mirrors KBDLLHOOKSTRUCT
+type kbdllHookStruct struct {
+	vkCode      uint32
+	scanCode    uint32
+	flags       uint32
+	time        uint32
+	dwExtraInfo uintptr
+}
+
+// winMsg mirrors MSG
+type winMsg struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      struct{ x, y int32 }
+}
+
+var (
+	hookMu       sync.Mutex
+	hookThreadID uint32
+	hookDone     chan struct{}
+)
+
+// keyboardProc is created once since Windows callbacks are never freed
+var keyboardProc = windows.NewCallback(func(nCode, wParam uintptr, kb *kbdllHookStruct) uintptr {
+	if int32(nCode) >= 0 && (wParam == wmKeyDown || wParam == wmSysKeyDown) {
+		sendKey(int64(kb.vkCode), modifierFlags())
+	}
+	ret, _, _ := procCallNextHookEx.Call(0, nCode, wParam, uintptr(unsafe.Pointer(kb)))
+	return ret
+})
+
+// startKeyHook installs a low-level keyboard hook. Windows calls the hook on
+// the thread that installed it, so that thread is locked and runs a message
+// loop until stopKeyHook.
+func startKeyHook() error {
+	started := make(chan error, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		hook, _, err := procSetWindowsHookExW.Call(whKeyboardLL, keyboardProc, 0, 0)
+		if hook == 0 {
+			started <- fmt.Errorf("failed to install keyboard hook: %v", err)
+			return
+		}
+		defer procUnhookWindowsHookEx.Call(hook)
+
+		hookMu.Lock()
+		hookThreadID = windows.GetCurrentThreadId()
+		hookDone = done
+		hookMu.Unlock()
+		setHookHealthy(true)
+		started <- nil
+
+		var msg winMsg
+		for {
+			// 0 means WM_QUIT was received, -1 an error
+			ret, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0)
+			if int32(ret) <= 0 {
+				return
+			}
+		}
+	}()
+
+	return <-started
+}
+
+// checkKeyHook installs and immediately removes a keyboard hook
+func checkKeyHook() error {
+	hook, _, err := procSetWindowsHookExW.Call(whKeyboardLL, keyboardProc, 0, 0)
+	if hook == 0 {
+		return fmt.Errorf("failed to install keyboard hook: %v", err)
+	}
+	procUnhookWindowsHookEx.Call(hook)
+	return nil
+}
+
+// stopKeyHook ends the message loop and waits for the hook to be removed
+func stopKeyHook() {
+	hookMu.Lock()
+	threadID, done := hookThreadID, hookDone
+	hookThreadID, hookDone = 0, nil
+	hookMu.Unlock()
+
+	if threadID == 0 {
+		return
+	}
+
+	procPostThreadMessageW.Call(uintptr(threadID), wmQuit, 0, 0)
+	<-done
+}
+
+// modifierFlags returns the held modifiers as CGEventFlags bits. The
+// Windows key takes the place of command.
+func modifierFlags() int64 {
+	var flags int64
+	if keyDown(0x10) { // VK_SHIFT
+		flags |= flagMaskShift
+	}
+	if keyDown(0x11) { // VK_CONTROL
+		flags |= flagMaskControl
+	}
+	if keyDown(0x12) { // VK_MENU
+		flags |= flagMaskAlternate
+	}
+	if keyDown(0x5B) || keyDown(0x5C) { // VK_LWIN, VK_RWIN
+		flags |= flagMaskCommand
+	}
+	return flags
+}
+
+// keyDown reports whether the virtual key is currently held
+func keyDown(vk uintptr) bool {
+	state, _, _ := procGetAsyncKeyState.Call(vk)
+	return state&0x8000 != 0
+}
+
+// layoutVirtualKeys names the OEM virtual-key codes, whose character
+// depends on the keyboard layout
+var layoutVirtualKeys = map[KeyboardLayout]map[int64]string{
+	LayoutUS: {
+		0xBA: ";",
+		0xBB: "=",
+		0xBC: ",",
+		0xBD: "-",
+		0xBE: ".",
+		0xBF: "/",
+		0xC0: "`",
+		0xDB: "[",
+		0xDC: "\\",
+		0xDD: "]",
+		0xDE: "'",
+		0xE2: "\\",
+	},
+	LayoutUK: {
+		0xBA: ";",
+		0xBB: "=",
+		0xBC: ",",
+		0xBD: "-",
+		0xBE: ".",
+		0xBF: "/",
+		0xC0: "'",
+		0xDB: "[",
+		0xDC: "\\",
+		0xDD: "]",
+		0xDE: "#",
+		0xDF: "`",
+		0xE2: "\\",
+	},
+	LayoutNordic: {
+		0xBA: "¨",
+		0xBB: "+",
+		0xBC: ",",
+		0xBD: "-",
+		0xBE: ".",
+		0xBF: "'",
+		0xC0: "ö",
+		0xDB: "´",
+		0xDC: "§",
+		0xDD: "å",
+		0xDE: "ä",
+		0xE2: "<",
+	},
+}
+
+// keyCodeToString converts a Windows virtual-key code to the same names the
+// macOS keycodes map to, the OEM keys named after layout
+func keyCodeToString(keycode int64, layout KeyboardLayout) string {
+	switch {
+	case keycode >= 0x41 && keycode <= 0x5A: // VK_A - VK_Z
+		return string(rune('a' + keycode - 0x41))
+	case keycode >= 0x30 && keycode <= 0x39: // VK_0 - VK_9
+		return string(rune('0' + keycode - 0x30))
+	case keycode >= 0x60 && keycode <= 0x69: // VK_NUMPAD0 - VK_NUMPAD9
+		return fmt.Sprintf("keypad_%d", keycode-0x60)
+	case keycode >= 0x70 && keycode <= 0x82: // VK_F1 - VK_F19
+		return fmt.Sprintf("f%d", keycode-0x6F)
+	}
+
+	if str, ok := layoutVirtualKeys[layout][keycode]; ok {
+		return str
+	}
+
+	vkMap := map[int64]string{
+		0x08: "delete",
+		0x09: "tab",
+		0x0D: "return",
+		0x14: "capslock",
+		0x1B: "escape",
+		0x20: "space",
+		0x21: "page_up",
+		0x22: "page_down",
+		0x23: "end",
+		0x24: "home",
+		0x25: "left_arrow",
+		0x26: "up_arrow",
+		0x27: "right_arrow",
+		0x28: "down_arrow",
+		0x2E: "forward_delete",
+		0x2F: "help",
+		0x5B: "command",
+		0x5C: "command",
+		0x6A: "keypad_multiply",
+		0x6B: "keypad_plus",
+		0x6D: "keypad_minus",
+		0x6E: "keypad_decimal",
+		0x6F: "keypad_divide",
+		0xA0: "shift",
+		0xA1: "right_shift",
+		0xA2: "control",
+		0xA3: "right_control",
+		0xA4: "option",
+		0xA5: "right_option",
+	}
+
+	if str, ok := vkMap[keycode]; ok {
+		return str
+	}
+	return fmt.Sprintf("key_%d", keycode)
+}
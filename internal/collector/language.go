@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shebangPeekSize is how much of a file is read to find its shebang line
+const shebangPeekSize = 128
+
+// defaultFilenameLanguages maps the names of files without a telling
+// extension to the language they are recorded as
+var defaultFilenameLanguages = map[string]string{
+	"Dockerfile":  "dockerfile",
+	"Makefile":    "make",
+	"makefile":    "make",
+	"GNUmakefile": "make",
+	"Rakefile":    "ruby",
+	"Gemfile":     "ruby",
+	"Vagrantfile": "ruby",
+}
+
+// shebangLanguages maps the interpreters named in a shebang line, without
+// any version suffix, to a language
+var shebangLanguages = map[string]string{
+	"sh":     "shell",
+	"bash":   "shell",
+	"zsh":    "shell",
+	"dash":   "shell",
+	"ksh":    "shell",
+	"fish":   "shell",
+	"python": "python",
+	"ruby":   "ruby",
+	"node":   "javascript",
+	"perl":   "perl",
+}
+
+// shebangLanguage returns the language of the interpreter in the shebang
+// line of the file at path, e.g. "python" for "#!/usr/bin/env python3", or
+// "" if it has none or it can't be read
+func shebangLanguage(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReaderSize(f, shebangPeekSize).Peek(shebangPeekSize)
+	if len(line) == 0 && err != nil {
+		return ""
+	}
+	if i := strings.IndexByte(string(line), '\n'); i >= 0 {
+		line = line[:i]
+	}
+	if !strings.HasPrefix(string(line), "#!") {
+		return ""
+	}
+
+	fields := strings.Fields(string(line[2:]))
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+
+	// env runs the first argument that isn't a flag or variable
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = filepath.Base(field)
+				break
+			}
+		}
+	}
+
+	// python3.12 is python
+	return shebangLanguages[strings.TrimRight(interpreter, "0123456789.")]
+}
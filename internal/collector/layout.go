@@ -0,0 +1,25 @@
+package collector
+
+// KeyboardLayout selects the names of the keys whose character differs
+// between layouts, e.g. the key right of "l" is "ö" on a Nordic keyboard and
+// ";" on a US one. Letters, digits and named keys are the same in all of them.
+type KeyboardLayout string
+
+// Supported keyboard layouts
+const (
+	LayoutUS     KeyboardLayout = "us"
+	LayoutUK     KeyboardLayout = "uk"
+	LayoutNordic KeyboardLayout = "nordic"
+)
+
+// DefaultKeyboardLayout is the layout keys were named by before it could be
+// chosen, so existing stats keep their key names
+const DefaultKeyboardLayout = LayoutNordic
+
+// WithKeyboardLayout names the layout dependent keys after layout instead
+// of DefaultKeyboardLayout
+func WithKeyboardLayout(layout KeyboardLayout) KeypressOption {
+	return func(kc *KeypressCollector) {
+		kc.layout = layout
+	}
+}
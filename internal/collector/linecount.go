@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// maxCachedLineCounts bounds how many files' line counts are remembered
+const maxCachedLineCounts = 10000
+
+// lineCache remembers the last known line count of each changed file so a
+// change can be recorded as a line delta
+type lineCache struct {
+	mu     sync.Mutex
+	counts map[string]int
+	max    int
+}
+
+func newLineCache(max int) *lineCache {
+	return &lineCache{
+		counts: make(map[string]int),
+		max:    max,
+	}
+}
+
+// delta returns the change in line count for path since it was last seen.
+// A created file counts all its lines, a removed file counts its previous
+// lines as negative, and a file written for the first time counts as 0
+// since its previous size is unknown.
+func (c *lineCache) delta(path string, op fsnotify.Op) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, known := c.counts[path]
+
+	current, err := countLines(path)
+	if err != nil {
+		// The file is gone (or unreadable), so everything we knew about was removed
+		delete(c.counts, path)
+		if op&fsnotify.Remove == fsnotify.Remove || op&fsnotify.Rename == fsnotify.Rename {
+			return -previous
+		}
+		return 0
+	}
+
+	c.set(path, current)
+
+	switch {
+	case known:
+		return current - previous
+	case op&fsnotify.Create == fsnotify.Create:
+		return current
+	default:
+		return 0
+	}
+}
+
+// set stores a count, evicting an arbitrary entry when the cache is full
+func (c *lineCache) set(path string, count int) {
+	if _, ok := c.counts[path]; !ok && len(c.counts) >= c.max {
+		for evict := range c.counts {
+			delete(c.counts, evict)
+			break
+		}
+	}
+	c.counts[path] = count
+}
+
+// countLines returns the number of lines in the file at path
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 32*1024)
+	count := 0
+	var last byte
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			count += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Count a trailing line without a newline
+	if last != 0 && last != '\n' {
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/metrics"
+	"github.com/nilszeilon/devstats/internal/storage"
+)
+
+var (
+	globalMouseCallback *MouseClickCollector
+	mouseCallbackMutex  sync.Mutex
+)
+
+// MouseClickCollector handles collection of mouse click data. Clicks are
+// only collected on macOS.
+type MouseClickCollector struct {
+	store      storage.Store[domain.MouseClickData]
+	stopChan   chan struct{}
+	buttonChan chan int64
+}
+
+// NewMouseClickCollector creates a new mouse click collector
+func NewMouseClickCollector(store storage.Store[domain.MouseClickData]) *MouseClickCollector {
+	return &MouseClickCollector{
+		store:    store,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// buttonToString converts a macOS mouse button number to a string representation
+func buttonToString(button int64) string {
+	switch button {
+	case 0:
+		return "left"
+	case 1:
+		return "right"
+	case 2:
+		return "middle"
+	default:
+		return fmt.Sprintf("button_%d", button)
+	}
+}
+
+// Start begins collecting mouse click data
+func (mc *MouseClickCollector) Start() error {
+	mc.buttonChan = make(chan int64, 100)
+
+	go func() {
+		for {
+			select {
+			case <-mc.stopChan:
+				return
+			case button := <-mc.buttonChan:
+				data := domain.MouseClickData{
+					Button:    buttonToString(button),
+					Host:      hostname,
+					Timestamp: time.Now(),
+				}
+
+				if err := mc.store.Save(data); err != nil {
+					log.Printf("Error saving mouse click: %v", err)
+				} else {
+					metrics.MouseClicksTotal.WithLabelValues(data.Button).Inc()
+				}
+			}
+		}
+	}()
+
+	// Register this collector as the global callback handler
+	mouseCallbackMutex.Lock()
+	globalMouseCallback = mc
+	mouseCallbackMutex.Unlock()
+
+	return startMouseHook()
+}
+
+// Stop stops collecting mouse click data
+func (mc *MouseClickCollector) Stop() {
+	mouseCallbackMutex.Lock()
+	if globalMouseCallback == mc {
+		globalMouseCallback = nil
+	}
+	mouseCallbackMutex.Unlock()
+	close(mc.stopChan)
+}
@@ -0,0 +1,55 @@
+package collector
+
+import "unsafe"
+
+// #cgo CFLAGS: -x objective-c
+// #cgo LDFLAGS: -framework Cocoa -framework ApplicationServices
+// #import <ApplicationServices/ApplicationServices.h>
+// void external_go_mouse_callback(void*, int64_t);
+//
+// static CGEventRef mouseEventCallback(CGEventTapProxy proxy, CGEventType type, CGEventRef event, void *refcon) {
+//     if (type == kCGEventLeftMouseDown || type == kCGEventRightMouseDown || type == kCGEventOtherMouseDown) {
+//         int64_t button = CGEventGetIntegerValueField(event, kCGMouseEventButtonNumber);
+//         external_go_mouse_callback(refcon, button);
+//     }
+//     return event;
+// }
+//
+// static void startMouseEventTap(void* callback) {
+//     CGEventMask mask = CGEventMaskBit(kCGEventLeftMouseDown) |
+//                        CGEventMaskBit(kCGEventRightMouseDown) |
+//                        CGEventMaskBit(kCGEventOtherMouseDown);
+//     CFMachPortRef tap = CGEventTapCreate(
+//         kCGSessionEventTap,
+//         kCGHeadInsertEventTap,
+//         kCGEventTapOptionDefault,
+//         mask,
+//         mouseEventCallback,
+//         callback
+//     );
+//
+//     if (!tap) {
+//         return;
+//     }
+//
+//     CFRunLoopSourceRef runLoopSource = CFMachPortCreateRunLoopSource(kCFAllocatorDefault, tap, 0);
+//     CFRunLoopAddSource(CFRunLoopGetCurrent(), runLoopSource, kCFRunLoopCommonModes);
+//     CGEventTapEnable(tap, true);
+//     CFRunLoopRun();
+// }
+import "C"
+
+//export external_go_mouse_callback
+func external_go_mouse_callback(_ unsafe.Pointer, button int64) {
+	mouseCallbackMutex.Lock()
+	if globalMouseCallback != nil && globalMouseCallback.buttonChan != nil {
+		globalMouseCallback.buttonChan <- button
+	}
+	mouseCallbackMutex.Unlock()
+}
+
+// startMouseHook starts the event tap in a separate goroutine
+func startMouseHook() error {
+	go C.startMouseEventTap(nil)
+	return nil
+}
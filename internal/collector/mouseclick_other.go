@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package collector
+
+import "log"
+
+// startMouseHook only logs, there is no mouse hook for this platform yet
+func startMouseHook() error {
+	log.Println("Mouse clicks are not collected on this platform")
+	return nil
+}
@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket allows rate events per second on average, with bursts of up to
+// a second's worth
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// languageLimiter rate limits changes separately per language, so a burst of
+// generated Go files doesn't crowd out edits in other languages
+type languageLimiter struct {
+	rate float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newLanguageLimiter(rate float64) *languageLimiter {
+	return &languageLimiter{
+		rate:    rate,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow reports whether a change in language at t is within the limit and
+// takes a token for it if so
+func (l *languageLimiter) allow(language string, t time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[language]
+	if !ok {
+		b = &tokenBucket{tokens: l.rate, last: t}
+		l.buckets[language] = b
+	}
+
+	// Changes can be recorded slightly out of order, time never runs backwards
+	if elapsed := t.Sub(b.last); elapsed > 0 {
+		b.tokens = min(l.rate, b.tokens+elapsed.Seconds()*l.rate)
+		b.last = t
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,240 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/metrics"
+	"github.com/nilszeilon/devstats/internal/storage"
+)
+
+// historyFiles are the shell history files looked for in the home directory, in order
+var historyFiles = []string{".zsh_history", ".bash_history"}
+
+// ShellHistoryCollector records the commands appended to a shell history file
+type ShellHistoryCollector struct {
+	store    storage.Store[domain.CommandData]
+	watcher  *fsnotify.Watcher
+	stopChan chan struct{}
+	path     string
+	offset   int64
+
+	// stamp is the time of a bash "#<epoch>" line, used for the command after it
+	stamp time.Time
+	// continued is set while reading the lines of a multi-line command
+	continued bool
+}
+
+// NewShellHistoryCollector creates a collector for the history file at path,
+// or for ~/.zsh_history or ~/.bash_history if path is empty
+func NewShellHistoryCollector(store storage.Store[domain.CommandData], path string) (*ShellHistoryCollector, error) {
+	if path == "" {
+		var err error
+		if path, err = findHistoryFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ShellHistoryCollector{
+		store:    store,
+		watcher:  watcher,
+		stopChan: make(chan struct{}),
+		path:     path,
+	}, nil
+}
+
+// findHistoryFile returns the first history file that exists in the home directory
+func findHistoryFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range historyFiles {
+		path := filepath.Join(home, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("no shell history found in %s", home)
+}
+
+// Start begins watching the history file for new commands
+func (sc *ShellHistoryCollector) Start() error {
+	// Only commands run from now on are recorded
+	info, err := os.Stat(sc.path)
+	if err != nil {
+		return fmt.Errorf("error reading shell history %s: %v", sc.path, err)
+	}
+	sc.offset = info.Size()
+
+	// Shells may replace the file when trimming it, so the directory is watched
+	// to keep following the new file
+	if err := sc.watcher.Add(filepath.Dir(sc.path)); err != nil {
+		return fmt.Errorf("error watching shell history %s: %v", sc.path, err)
+	}
+
+	go sc.watch()
+	return nil
+}
+
+func (sc *ShellHistoryCollector) watch() {
+	for {
+		select {
+		case <-sc.stopChan:
+			return
+		case event, ok := <-sc.watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Name != sc.path || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+
+			if err := sc.readNewCommands(); err != nil {
+				log.Printf("Error reading shell history %s: %v", sc.path, err)
+			}
+
+		case err, ok := <-sc.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Watcher error: %v", err)
+		}
+	}
+}
+
+// readNewCommands saves every command appended to the history since the last read
+func (sc *ShellHistoryCollector) readNewCommands() error {
+	f, err := os.Open(sc.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// The history was rewritten (e.g. trimmed to HISTSIZE), start over from its end
+	if info.Size() < sc.offset {
+		sc.offset = info.Size()
+		sc.continued = false
+		return nil
+	}
+
+	if _, err := f.Seek(sc.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Leave partially written lines for the next event
+			break
+		}
+		sc.offset += int64(len(line))
+
+		data, ok := sc.parseLine(strings.TrimRight(line, "\r\n"))
+		if !ok {
+			continue
+		}
+
+		if err := sc.store.Save(data); err != nil {
+			log.Printf("Error saving command: %v", err)
+		} else {
+			metrics.CommandsTotal.Inc()
+		}
+	}
+
+	return nil
+}
+
+// parseLine parses a history line and reports whether it starts a command.
+// Lines continuing a multi-line command are skipped.
+func (sc *ShellHistoryCollector) parseLine(line string) (domain.CommandData, bool) {
+	continuation := sc.continued
+	sc.continued = strings.HasSuffix(line, "\\")
+	if continuation {
+		return domain.CommandData{}, false
+	}
+
+	// bash writes "#<epoch>" before each command when HISTTIMEFORMAT is set
+	if epoch, found := strings.CutPrefix(line, "#"); found {
+		if unix, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			sc.stamp = time.Unix(unix, 0)
+			return domain.CommandData{}, false
+		}
+	}
+
+	timestamp, command := parseHistoryLine(line)
+	if timestamp.IsZero() {
+		timestamp = sc.stamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+	}
+	sc.stamp = time.Time{}
+
+	if command == "" {
+		return domain.CommandData{}, false
+	}
+
+	return domain.CommandData{
+		Command:   command,
+		Host:      hostname,
+		Timestamp: timestamp,
+	}, true
+}
+
+// parseHistoryLine returns the program name of a history line, either plain
+// or in zsh's extended ": <epoch>:<duration>;<command>" format, together with
+// its time if the line has one
+func parseHistoryLine(line string) (time.Time, string) {
+	var timestamp time.Time
+
+	if rest, found := strings.CutPrefix(line, ": "); found {
+		if header, command, found := strings.Cut(rest, ";"); found {
+			epoch, _, _ := strings.Cut(header, ":")
+			if unix, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+				timestamp = time.Unix(unix, 0)
+				line = command
+			}
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return timestamp, ""
+	}
+	return timestamp, fields[0]
+}
+
+// Stop stops watching the history file
+func (sc *ShellHistoryCollector) Stop() {
+	close(sc.stopChan)
+	sc.watcher.Close()
+}
@@ -0,0 +1,53 @@
+package collector
+
+import "fmt"
+
+// tapStatus is a change in the macOS keyboard event tap, reported by the C
+// side of keypress_darwin.go. The values match its TAP_ defines.
+type tapStatus int64
+
+const (
+	tapRunning tapStatus = iota
+	tapCreateFailed
+	tapReenabledAfterTimeout
+	tapReenabledAfterUserInput
+	tapReenableFailed
+)
+
+// tapHealth is the state of the event tap as far as its status reports tell.
+// It is kept apart from the cgo callback so its transitions can be tested
+// on any platform.
+type tapHealth struct {
+	// healthy is whether the tap is delivering keypresses
+	healthy bool
+	// reenabled counts how often the system disabled the tap and it was
+	// turned back on
+	reenabled int
+}
+
+// next returns the state after status, and a message to log about the
+// change, empty if there is nothing to report. Unknown statuses leave the
+// state alone.
+func (h tapHealth) next(status tapStatus) (tapHealth, string) {
+	switch status {
+	case tapRunning:
+		h.healthy = true
+		return h, ""
+	case tapCreateFailed:
+		h.healthy = false
+		return h, "ERROR: could not create the keyboard event tap, is accessibility access granted?"
+	case tapReenabledAfterTimeout:
+		h.healthy = true
+		h.reenabled++
+		return h, fmt.Sprintf("Keyboard event tap was disabled by a timeout, re-enabled it (%d times so far)", h.reenabled)
+	case tapReenabledAfterUserInput:
+		h.healthy = true
+		h.reenabled++
+		return h, fmt.Sprintf("Keyboard event tap was disabled by user input, re-enabled it (%d times so far)", h.reenabled)
+	case tapReenableFailed:
+		h.healthy = false
+		return h, "ERROR: keyboard event tap was disabled by the system and could not be re-enabled"
+	default:
+		return h, fmt.Sprintf("Unknown keyboard event tap status %d", status)
+	}
+}
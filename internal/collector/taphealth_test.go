@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTapHealthTransitions(t *testing.T) {
+	steps := []struct {
+		status        tapStatus
+		wantHealthy   bool
+		wantReenabled int
+		wantMessage   string
+	}{
+		{tapRunning, true, 0, ""},
+		{tapReenabledAfterTimeout, true, 1, "disabled by a timeout"},
+		{tapReenabledAfterUserInput, true, 2, "disabled by user input"},
+		{tapReenableFailed, false, 2, "could not be re-enabled"},
+		// An unknown status changes nothing
+		{tapStatus(42), false, 2, "Unknown"},
+		{tapRunning, true, 2, ""},
+		{tapCreateFailed, false, 2, "could not create"},
+	}
+
+	var health tapHealth
+	for i, step := range steps {
+		var message string
+		health, message = health.next(step.status)
+		if health.healthy != step.wantHealthy {
+			t.Errorf("step %d (status %d): healthy = %t, want %t", i, step.status, health.healthy, step.wantHealthy)
+		}
+		if health.reenabled != step.wantReenabled {
+			t.Errorf("step %d (status %d): reenabled = %d, want %d", i, step.status, health.reenabled, step.wantReenabled)
+		}
+		if step.wantMessage == "" && message != "" {
+			t.Errorf("step %d (status %d): logged %q, want nothing", i, step.status, message)
+		}
+		if !strings.Contains(message, step.wantMessage) {
+			t.Errorf("step %d (status %d): logged %q, want it to mention %q", i, step.status, message, step.wantMessage)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Names of the databases inside the data directory
+const (
+	DBFileName     = "devstats.db"
+	AnonDBFileName = "devstats_anon.db"
+)
+
+// DataTypes are the keys accepted in Intervals, one per anonymized data type
+var DataTypes = []string{"keypresses", "key_sequences", "key_chords", "file_changes", "mouse_clicks", "app_focus", "commits", "commands", "sessions"}
+
+// KeyboardLayouts are the values accepted in KeyboardLayout
+var KeyboardLayouts = []string{"us", "uk", "nordic"}
+
+// Config holds the user settings read from the config file
+type Config struct {
+	// Paths are the directories watched for file changes and commits
+	Paths []string `json:"paths"`
+	// Projects are watched like Paths, but changes are attributed to the
+	// project and each may skip its own directories
+	Projects []Project `json:"projects"`
+	// FollowSymlinks descends into symlinked directories while watching
+	FollowSymlinks bool `json:"follow_symlinks"`
+	// DedupeWindow drops a file change that repeats the previous one for the
+	// same file within this window, e.g. "2s". Zero keeps every change.
+	DedupeWindow Duration `json:"dedupe_window"`
+	// FileChangeRateLimit is the most file changes recorded per second for
+	// each language, the rest are dropped. Zero records every change.
+	FileChangeRateLimit float64 `json:"file_change_rate_limit"`
+	// MaxWatchedDirs caps the number of directories watched for file changes
+	MaxWatchedDirs int `json:"max_watched_dirs"`
+	// Timezone is the IANA name of the zone whose midnight starts a day,
+	// e.g. "Europe/Stockholm". Defaults to the system time zone.
+	Timezone string `json:"timezone"`
+	// KeyboardLayout names the punctuation keys after the "us", "uk" or
+	// "nordic" layout
+	KeyboardLayout string `json:"keyboard_layout"`
+	// KeypressCountOnly only counts keypresses per interval, the keys are
+	// never written to disk
+	KeypressCountOnly bool `json:"keypress_count_only"`
+	// KeypressSampleRate saves only this random fraction of keypresses, e.g.
+	// 0.25 on battery. The anonymized counts are scaled back up.
+	KeypressSampleRate float64 `json:"keypress_sample_rate"`
+	// KeySequences records pairs of keys typed right after each other
+	KeySequences bool `json:"key_sequences"`
+	// KeySequenceWindow is the longest pause between the keys of a pair, e.g. "300ms"
+	KeySequenceWindow Duration `json:"key_sequence_window"`
+	// KeyChords records chords like "cmd+k cmd+s", a leader shortcut
+	// followed by another key
+	KeyChords bool `json:"key_chords"`
+	// KeyChordLeaders are the shortcuts that start a chord
+	KeyChordLeaders []string `json:"key_chord_leaders"`
+	// KeyChordTimeout is the longest wait for the key after the leader, e.g. "1s"
+	KeyChordTimeout Duration `json:"key_chord_timeout"`
+	// Interval is how often raw data is anonymized, e.g. "10m"
+	Interval Duration `json:"interval"`
+	// Intervals overrides Interval per data type, e.g. {"file_changes": "1h"}.
+	// The keys are listed in DataTypes.
+	Intervals map[string]Duration `json:"intervals"`
+	// SessionIdleGap is the pause in typing that ends a coding session, e.g. "5m"
+	SessionIdleGap Duration `json:"session_idle_gap"`
+	// RawRetention deletes raw data older than this once it has been
+	// anonymized, e.g. "168h". Zero keeps raw data forever.
+	RawRetention Duration `json:"raw_retention"`
+	// DBPath is where the raw data is stored, by default in DataDir
+	DBPath string `json:"db_path"`
+	// AnonDBPath is where the anonymized stats are stored, by default in DataDir
+	AnonDBPath string `json:"anon_db_path"`
+	// AnonExportDir additionally writes each day's anonymized keypress and
+	// file change stats to a JSON file per type in this directory, e.g.
+	// keypresses-2024-06-01.json. Empty disables it.
+	AnonExportDir string `json:"anon_export_dir"`
+	// Notify sends a weekly summary to a webhook or by email
+	Notify NotifyConfig `json:"notify"`
+	// ControlSocket is the Unix socket collect listens on for commands like
+	// pause and resume. Empty disables it.
+	ControlSocket string `json:"control_socket"`
+	// BlacklistDirs are extra directory names skipped when watching
+	BlacklistDirs []string `json:"blacklist_dirs"`
+	// ExtensionLanguages maps extra file extensions (including the dot) to a language
+	ExtensionLanguages map[string]string `json:"extension_languages"`
+	// FilenameLanguages maps extra file names, e.g. "Justfile", to a language
+	FilenameLanguages map[string]string `json:"filename_languages"`
+}
+
+// Project is a directory tree tracked as one project
+type Project struct {
+	// Name defaults to the directory name
+	Name          string   `json:"name"`
+	Path          string   `json:"path"`
+	BlacklistDirs []string `json:"blacklist_dirs"`
+}
+
+// NotifyConfig sets where and when the weekly summary is sent. Nothing is
+// sent unless WebhookURL or SMTP is set.
+type NotifyConfig struct {
+	// WebhookURL receives the summary as a JSON POST
+	WebhookURL string `json:"webhook_url"`
+	// SMTP sends the summary by email
+	SMTP *SMTPConfig `json:"smtp"`
+	// Weekday and Hour are when the summary is sent, e.g. "monday" and 9
+	Weekday string `json:"weekday"`
+	Hour    int    `json:"hour"`
+}
+
+// SMTPConfig is the mail server the summary is sent through
+type SMTPConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// Enabled reports whether the summary is sent anywhere
+func (n NotifyConfig) Enabled() bool {
+	return n.WebhookURL != "" || n.SMTP != nil
+}
+
+// Day returns Weekday as a time.Weekday
+func (n NotifyConfig) Day() (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(n.Weekday, day.String()) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", n.Weekday)
+}
+
+// Validate checks that the summary can be scheduled and sent
+func (n NotifyConfig) Validate() error {
+	if _, err := n.Day(); err != nil {
+		return err
+	}
+	if n.Hour < 0 || n.Hour > 23 {
+		return errors.New("hour must be between 0 and 23")
+	}
+
+	if n.WebhookURL != "" {
+		u, err := url.Parse(n.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook_url %q must be an http or https URL", n.WebhookURL)
+		}
+	}
+
+	if n.SMTP != nil {
+		if n.SMTP.Host == "" || n.SMTP.Port <= 0 {
+			return errors.New("smtp needs a host and port")
+		}
+		if n.SMTP.From == "" || len(n.SMTP.To) == 0 {
+			return errors.New("smtp needs a from address and at least one to address")
+		}
+	}
+
+	return nil
+}
+
+// Duration is a time.Duration that is written as a string like "10m" in JSON
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10m\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Default returns the settings used when no config file exists
+func Default() (Config, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	dataDir, err := DataDir()
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Config{
+		Paths:              []string{homeDir},
+		Interval:           Duration{10 * time.Minute},
+		SessionIdleGap:     Duration{5 * time.Minute},
+		MaxWatchedDirs:     1000,
+		KeyboardLayout:     "nordic",
+		KeypressSampleRate: 1,
+		KeySequenceWindow:  Duration{300 * time.Millisecond},
+		KeyChordLeaders:    []string{"cmd+k", "ctrl+k"},
+		KeyChordTimeout:    Duration{time.Second},
+		DBPath:             filepath.Join(dataDir, DBFileName),
+		AnonDBPath:         filepath.Join(dataDir, AnonDBFileName),
+		ControlSocket:      filepath.Join(homeDir, ".config", "devstats", "control.sock"),
+		Notify: NotifyConfig{
+			Weekday: "monday",
+			Hour:    9,
+		},
+	}, nil
+}
+
+// DefaultPath returns ~/.config/devstats/config.json
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".config", "devstats", "config.json"), nil
+}
+
+// DataDir returns $XDG_DATA_HOME/devstats, or ~/.local/share/devstats when
+// XDG_DATA_HOME is unset. The directory is not created.
+func DataDir() (string, error) {
+	// The spec says relative paths are invalid and should be ignored
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "devstats"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".local", "share", "devstats"), nil
+}
+
+// Load reads the config file at path on top of the defaults. A missing file
+// is not an error, the defaults are returned as is.
+func Load(path string) (Config, error) {
+	defaults, err := Default()
+	if err != nil {
+		return Config{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return defaults, nil
+		}
+		return Config{}, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := defaults
+	cfg.Paths = nil
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	// Only fall back to the home directory if nothing is watched at all
+	if len(cfg.Paths) == 0 && len(cfg.Projects) == 0 {
+		cfg.Paths = defaults.Paths
+	}
+
+	for i, p := range cfg.Paths {
+		if cfg.Paths[i], err = expandHome(p); err != nil {
+			return Config{}, err
+		}
+	}
+	for i, project := range cfg.Projects {
+		if cfg.Projects[i].Path, err = expandHome(project.Path); err != nil {
+			return Config{}, err
+		}
+	}
+	if cfg.DBPath, err = expandHome(cfg.DBPath); err != nil {
+		return Config{}, err
+	}
+	if cfg.AnonDBPath, err = expandHome(cfg.AnonDBPath); err != nil {
+		return Config{}, err
+	}
+	if cfg.ControlSocket, err = expandHome(cfg.ControlSocket); err != nil {
+		return Config{}, err
+	}
+	if cfg.AnonExportDir, err = expandHome(cfg.AnonExportDir); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate checks that the settings are usable
+func (c Config) Validate() error {
+	if len(c.Paths) == 0 && len(c.Projects) == 0 {
+		return errors.New("paths or projects must not be empty")
+	}
+	for _, p := range c.Paths {
+		if err := checkDir(p); err != nil {
+			return err
+		}
+	}
+	for _, project := range c.Projects {
+		if project.Path == "" {
+			return fmt.Errorf("project %q has no path", project.Name)
+		}
+		if err := checkDir(project.Path); err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.Location(); err != nil {
+		return err
+	}
+
+	if c.DedupeWindow.Duration < 0 {
+		return errors.New("dedupe_window must not be negative")
+	}
+	if c.FileChangeRateLimit < 0 {
+		return errors.New("file_change_rate_limit must not be negative")
+	}
+	if c.MaxWatchedDirs <= 0 {
+		return errors.New("max_watched_dirs must be positive")
+	}
+	if !slices.Contains(KeyboardLayouts, c.KeyboardLayout) {
+		return fmt.Errorf("unknown keyboard_layout %q, expected one of: %s", c.KeyboardLayout, strings.Join(KeyboardLayouts, ", "))
+	}
+	if c.KeypressSampleRate <= 0 || c.KeypressSampleRate > 1 {
+		return errors.New("keypress_sample_rate must be above 0 and at most 1")
+	}
+	if c.KeypressCountOnly && c.KeypressSampleRate < 1 {
+		return errors.New("keypress_sample_rate can't be combined with keypress_count_only, which saves no keypresses to sample")
+	}
+	if c.KeypressCountOnly && c.KeySequences {
+		return errors.New("key_sequences records keys, it can't be combined with keypress_count_only")
+	}
+	if c.KeySequences && c.KeySequenceWindow.Duration <= 0 {
+		return errors.New("key_sequence_window must be positive")
+	}
+	if c.KeypressCountOnly && c.KeyChords {
+		return errors.New("key_chords records keys, it can't be combined with keypress_count_only")
+	}
+	if c.KeyChords && len(c.KeyChordLeaders) == 0 {
+		return errors.New("key_chord_leaders must not be empty")
+	}
+	if c.KeyChords && c.KeyChordTimeout.Duration <= 0 {
+		return errors.New("key_chord_timeout must be positive")
+	}
+
+	if c.Interval.Duration <= 0 {
+		return errors.New("interval must be positive")
+	}
+	for name, interval := range c.Intervals {
+		if !slices.Contains(DataTypes, name) {
+			return fmt.Errorf("unknown data type %q in intervals, expected one of: %s", name, strings.Join(DataTypes, ", "))
+		}
+		if interval.Duration <= 0 {
+			return fmt.Errorf("interval of %s must be positive", name)
+		}
+	}
+	if c.SessionIdleGap.Duration <= 0 {
+		return errors.New("session_idle_gap must be positive")
+	}
+	// Raw data must outlive the intervals or it would be deleted before it is anonymized
+	if c.RawRetention.Duration < 0 || (c.RawRetention.Duration > 0 && c.RawRetention.Duration < 2*c.longestInterval()) {
+		return errors.New("raw_retention must be zero or at least twice the longest interval")
+	}
+
+	if c.DBPath == "" {
+		return errors.New("db_path must not be empty")
+	}
+	if c.AnonDBPath == "" {
+		return errors.New("anon_db_path must not be empty")
+	}
+
+	if err := c.Notify.Validate(); err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+
+	for ext := range c.ExtensionLanguages {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("extension %q must start with a dot", ext)
+		}
+	}
+	for name := range c.FilenameLanguages {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("file name %q must be a plain name without a directory", name)
+		}
+	}
+
+	return nil
+}
+
+// IntervalFor returns how often the data type name is anonymized
+func (c Config) IntervalFor(name string) time.Duration {
+	if interval, ok := c.Intervals[name]; ok {
+		return interval.Duration
+	}
+	return c.Interval.Duration
+}
+
+// longestInterval returns the longest interval of any data type
+func (c Config) longestInterval() time.Duration {
+	longest := c.Interval.Duration
+	for _, interval := range c.Intervals {
+		longest = max(longest, interval.Duration)
+	}
+	return longest
+}
+
+// Location returns the time zone named by Timezone, or time.Local if it is empty
+func (c Config) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("timezone %q: %w", c.Timezone, err)
+	}
+	return loc, nil
+}
+
+// checkDir makes sure a watched path is an existing directory
+func checkDir(p string) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf("watched path %q: %w", p, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("watched path %q is not a directory", p)
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, p[1:]), nil
+}
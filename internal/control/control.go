@@ -0,0 +1,223 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/version"
+)
+
+// Commands understood by the control socket
+const (
+	CommandStatus = "status"
+	CommandPause  = "pause"
+	CommandResume = "resume"
+	CommandFlush  = "flush"
+)
+
+// Request is a single command, sent as one line of JSON
+type Request struct {
+	Command string `json:"command"`
+}
+
+// Response answers a Request, also as one line of JSON
+type Response struct {
+	OK     bool    `json:"ok"`
+	Error  string  `json:"error,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
+
+// Status describes the running daemon
+type Status struct {
+	StartedAt           time.Time `json:"started_at"`
+	Paused              bool      `json:"paused"`
+	KeypressHookHealthy bool      `json:"keypress_hook_healthy"`
+	WatchedDirs         int       `json:"watched_dirs"`
+	WatchLimitReached   bool      `json:"watch_limit_reached"`
+	// SkippedDirs were left unwatched because a limit was reached
+	SkippedDirs int `json:"skipped_dirs"`
+	// WatchSystemLimitReached is set once the OS refused more watches
+	WatchSystemLimitReached bool `json:"watch_system_limit_reached"`
+	// Version is the daemon's build, which may differ from the CLI's
+	Version version.Info `json:"version"`
+	// Events counts what was recorded since start, by kind
+	Events map[string]int64 `json:"events"`
+}
+
+// Handlers carry out the commands in the daemon
+type Handlers struct {
+	Status func() Status
+	Pause  func()
+	Resume func()
+	// Flush runs an anonymization pass and returns once it is done
+	Flush func() error
+}
+
+// Server accepts commands on a Unix domain socket
+type Server struct {
+	listener net.Listener
+	handlers Handlers
+	path     string
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// Listen creates the socket at path and serves commands in the background.
+// A socket left behind by a daemon that did not shut down cleanly is replaced.
+func Listen(path string, handlers Handlers) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use, is devstats already running?", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	// Anyone who can connect can pause the collectors
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+
+	s := &Server{
+		listener: listener,
+		handlers: handlers,
+		path:     path,
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.accept()
+
+	return s, nil
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error accepting control connection: %v", err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+// serve answers the commands of a connection, one line each, until it is closed
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req Request
+		var resp Response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = Response{Error: fmt.Sprintf("invalid request: %v", err)}
+		} else {
+			resp = s.handle(req)
+		}
+
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(req Request) Response {
+	switch req.Command {
+	case CommandStatus:
+		status := s.handlers.Status()
+		return Response{OK: true, Status: &status}
+	case CommandPause:
+		s.handlers.Pause()
+		log.Println("Collectors paused")
+		return Response{OK: true}
+	case CommandResume:
+		s.handlers.Resume()
+		log.Println("Collectors resumed")
+		return Response{OK: true}
+	case CommandFlush:
+		if err := s.handlers.Flush(); err != nil {
+			return Response{Error: err.Error()}
+		}
+		return Response{OK: true}
+	default:
+		return Response{Error: fmt.Sprintf("unknown command %q", req.Command)}
+	}
+}
+
+// Close stops accepting commands, closes open connections and removes the socket
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	os.Remove(s.path)
+	return err
+}
+
+// Send sends a command to the daemon listening on the socket at path and
+// returns its response. A command the daemon refused is returned as an error.
+func Send(path, command string) (Response, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to connect to %s, is devstats collect running? %w", path, err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(Request{Command: command}); err != nil {
+		return Response{}, fmt.Errorf("failed to send command: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return Response{}, fmt.Errorf("failed to read response: %w", err)
+	}
+	if !resp.OK {
+		return resp, fmt.Errorf("%s failed: %s", command, resp.Error)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+type AppFocusData struct {
+	AppName   string    `json:"app_name" sql:"TEXT NOT NULL"`
+	Host      string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+}
+
+// AppFocusAnonymousStats represents anonymized focus time per application
+type AppFocusAnonymousStats struct {
+	Timestamp    time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Host         string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	AppName      string    `json:"app_name" sql:"TEXT NOT NULL"`
+	FocusSeconds int64     `json:"focus_seconds" sql:"INTEGER NOT NULL"`
+}
+
+// TableName returns the custom table name for SQLite storage
+func (AppFocusData) TableName() string {
+	return "app_focus"
+}
+
+// TableName returns the custom table name for anonymous storage
+func (AppFocusAnonymousStats) TableName() string {
+	return "app_focus_anonymous"
+}
+
+// UniqueKey identifies the stats of an app on a host in an interval so re-running replaces them
+func (AppFocusAnonymousStats) UniqueKey() []string {
+	return []string{"timestamp", "host", "appname"}
+}
+
+// GetTimestamp implements the Anonymizable interface
+func (a AppFocusData) GetTimestamp() time.Time {
+	return a.Timestamp
+}
+
+// Anonymize implements the Anonymizable interface. Each record marks the
+// moment an app gained focus, so an app's focus time is the gap until the
+// next record from the same host. The last record's focus continues past the
+// records we were given, so it contributes no duration here.
+func (a AppFocusData) Anonymize(records []AppFocusData, intervalStart time.Time) ([]AppFocusAnonymousStats, error) {
+	// Sort a copy so the caller's slice is left untouched
+	focuses := append([]AppFocusData(nil), records...)
+
+	// Group by host so each host's focus changes follow each other
+	sort.SliceStable(focuses, func(i, j int) bool {
+		if focuses[i].Host != focuses[j].Host {
+			return focuses[i].Host < focuses[j].Host
+		}
+		return focuses[i].Timestamp.Before(focuses[j].Timestamp)
+	})
+
+	type hostApp struct{ host, app string }
+
+	// Sum focus duration per host and app
+	appDurations := make(map[hostApp]time.Duration)
+	for i := 0; i+1 < len(focuses); i++ {
+		if focuses[i].Host != focuses[i+1].Host {
+			continue
+		}
+		appDurations[hostApp{focuses[i].Host, focuses[i].AppName}] += focuses[i+1].Timestamp.Sub(focuses[i].Timestamp)
+	}
+
+	var stats []AppFocusAnonymousStats
+	for key, duration := range appDurations {
+		stats = append(stats, AppFocusAnonymousStats{
+			Timestamp:    intervalStart,
+			Host:         key.host,
+			AppName:      key.app,
+			FocusSeconds: int64(duration.Seconds()),
+		})
+	}
+
+	return stats, nil
+}
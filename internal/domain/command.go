@@ -0,0 +1,62 @@
+package domain
+
+import "time"
+
+// CommandData is a command run in a shell, reduced to the program name
+type CommandData struct {
+	Command   string    `json:"command" sql:"TEXT NOT NULL"`
+	Host      string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+}
+
+// CommandAnonymousStats represents anonymized statistics for shell commands per program
+type CommandAnonymousStats struct {
+	Timestamp         time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Host              string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Command           string    `json:"command" sql:"TEXT NOT NULL"`
+	InvocationsInSpan int64     `json:"invocations_in_span" sql:"INTEGER NOT NULL"`
+}
+
+// TableName returns the custom table name for SQLite storage
+func (CommandData) TableName() string {
+	return "commands"
+}
+
+// TableName returns the custom table name for anonymous storage
+func (CommandAnonymousStats) TableName() string {
+	return "commands_anonymous"
+}
+
+// UniqueKey identifies the stats of a command on a host in an interval so re-running replaces them
+func (CommandAnonymousStats) UniqueKey() []string {
+	return []string{"timestamp", "host", "command"}
+}
+
+// GetTimestamp implements the Anonymizable interface
+func (c CommandData) GetTimestamp() time.Time {
+	return c.Timestamp
+}
+
+// Anonymize implements the Anonymizable interface
+func (c CommandData) Anonymize(records []CommandData, intervalStart time.Time) ([]CommandAnonymousStats, error) {
+	type hostCommand struct{ host, command string }
+
+	// Map to count invocations per host and command
+	commandCounts := make(map[hostCommand]int64)
+
+	for _, command := range records {
+		commandCounts[hostCommand{command.Host, command.Command}]++
+	}
+
+	var stats []CommandAnonymousStats
+	for key, count := range commandCounts {
+		stats = append(stats, CommandAnonymousStats{
+			Timestamp:         intervalStart,
+			Host:              key.host,
+			Command:           key.command,
+			InvocationsInSpan: count,
+		})
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,62 @@
+package domain
+
+import "time"
+
+type CommitData struct {
+	Repo      string    `json:"repo" sql:"TEXT NOT NULL"`
+	Hash      string    `json:"hash" sql:"TEXT NOT NULL"`
+	Host      string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+}
+
+// CommitAnonymousStats represents anonymized statistics for commits per repository
+type CommitAnonymousStats struct {
+	Timestamp     time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Host          string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Repo          string    `json:"repo" sql:"TEXT NOT NULL"`
+	CommitsInSpan int64     `json:"commits_in_span" sql:"INTEGER NOT NULL"`
+}
+
+// TableName returns the custom table name for SQLite storage
+func (CommitData) TableName() string {
+	return "commits"
+}
+
+// TableName returns the custom table name for anonymous storage
+func (CommitAnonymousStats) TableName() string {
+	return "commits_anonymous"
+}
+
+// UniqueKey identifies the stats of a repository on a host in an interval so re-running replaces them
+func (CommitAnonymousStats) UniqueKey() []string {
+	return []string{"timestamp", "host", "repo"}
+}
+
+// GetTimestamp implements the Anonymizable interface
+func (c CommitData) GetTimestamp() time.Time {
+	return c.Timestamp
+}
+
+// Anonymize implements the Anonymizable interface
+func (c CommitData) Anonymize(records []CommitData, intervalStart time.Time) ([]CommitAnonymousStats, error) {
+	type hostRepo struct{ host, repo string }
+
+	// Map to count commits per host and repository
+	repoCounts := make(map[hostRepo]int64)
+
+	for _, commit := range records {
+		repoCounts[hostRepo{commit.Host, commit.Repo}]++
+	}
+
+	var stats []CommitAnonymousStats
+	for key, count := range repoCounts {
+		stats = append(stats, CommitAnonymousStats{
+			Timestamp:     intervalStart,
+			Host:          key.host,
+			Repo:          key.repo,
+			CommitsInSpan: count,
+		})
+	}
+
+	return stats, nil
+}
@@ -2,16 +2,42 @@ package domain
 
 import "time"
 
+// Change types of a FileChangeData
+const (
+	ChangeCreate = "create"
+	ChangeWrite  = "write"
+	ChangeRemove = "remove"
+)
+
 type FileChangeData struct {
-	Language  string    `json:"language" sql:"TEXT NOT NULL"`
-	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Project      string    `json:"project" sql:"TEXT NOT NULL DEFAULT ''"`
+	Language     string    `json:"language" sql:"TEXT NOT NULL" index:"true"`
+	ChangeType   string    `json:"change_type" sql:"TEXT NOT NULL DEFAULT ''"`
+	LinesChanged int       `json:"lines_changed" sql:"INTEGER NOT NULL DEFAULT 0"`
+	Host         string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Timestamp    time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
 }
 
-// FileChangeAnonymousStats represents anonymized statistics for file changes per language
+// FileChangeAnonymousStats represents anonymized statistics for file changes per host, project and language
 type FileChangeAnonymousStats struct {
 	Timestamp     time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
-	Language      string    `json:"language" sql:"TEXT NOT NULL"`
+	Host          string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Project       string    `json:"project" sql:"TEXT NOT NULL DEFAULT ''"`
+	Language      string    `json:"language" sql:"TEXT NOT NULL" index:"true"`
 	ChangesInSpan int64     `json:"changes_in_span" sql:"INTEGER NOT NULL"`
+	CreatesInSpan int64     `json:"creates_in_span" sql:"INTEGER NOT NULL DEFAULT 0"`
+	WritesInSpan  int64     `json:"writes_in_span" sql:"INTEGER NOT NULL DEFAULT 0"`
+	RemovesInSpan int64     `json:"removes_in_span" sql:"INTEGER NOT NULL DEFAULT 0"`
+	LinesInSpan   int64     `json:"lines_in_span" sql:"INTEGER NOT NULL DEFAULT 0"`
+}
+
+// FileChangeDailyStats represents file change totals per host and language for a whole day
+type FileChangeDailyStats struct {
+	Timestamp    time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Host         string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Language     string    `json:"language" sql:"TEXT NOT NULL"`
+	ChangesInDay int64     `json:"changes_in_day" sql:"INTEGER NOT NULL"`
+	LinesInDay   int64     `json:"lines_in_day" sql:"INTEGER NOT NULL"`
 }
 
 // TableName returns the custom table name for SQLite storage
@@ -24,32 +50,94 @@ func (FileChangeAnonymousStats) TableName() string {
 	return "file_changes_anonymous"
 }
 
+// UniqueKey identifies the stats of a host, project and language in an interval so re-running replaces them
+func (FileChangeAnonymousStats) UniqueKey() []string {
+	return []string{"timestamp", "host", "project", "language"}
+}
+
+// TableName returns the custom table name for daily storage
+func (FileChangeDailyStats) TableName() string {
+	return "file_changes_daily"
+}
+
+// UniqueKey identifies the stats of a host and language in a day so re-running replaces them
+func (FileChangeDailyStats) UniqueKey() []string {
+	return []string{"timestamp", "host", "language"}
+}
+
 // GetTimestamp implements the Anonymizable interface
 func (f FileChangeData) GetTimestamp() time.Time {
 	return f.Timestamp
 }
 
 // Anonymize implements the Anonymizable interface
-func (f FileChangeData) Anonymize(records []any, intervalStart time.Time) ([]FileChangeAnonymousStats, error) {
-	// Map to count changes per language
-	languageCounts := make(map[string]int64)
-
-	// Count changes for each language
-	for _, r := range records {
-		if change, ok := r.(FileChangeData); ok {
-			languageCounts[change.Language]++
+func (f FileChangeData) Anonymize(records []FileChangeData, intervalStart time.Time) ([]FileChangeAnonymousStats, error) {
+	type projectLanguage struct {
+		host     string
+		project  string
+		language string
+	}
+
+	// Count changes, broken down by type, and sum changed lines per host, project and language
+	counts := make(map[projectLanguage]*FileChangeAnonymousStats)
+
+	for _, change := range records {
+		key := projectLanguage{change.Host, change.Project, change.Language}
+		s, ok := counts[key]
+		if !ok {
+			s = &FileChangeAnonymousStats{
+				Timestamp: intervalStart,
+				Host:      key.host,
+				Project:   key.project,
+				Language:  key.language,
+			}
+			counts[key] = s
+		}
+
+		s.ChangesInSpan++
+		s.LinesInSpan += int64(change.LinesChanged)
+		switch change.ChangeType {
+		case ChangeCreate:
+			s.CreatesInSpan++
+		case ChangeWrite:
+			s.WritesInSpan++
+		case ChangeRemove:
+			s.RemovesInSpan++
 		}
 	}
 
 	// Convert to slice of anonymous stats
 	var stats []FileChangeAnonymousStats
-	for lang, count := range languageCounts {
-		stats = append(stats, FileChangeAnonymousStats{
-			Timestamp:     intervalStart,
-			Language:      lang,
-			ChangesInSpan: count,
-		})
+	for _, s := range counts {
+		stats = append(stats, *s)
 	}
 
 	return stats, nil
 }
+
+// Rollup implements the Rollupable interface
+func (f FileChangeAnonymousStats) Rollup(records []FileChangeAnonymousStats, dayStart time.Time) ([]FileChangeDailyStats, error) {
+	type hostLanguage struct{ host, language string }
+
+	languageChanges := make(map[hostLanguage]int64)
+	languageLines := make(map[hostLanguage]int64)
+
+	for _, stats := range records {
+		key := hostLanguage{stats.Host, stats.Language}
+		languageChanges[key] += stats.ChangesInSpan
+		languageLines[key] += stats.LinesInSpan
+	}
+
+	var daily []FileChangeDailyStats
+	for key, changes := range languageChanges {
+		daily = append(daily, FileChangeDailyStats{
+			Timestamp:    dayStart,
+			Host:         key.host,
+			Language:     key.language,
+			ChangesInDay: changes,
+			LinesInDay:   languageLines[key],
+		})
+	}
+
+	return daily, nil
+}
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// topKeyChords is how many of the most used chords of a host in an interval
+// are kept when anonymizing
+const topKeyChords = 20
+
+// KeyChordData is a chord like "cmd+k cmd+s": a leader shortcut followed
+// by another key
+type KeyChordData struct {
+	// Sequence is the leader and the key after it, separated by a space
+	Sequence  string    `json:"sequence" sql:"TEXT NOT NULL"`
+	Host      string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+}
+
+// KeyChordStats represents the anonymized count of a chord in an interval
+type KeyChordStats struct {
+	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Host      string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Sequence  string    `json:"sequence" sql:"TEXT NOT NULL"`
+	Count     int64     `json:"count" sql:"INTEGER NOT NULL"`
+}
+
+// TableName returns the custom table name for SQLite storage
+func (KeyChordData) TableName() string {
+	return "key_chords"
+}
+
+// TableName returns the custom table name for anonymous storage
+func (KeyChordStats) TableName() string {
+	return "key_chords_anonymous"
+}
+
+// UniqueKey identifies the stats of a chord on a host in an interval so re-running replaces them
+func (KeyChordStats) UniqueKey() []string {
+	return []string{"timestamp", "host", "sequence"}
+}
+
+// GetTimestamp implements the Anonymizable interface
+func (k KeyChordData) GetTimestamp() time.Time {
+	return k.Timestamp
+}
+
+// Anonymize implements the Anonymizable interface. Only the most used
+// chords of each host in the interval are kept.
+func (k KeyChordData) Anonymize(records []KeyChordData, intervalStart time.Time) ([]KeyChordStats, error) {
+	type hostChord struct{ host, sequence string }
+
+	// Map to count each chord per host
+	chordCounts := make(map[hostChord]int64)
+	for _, chord := range records {
+		chordCounts[hostChord{chord.Host, chord.Sequence}]++
+	}
+
+	stats := make([]KeyChordStats, 0, len(chordCounts))
+	for c, count := range chordCounts {
+		stats = append(stats, KeyChordStats{
+			Timestamp: intervalStart,
+			Host:      c.host,
+			Sequence:  c.sequence,
+			Count:     count,
+		})
+	}
+
+	// Grouped by host, most used first, ties broken by the chord so the cut is stable
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Host != stats[j].Host {
+			return stats[i].Host < stats[j].Host
+		}
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].Sequence < stats[j].Sequence
+	})
+
+	perHost := make(map[string]int)
+	kept := stats[:0]
+	for _, s := range stats {
+		if perHost[s.Host] == topKeyChords {
+			continue
+		}
+		perHost[s.Host]++
+		kept = append(kept, s)
+	}
+
+	return kept, nil
+}
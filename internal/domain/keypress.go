@@ -1,18 +1,63 @@
 package domain
 
-import "time"
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
 
 type KeypressData struct {
 	Key       string    `json:"key" sql:"TEXT NOT NULL"`
+	Host      string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
 	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	// SampleRate is the fraction of keypresses that were recorded while this
+	// one was, 1 unless sampling was on
+	SampleRate float64 `json:"sample_rate" sql:"REAL NOT NULL DEFAULT 1"`
 }
 
 // KeypressAnonymousStats represents anonymized statistics for keypresses
 type KeypressAnonymousStats struct {
 	Timestamp       time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Host            string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
 	KeypressesCount int64     `json:"keypresses_count" sql:"INTEGER NOT NULL"`
+	ShortcutsCount  int64     `json:"shortcuts_count" sql:"INTEGER NOT NULL DEFAULT 0"`
+	// SampleRate is the fraction of the interval's keypresses that were
+	// recorded. Below 1 the counts are estimates scaled up from the sample.
+	SampleRate float64 `json:"sample_rate" sql:"REAL NOT NULL DEFAULT 1"`
+
+	// Accumulate keeps the unrounded estimates, so rounding doesn't add up
+	// over the keypresses of an interval
+	recorded          int64
+	keypressEstimate  float64
+	shortcutsEstimate float64
+}
+
+// KeypressDailyStats represents the keypress total for a whole day
+type KeypressDailyStats struct {
+	Timestamp       time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Host            string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	KeypressesCount int64     `json:"keypresses_count" sql:"INTEGER NOT NULL"`
+	// SampleRate is the fraction of the day's keypresses that were
+	// recorded, see KeypressAnonymousStats
+	SampleRate float64 `json:"sample_rate" sql:"REAL NOT NULL DEFAULT 1"`
+}
+
+// KeypressKeyStats represents anonymized keypress counts per key
+type KeypressKeyStats struct {
+	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Host      string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Key       string    `json:"key" sql:"TEXT NOT NULL"`
+	Count     int64     `json:"count" sql:"INTEGER NOT NULL"`
+	// SampleRate is the fraction of the key's presses that were recorded,
+	// see KeypressAnonymousStats
+	SampleRate float64 `json:"sample_rate" sql:"REAL NOT NULL DEFAULT 1"`
 }
 
+// KeypressPerKeyData reads the same raw keypresses as KeypressData but
+// anonymizes them into per-key counts instead of a single total
+type KeypressPerKeyData KeypressData
+
 // TableName returns the custom table name for SQLite storage
 func (KeypressData) TableName() string {
 	return "keypresses"
@@ -23,28 +68,159 @@ func (KeypressAnonymousStats) TableName() string {
 	return "keypresses_anonymous"
 }
 
+// UniqueKey identifies the stats of a host in an interval so re-running replaces them
+func (KeypressAnonymousStats) UniqueKey() []string {
+	return []string{"timestamp", "host"}
+}
+
+// TableName returns the custom table name for daily storage
+func (KeypressDailyStats) TableName() string {
+	return "keypresses_daily"
+}
+
+// UniqueKey identifies the stats of a host in a day so re-running replaces them
+func (KeypressDailyStats) UniqueKey() []string {
+	return []string{"timestamp", "host"}
+}
+
+// TableName returns the raw keypresses table, shared with KeypressData
+func (KeypressPerKeyData) TableName() string {
+	return KeypressData{}.TableName()
+}
+
+// TableName returns the custom table name for per-key anonymous storage
+func (KeypressKeyStats) TableName() string {
+	return "keypresses_per_key_anonymous"
+}
+
+// UniqueKey identifies the stats of a key on a host in an interval so re-running replaces them
+func (KeypressKeyStats) UniqueKey() []string {
+	return []string{"timestamp", "host", "key"}
+}
+
+// IsShortcut reports whether key was recorded as a modifier combination like
+// "cmd+s". The plus key on its own is not a shortcut.
+func IsShortcut(key string) bool {
+	return strings.Index(key, "+") > 0
+}
+
 // GetTimestamp implements the Anonymizable interface
 func (k KeypressData) GetTimestamp() time.Time {
 	return k.Timestamp
 }
 
+// Weight returns how many keypresses the recorded one stands for, the
+// inverse of its sample rate. Keypresses recorded before sampling existed
+// have no rate and stand for themselves.
+func (k KeypressData) Weight() float64 {
+	if k.SampleRate <= 0 {
+		return 1
+	}
+	return 1 / k.SampleRate
+}
+
 // Anonymize implements the Anonymizable interface
-func (k KeypressData) Anonymize(records []any, intervalStart time.Time) ([]KeypressAnonymousStats, error) {
-	// Create a map to count keypresses per key
-	var keyCount int64
-
-	// Count occurrences of each key
-	for _, record := range records {
-		if _, ok := record.(KeypressData); ok {
-			keyCount++
-		}
+func (k KeypressData) Anonymize(records []KeypressData, intervalStart time.Time) ([]KeypressAnonymousStats, error) {
+	var stats []KeypressAnonymousStats
+	for _, keypress := range records {
+		stats = keypress.Accumulate(stats, intervalStart)
 	}
 
-	stats := make([]KeypressAnonymousStats, 0, 1)
-	stats = append(stats, KeypressAnonymousStats{
-		Timestamp:       intervalStart,
-		KeypressesCount: keyCount,
+	return stats, nil
+}
+
+// Accumulate implements the Accumulable interface, counting the keypress,
+// and separately whether it was a shortcut, into the stats record of its
+// host. A sampled keypress counts as its Weight, so the counts estimate
+// every keypress typed. There are only ever a few hosts, so they are
+// searched linearly.
+func (k KeypressData) Accumulate(stats []KeypressAnonymousStats, intervalStart time.Time) []KeypressAnonymousStats {
+	i := slices.IndexFunc(stats, func(s KeypressAnonymousStats) bool {
+		return s.Host == k.Host
 	})
+	if i < 0 {
+		stats = append(stats, KeypressAnonymousStats{Timestamp: intervalStart, Host: k.Host})
+		i = len(stats) - 1
+	}
+
+	s := &stats[i]
+	weight := k.Weight()
+	s.recorded++
+	s.keypressEstimate += weight
+	if IsShortcut(k.Key) {
+		s.shortcutsEstimate += weight
+	}
+
+	s.KeypressesCount = int64(math.Round(s.keypressEstimate))
+	s.ShortcutsCount = int64(math.Round(s.shortcutsEstimate))
+	s.SampleRate = float64(s.recorded) / s.keypressEstimate
+
+	return stats
+}
+
+// Rollup implements the Rollupable interface. The counts are already
+// scaled up estimates, so they add up as they are. The day's sample rate
+// is how many of its estimated keypresses were recorded.
+func (k KeypressAnonymousStats) Rollup(records []KeypressAnonymousStats, dayStart time.Time) ([]KeypressDailyStats, error) {
+	totals := make(map[string]int64)
+	recorded := make(map[string]float64)
+	for _, stats := range records {
+		rate := stats.SampleRate
+		if rate <= 0 {
+			// Stats from before sampling existed
+			rate = 1
+		}
+		totals[stats.Host] += stats.KeypressesCount
+		recorded[stats.Host] += float64(stats.KeypressesCount) * rate
+	}
+
+	var daily []KeypressDailyStats
+	for host, total := range totals {
+		rate := 1.0
+		if total > 0 {
+			rate = recorded[host] / float64(total)
+		}
+		daily = append(daily, KeypressDailyStats{
+			Timestamp:       dayStart,
+			Host:            host,
+			KeypressesCount: total,
+			SampleRate:      rate,
+		})
+	}
+
+	return daily, nil
+}
+
+// GetTimestamp implements the Anonymizable interface
+func (k KeypressPerKeyData) GetTimestamp() time.Time {
+	return k.Timestamp
+}
+
+// Anonymize implements the Anonymizable interface
+func (k KeypressPerKeyData) Anonymize(records []KeypressPerKeyData, intervalStart time.Time) ([]KeypressKeyStats, error) {
+	type hostKey struct{ host, key string }
+
+	// Map to count keypresses per host and key, and estimate them from
+	// the sampled ones
+	keyCounts := make(map[hostKey]int64)
+	keyEstimates := make(map[hostKey]float64)
+
+	for _, keypress := range records {
+		key := hostKey{keypress.Host, keypress.Key}
+		keyCounts[key]++
+		keyEstimates[key] += KeypressData(keypress).Weight()
+	}
+
+	var stats []KeypressKeyStats
+	for key, count := range keyCounts {
+		stats = append(stats, KeypressKeyStats{
+			Timestamp:  intervalStart,
+			Host:       key.host,
+			Key:        key.key,
+			Count:      int64(math.Round(keyEstimates[key])),
+			SampleRate: float64(count) / keyEstimates[key],
+		})
+	}
 
 	return stats, nil
 }
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAccumulateScalesSampledKeypresses(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// 30 keypresses sampled at a quarter, 10 of them shortcuts, then 20
+	// recorded before sampling existed, without a rate
+	var records []KeypressData
+	for i := 0; i < 30; i++ {
+		key := "a"
+		if i%3 == 0 {
+			key = "cmd+s"
+		}
+		records = append(records, KeypressData{Key: key, Timestamp: start.Add(time.Duration(i) * time.Second), SampleRate: 0.25})
+	}
+	for i := 0; i < 20; i++ {
+		records = append(records, KeypressData{Key: "b", Timestamp: start.Add(time.Minute)})
+	}
+
+	var stats []KeypressAnonymousStats
+	for _, record := range records {
+		stats = record.Accumulate(stats, start)
+	}
+
+	if len(stats) != 1 {
+		t.Fatalf("got %d stats, want 1", len(stats))
+	}
+	s := stats[0]
+	if !s.Timestamp.Equal(start) {
+		t.Errorf("timestamp %s, want %s", s.Timestamp, start)
+	}
+	if s.KeypressesCount != 30*4+20 {
+		t.Errorf("KeypressesCount = %d, want %d", s.KeypressesCount, 30*4+20)
+	}
+	if s.ShortcutsCount != 10*4 {
+		t.Errorf("ShortcutsCount = %d, want %d", s.ShortcutsCount, 10*4)
+	}
+	// 50 recorded of an estimated 140
+	if want := 50.0 / 140; math.Abs(s.SampleRate-want) > 1e-9 {
+		t.Errorf("SampleRate = %f, want %f", s.SampleRate, want)
+	}
+}
+
+func TestAccumulateRoundsOnlyTheTotal(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Each keypress stands for 1.5, rounding each would count 2
+	var stats []KeypressAnonymousStats
+	for i := 0; i < 3; i++ {
+		stats = KeypressData{Key: "a", Timestamp: start, SampleRate: 2.0 / 3}.Accumulate(stats, start)
+	}
+
+	if stats[0].KeypressesCount != 5 {
+		t.Errorf("KeypressesCount = %d, want 5 for an estimate of 4.5", stats[0].KeypressesCount)
+	}
+	if math.Abs(stats[0].SampleRate-2.0/3) > 1e-9 {
+		t.Errorf("SampleRate = %f, want %f", stats[0].SampleRate, 2.0/3)
+	}
+}
+
+func TestRollupCarriesSampleRate(t *testing.T) {
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// 100 estimated from 25 recorded, 50 recorded without sampling, and
+	// stats from before sampling existed without a rate
+	records := []KeypressAnonymousStats{
+		{Timestamp: day.Add(time.Hour), Host: "laptop", KeypressesCount: 100, SampleRate: 0.25},
+		{Timestamp: day.Add(2 * time.Hour), Host: "laptop", KeypressesCount: 50, SampleRate: 1},
+		{Timestamp: day.Add(3 * time.Hour), Host: "laptop", KeypressesCount: 50},
+	}
+
+	daily, err := KeypressAnonymousStats{}.Rollup(records, day)
+	if err != nil {
+		t.Fatalf("Rollup: %v", err)
+	}
+	if len(daily) != 1 {
+		t.Fatalf("got %d daily stats, want 1", len(daily))
+	}
+	if daily[0].KeypressesCount != 200 {
+		t.Errorf("KeypressesCount = %d, want 200", daily[0].KeypressesCount)
+	}
+	// 125 recorded of an estimated 200
+	if want := 125.0 / 200; math.Abs(daily[0].SampleRate-want) > 1e-9 {
+		t.Errorf("SampleRate = %f, want %f", daily[0].SampleRate, want)
+	}
+}
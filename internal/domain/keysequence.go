@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// topKeySequences is how many of the most common sequences of a host in an
+// interval are kept when anonymizing
+const topKeySequences = 20
+
+// KeySequenceData is a pair of keys pressed right after each other
+type KeySequenceData struct {
+	First     string    `json:"first" sql:"TEXT NOT NULL"`
+	Second    string    `json:"second" sql:"TEXT NOT NULL"`
+	Host      string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+}
+
+// KeySequenceStats represents the anonymized count of a key pair in an interval
+type KeySequenceStats struct {
+	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Host      string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	First     string    `json:"first" sql:"TEXT NOT NULL"`
+	Second    string    `json:"second" sql:"TEXT NOT NULL"`
+	Count     int64     `json:"count" sql:"INTEGER NOT NULL"`
+}
+
+// TableName returns the custom table name for SQLite storage
+func (KeySequenceData) TableName() string {
+	return "key_sequences"
+}
+
+// TableName returns the custom table name for anonymous storage
+func (KeySequenceStats) TableName() string {
+	return "key_sequences_anonymous"
+}
+
+// UniqueKey identifies the stats of a key pair on a host in an interval so re-running replaces them
+func (KeySequenceStats) UniqueKey() []string {
+	return []string{"timestamp", "host", "first", "second"}
+}
+
+// GetTimestamp implements the Anonymizable interface
+func (k KeySequenceData) GetTimestamp() time.Time {
+	return k.Timestamp
+}
+
+// Anonymize implements the Anonymizable interface. Only the most common
+// sequences of each host in the interval are kept, so the stats can't be
+// read back as text.
+func (k KeySequenceData) Anonymize(records []KeySequenceData, intervalStart time.Time) ([]KeySequenceStats, error) {
+	type pair struct{ host, first, second string }
+
+	// Map to count each key pair per host
+	pairCounts := make(map[pair]int64)
+	for _, sequence := range records {
+		pairCounts[pair{sequence.Host, sequence.First, sequence.Second}]++
+	}
+
+	stats := make([]KeySequenceStats, 0, len(pairCounts))
+	for p, count := range pairCounts {
+		stats = append(stats, KeySequenceStats{
+			Timestamp: intervalStart,
+			Host:      p.host,
+			First:     p.first,
+			Second:    p.second,
+			Count:     count,
+		})
+	}
+
+	// Grouped by host, most common first, ties broken by the keys so the cut is stable
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Host != stats[j].Host {
+			return stats[i].Host < stats[j].Host
+		}
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		if stats[i].First != stats[j].First {
+			return stats[i].First < stats[j].First
+		}
+		return stats[i].Second < stats[j].Second
+	})
+
+	perHost := make(map[string]int)
+	kept := stats[:0]
+	for _, s := range stats {
+		if perHost[s.Host] == topKeySequences {
+			continue
+		}
+		perHost[s.Host]++
+		kept = append(kept, s)
+	}
+
+	return kept, nil
+}
@@ -0,0 +1,61 @@
+package domain
+
+import "time"
+
+type MouseClickData struct {
+	Button    string    `json:"button" sql:"TEXT NOT NULL"`
+	Host      string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Timestamp time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+}
+
+// MouseClickAnonymousStats represents anonymized statistics for mouse clicks per button
+type MouseClickAnonymousStats struct {
+	Timestamp    time.Time `json:"timestamp" sql:"DATETIME NOT NULL"`
+	Host         string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+	Button       string    `json:"button" sql:"TEXT NOT NULL"`
+	ClicksInSpan int64     `json:"clicks_in_span" sql:"INTEGER NOT NULL"`
+}
+
+// TableName returns the custom table name for SQLite storage
+func (MouseClickData) TableName() string {
+	return "mouse_clicks"
+}
+
+// TableName returns the custom table name for anonymous storage
+func (MouseClickAnonymousStats) TableName() string {
+	return "mouse_clicks_anonymous"
+}
+
+// UniqueKey identifies the stats of a button on a host in an interval so re-running replaces them
+func (MouseClickAnonymousStats) UniqueKey() []string {
+	return []string{"timestamp", "host", "button"}
+}
+
+// GetTimestamp implements the Anonymizable interface
+func (m MouseClickData) GetTimestamp() time.Time {
+	return m.Timestamp
+}
+
+// Anonymize implements the Anonymizable interface
+func (m MouseClickData) Anonymize(records []MouseClickData, intervalStart time.Time) ([]MouseClickAnonymousStats, error) {
+	type hostButton struct{ host, button string }
+
+	// Map to count clicks per host and button
+	buttonCounts := make(map[hostButton]int64)
+
+	for _, click := range records {
+		buttonCounts[hostButton{click.Host, click.Button}]++
+	}
+
+	var stats []MouseClickAnonymousStats
+	for key, count := range buttonCounts {
+		stats = append(stats, MouseClickAnonymousStats{
+			Timestamp:    intervalStart,
+			Host:         key.host,
+			Button:       key.button,
+			ClicksInSpan: count,
+		})
+	}
+
+	return stats, nil
+}
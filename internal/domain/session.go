@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// SessionData is a burst of typing without an idle gap longer than the
+// configured threshold
+type SessionData struct {
+	Start      time.Time `json:"start" sql:"DATETIME NOT NULL"`
+	End        time.Time `json:"end" sql:"DATETIME NOT NULL"`
+	Keypresses int64     `json:"keypresses" sql:"INTEGER NOT NULL"`
+	Host       string    `json:"host" sql:"TEXT NOT NULL DEFAULT ''"`
+}
+
+// TableName returns the custom table name for anonymous storage
+func (SessionData) TableName() string {
+	return "sessions"
+}
+
+// TimestampColumn queries sessions by when they ended, so a session that is
+// still open is found by looking just before the next interval
+func (SessionData) TimestampColumn() string {
+	return "end"
+}
+
+// Duration returns how long the session lasted
+func (s SessionData) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// BuildSessions groups keypresses into sessions, starting a new one whenever
+// more than idleGap passes between two keypresses. Each host has its own
+// sessions, typing on one machine doesn't continue a session on another.
+//
+// Sampled keypresses count as their Weight. Sampling leaves out keypresses
+// but not time, so a session can only split where a lone keypress that
+// wasn't sampled would have bridged a pause of nearly idleGap. With an
+// idleGap of minutes that is rare, and it is not compensated for: widening
+// the gap by the weight would instead merge sessions that were apart.
+func BuildSessions(records []KeypressData, idleGap time.Duration) []SessionData {
+	keypresses := append([]KeypressData(nil), records...)
+
+	sort.SliceStable(keypresses, func(i, j int) bool {
+		if keypresses[i].Host != keypresses[j].Host {
+			return keypresses[i].Host < keypresses[j].Host
+		}
+		return keypresses[i].Timestamp.Before(keypresses[j].Timestamp)
+	})
+
+	var sessions []SessionData
+	// The unrounded keypress estimate of each session, so rounding doesn't
+	// add up over its keypresses
+	var estimates []float64
+	for _, keypress := range keypresses {
+		ts := keypress.Timestamp
+		if n := len(sessions); n > 0 && sessions[n-1].Host == keypress.Host && ts.Sub(sessions[n-1].End) <= idleGap {
+			sessions[n-1].End = ts
+			estimates[n-1] += keypress.Weight()
+			sessions[n-1].Keypresses = int64(math.Round(estimates[n-1]))
+			continue
+		}
+		sessions = append(sessions, SessionData{
+			Start:      ts,
+			End:        ts,
+			Keypresses: int64(math.Round(keypress.Weight())),
+			Host:       keypress.Host,
+		})
+		estimates = append(estimates, keypress.Weight())
+	}
+
+	return sessions
+}
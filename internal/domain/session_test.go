@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildSessionsWeightsSampledKeypresses(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var records []KeypressData
+	for i := 0; i < 10; i++ {
+		records = append(records, KeypressData{Key: "a", Timestamp: start.Add(time.Duration(i) * time.Second), SampleRate: 0.1})
+	}
+	// After an idle gap, a session recorded before sampling existed
+	for i := 0; i < 3; i++ {
+		records = append(records, KeypressData{Key: "a", Timestamp: start.Add(time.Hour + time.Duration(i)*time.Second)})
+	}
+
+	sessions := BuildSessions(records, 5*time.Minute)
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+	if sessions[0].Keypresses != 100 {
+		t.Errorf("sampled session has %d keypresses, want 100", sessions[0].Keypresses)
+	}
+	if sessions[1].Keypresses != 3 {
+		t.Errorf("unsampled session has %d keypresses, want 3", sessions[1].Keypresses)
+	}
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// registry holds only the devstats counters, without the Go runtime metrics
+// of the default registry
+var registry = prometheus.NewRegistry()
+
+var (
+	// KeypressesTotal counts saved keypresses
+	KeypressesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "devstats_keypresses_total",
+		Help: "Number of keypresses recorded.",
+	})
+
+	// FileChangesTotal counts saved file changes per language
+	FileChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devstats_file_changes_total",
+		Help: "Number of file changes recorded, by language.",
+	}, []string{"language"})
+
+	// FileChangesDropped counts file changes dropped by the rate limit per language
+	FileChangesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devstats_file_changes_dropped_total",
+		Help: "Number of file changes dropped by the rate limit, by language.",
+	}, []string{"language"})
+
+	// MouseClicksTotal counts saved mouse clicks per button
+	MouseClicksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devstats_mouse_clicks_total",
+		Help: "Number of mouse clicks recorded, by button.",
+	}, []string{"button"})
+
+	// CommitsTotal counts saved git commits
+	CommitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "devstats_commits_total",
+		Help: "Number of git commits recorded.",
+	})
+
+	// CommandsTotal counts saved shell commands
+	CommandsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "devstats_commands_total",
+		Help: "Number of shell commands recorded.",
+	})
+
+	// KeypressHookUp is 1 while the keyboard hook is delivering keypresses
+	KeypressHookUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "devstats_keypress_hook_up",
+		Help: "Whether the keyboard hook is running (1) or stopped or disabled (0).",
+	})
+)
+
+func init() {
+	registry.MustRegister(KeypressesTotal, FileChangesTotal, FileChangesDropped, MouseClicksTotal, CommitsTotal, CommandsTotal, KeypressHookUp)
+}
+
+// Handler serves the counters in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Totals returns every counter summed over its labels, keyed by the metric
+// name without the devstats_ prefix and _total suffix, e.g. "keypresses"
+func Totals() (map[string]int64, error) {
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int64)
+	for _, family := range families {
+		name, isCounter := strings.CutSuffix(family.GetName(), "_total")
+		if !isCounter {
+			continue
+		}
+
+		var total float64
+		for _, m := range family.GetMetric() {
+			total += m.GetCounter().GetValue()
+		}
+		totals[strings.TrimPrefix(name, "devstats_")] = int64(total)
+	}
+
+	return totals, nil
+}
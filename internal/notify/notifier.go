@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+)
+
+const (
+	// maxAttempts is how often a summary is sent before giving up
+	maxAttempts = 5
+	// initialBackoff is the wait before the first retry, doubled after each
+	initialBackoff = time.Minute
+)
+
+// Stores are the anonymized stores a summary is built from
+type Stores struct {
+	Keypresses  storage.Store[domain.KeypressAnonymousStats]
+	FileChanges storage.Store[domain.FileChangeAnonymousStats]
+}
+
+// Schedule is the weekday and hour in Location the summary is sent at
+type Schedule struct {
+	Weekday  time.Weekday
+	Hour     int
+	Location *time.Location
+}
+
+// Next returns the first send time after t
+func (s Schedule) Next(t time.Time) time.Time {
+	local := t.In(s.Location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), s.Hour, 0, 0, 0, s.Location)
+	next = next.AddDate(0, 0, (int(s.Weekday)-int(next.Weekday())+7)%7)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next
+}
+
+// Notifier sends a summary of the past week to its senders on a weekly
+// schedule. Failed sends are retried with backoff and then logged.
+type Notifier struct {
+	stores   Stores
+	schedule Schedule
+	senders  []Sender
+	stopChan chan struct{}
+	doneChan chan struct{}
+}
+
+// NewNotifier creates a notifier, nothing is sent until Start
+func NewNotifier(stores Stores, schedule Schedule, senders ...Sender) *Notifier {
+	return &Notifier{
+		stores:   stores,
+		schedule: schedule,
+		senders:  senders,
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+}
+
+// Start waits for the scheduled times in the background
+func (n *Notifier) Start() {
+	go n.run()
+}
+
+func (n *Notifier) run() {
+	defer close(n.doneChan)
+
+	for {
+		next := n.schedule.Next(time.Now())
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-n.stopChan:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		summary, err := n.Summary(next.AddDate(0, 0, -7), next)
+		if err != nil {
+			log.Printf("Error building weekly summary: %v", err)
+			continue
+		}
+		for _, sender := range n.senders {
+			n.sendWithRetry(sender, summary)
+		}
+	}
+}
+
+// Summary builds the summary of the stats between start and end
+func (n *Notifier) Summary(start, end time.Time) (Summary, error) {
+	// FindBetween includes end, which belongs to the next summary
+	last := end.Add(-time.Nanosecond)
+
+	keypresses, err := n.stores.Keypresses.FindBetweenTyped(start, last)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to read keypress stats: %w", err)
+	}
+
+	fileChanges, err := n.stores.FileChanges.FindBetweenTyped(start, last)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to read file change stats: %w", err)
+	}
+
+	return BuildSummary(keypresses, fileChanges, start, end, n.schedule.Location), nil
+}
+
+// sendWithRetry sends the summary, retrying with exponential backoff until
+// it succeeds, maxAttempts is reached or the notifier is stopped
+func (n *Notifier) sendWithRetry(sender Sender, summary Summary) {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := sender.Send(summary)
+		if err == nil {
+			log.Printf("Sent weekly summary")
+			return
+		}
+		if attempt == maxAttempts {
+			log.Printf("ERROR: giving up on the weekly summary after %d attempts: %v", attempt, err)
+			return
+		}
+		log.Printf("Error sending weekly summary, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-n.stopChan:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Stop stops waiting for the schedule and abandons any pending retries
+func (n *Notifier) Stop() {
+	close(n.stopChan)
+	<-n.doneChan
+}
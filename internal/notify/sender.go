@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sender delivers a summary somewhere
+type Sender interface {
+	Send(summary Summary) error
+}
+
+// Webhook POSTs the summary as JSON to URL
+type Webhook struct {
+	URL string
+}
+
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
+
+// Send implements the Sender interface. Any status other than 2xx is an error.
+func (w Webhook) Send(summary Summary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to encode summary: %w", err)
+	}
+
+	resp, err := webhookClient.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post summary: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Email sends the summary as a plain text mail through an SMTP server
+type Email struct {
+	// Addr is the server's host:port
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Send implements the Sender interface. The server must support STARTTLS
+// when a username is set, net/smtp refuses to send credentials otherwise.
+func (e Email) Send(summary Summary) error {
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, err := net.SplitHostPort(e.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid smtp address %q: %w", e.Addr, err)
+		}
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: devstats weekly summary\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(summary.Text(), "\n", "\r\n"))
+
+	if err := e.sendMail(auth, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// mailTimeout bounds the whole SMTP conversation, so an unresponsive server
+// can't keep the notifier, and with it shutdown, waiting
+const mailTimeout = 30 * time.Second
+
+// sendMail does what smtp.SendMail does, on a connection with a deadline
+func (e Email) sendMail(auth smtp.Auth, msg []byte) error {
+	host, _, err := net.SplitHostPort(e.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address %q: %w", e.Addr, err)
+	}
+
+	conn, err := net.DialTimeout("tcp", e.Addr, mailTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(mailTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp server doesn't support AUTH")
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(e.From); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
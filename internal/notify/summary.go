@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+// topLanguages is how many languages a summary lists
+const topLanguages = 3
+
+// LanguageCount is the number of file changes in a language
+type LanguageCount struct {
+	Language string `json:"language"`
+	Changes  int64  `json:"changes"`
+}
+
+// Summary is the digest of a week of anonymized stats
+type Summary struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Keypresses int64     `json:"keypresses"`
+	// TopLanguages are the languages with the most file changes, most first
+	TopLanguages []LanguageCount `json:"top_languages"`
+	// BusiestDay is the day with the most keypresses, zero if none were recorded
+	BusiestDay           time.Time `json:"busiest_day"`
+	BusiestDayKeypresses int64     `json:"busiest_day_keypresses"`
+}
+
+// BuildSummary summarizes the stats recorded between start and end. Days
+// are counted in loc.
+func BuildSummary(keypresses []domain.KeypressAnonymousStats, fileChanges []domain.FileChangeAnonymousStats, start, end time.Time, loc *time.Location) Summary {
+	summary := Summary{
+		Start:        start,
+		End:          end,
+		TopLanguages: []LanguageCount{},
+	}
+
+	perDay := make(map[time.Time]int64)
+	for _, stats := range keypresses {
+		summary.Keypresses += stats.KeypressesCount
+
+		t := stats.Timestamp.In(loc)
+		perDay[time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)] += stats.KeypressesCount
+	}
+
+	for day, count := range perDay {
+		// Ties go to the earlier day so the result doesn't depend on map order
+		if count > summary.BusiestDayKeypresses || (count == summary.BusiestDayKeypresses && day.Before(summary.BusiestDay)) {
+			summary.BusiestDay = day
+			summary.BusiestDayKeypresses = count
+		}
+	}
+
+	perLanguage := make(map[string]int64)
+	for _, stats := range fileChanges {
+		perLanguage[stats.Language] += stats.ChangesInSpan
+	}
+	for language, changes := range perLanguage {
+		summary.TopLanguages = append(summary.TopLanguages, LanguageCount{Language: language, Changes: changes})
+	}
+	sort.Slice(summary.TopLanguages, func(i, j int) bool {
+		a, b := summary.TopLanguages[i], summary.TopLanguages[j]
+		if a.Changes != b.Changes {
+			return a.Changes > b.Changes
+		}
+		return a.Language < b.Language
+	})
+	if len(summary.TopLanguages) > topLanguages {
+		summary.TopLanguages = summary.TopLanguages[:topLanguages]
+	}
+
+	return summary
+}
+
+// Text renders the summary as a short plain text report
+func (s Summary) Text() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "devstats summary for %s to %s\n\n", s.Start.Format("2006-01-02"), s.End.Add(-time.Nanosecond).Format("2006-01-02"))
+	fmt.Fprintf(&b, "Keypresses: %d\n", s.Keypresses)
+	if !s.BusiestDay.IsZero() {
+		fmt.Fprintf(&b, "Busiest day: %s (%d keypresses)\n", s.BusiestDay.Format("Monday 2006-01-02"), s.BusiestDayKeypresses)
+	}
+
+	if len(s.TopLanguages) > 0 {
+		fmt.Fprintln(&b, "Top languages:")
+		for _, lang := range s.TopLanguages {
+			fmt.Fprintf(&b, "  %s: %d changes\n", lang.Language, lang.Changes)
+		}
+	}
+
+	return b.String()
+}
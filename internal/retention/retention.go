@@ -0,0 +1,55 @@
+package retention
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Pruner is the part of storage.Store needed to delete old records
+type Pruner interface {
+	Delete(start, end interface{}) (int64, error)
+}
+
+// Target is a named store whose old records are pruned
+type Target struct {
+	Name  string
+	Store Pruner
+}
+
+// Policy deletes records older than MaxAge from its targets. It is meant for
+// raw data only; anonymized stats should not be added so long-term trends
+// survive.
+type Policy struct {
+	maxAge  time.Duration
+	targets []Target
+}
+
+// NewPolicy creates a retention policy. A zero maxAge keeps everything.
+func NewPolicy(maxAge time.Duration, targets ...Target) *Policy {
+	return &Policy{
+		maxAge:  maxAge,
+		targets: targets,
+	}
+}
+
+// Prune deletes every record older than MaxAge before now and logs how many
+// rows were removed per target
+func (p *Policy) Prune(now time.Time) error {
+	if p.maxAge <= 0 {
+		return nil
+	}
+
+	cutoff := now.Add(-p.maxAge)
+	for _, target := range p.targets {
+		removed, err := target.Store.Delete(time.Time{}, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to prune %s: %w", target.Name, err)
+		}
+		if removed > 0 {
+			log.Printf("Pruned %d %s records older than %s", removed, target.Name, cutoff.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
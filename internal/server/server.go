@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/analysis"
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+	"github.com/nilszeilon/devstats/internal/version"
+)
+
+// defaultRange is how far back queries look when no "from" is given
+const defaultRange = 24 * time.Hour
+
+// maxPageSize caps the "limit" of a paged query
+const maxPageSize = 10000
+
+// Stores are the anonymized stores exposed by the API
+type Stores struct {
+	Keypresses  storage.Store[domain.KeypressAnonymousStats]
+	FileChanges storage.Store[domain.FileChangeAnonymousStats]
+}
+
+// NewHandler returns a read-only JSON API over the anonymized stores. Hours
+// and weekdays are counted in loc.
+func NewHandler(stores Stores, loc *time.Location) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/keypresses", rangeHandler(stores.Keypresses))
+	mux.Handle("GET /api/filechanges", rangeHandler(stores.FileChanges))
+	mux.Handle("GET /api/heatmap", heatmapHandler(stores.Keypresses, loc))
+	mux.HandleFunc("GET /api/version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, version.Get())
+	})
+	return mux
+}
+
+// rangeHandler serves the records of store between the "from" and "to" query
+// parameters, or a page of them if "limit" is given
+func rangeHandler[T any](store storage.Store[T]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var records []T
+		if r.URL.Query().Has("limit") {
+			afterID, limit, err := parsePage(r)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			var next int64
+			records, next, err = store.FindAfter(afterID, limit)
+			if err != nil {
+				log.Printf("Error querying %s: %v", r.URL.Path, err)
+				writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to query data"))
+				return
+			}
+			w.Header().Set("X-Next-After", strconv.FormatInt(next, 10))
+		} else {
+			from, to, err := parseRange(r)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			records, err = findRange(store, r, from, to)
+			if err != nil {
+				log.Printf("Error querying %s: %v", r.URL.Path, err)
+				writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to query data"))
+				return
+			}
+		}
+
+		// Encode an empty list rather than null
+		if records == nil {
+			records = []T{}
+		}
+
+		writeJSON(w, http.StatusOK, records)
+	}
+}
+
+// heatmapHandler serves the keypresses between the "from" and "to" query
+// parameters as a 7x24 grid of weekday and hour, Sunday first
+func heatmapHandler(store storage.Store[domain.KeypressAnonymousStats], loc *time.Location) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseRange(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		stats, err := findRange(store, r, from, to)
+		if err != nil {
+			log.Printf("Error querying %s: %v", r.URL.Path, err)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to query data"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, analysis.KeypressHeatmap(stats, loc))
+	}
+}
+
+// findRange returns the records of store between from and to, only those
+// of the machine named by the "host" query parameter if it is given
+func findRange[T any](store storage.Store[T], r *http.Request, from, to time.Time) ([]T, error) {
+	if host := r.URL.Query().Get("host"); host != "" {
+		return store.Find(map[string]interface{}{"host": host}, from, to)
+	}
+	return store.FindBetweenTyped(from, to)
+}
+
+// parsePage reads the "after" and "limit" query parameters of a page of
+// records in the order they were saved. The page's X-Next-After header is
+// the "after" of the next one. Paging ignores "from", "to" and "host".
+func parsePage(r *http.Request) (int64, int, error) {
+	query := r.URL.Query()
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 || limit > maxPageSize {
+		return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+
+	var afterID int64
+	if value := query.Get("after"); value != "" {
+		if afterID, err = strconv.ParseInt(value, 10, 64); err != nil || afterID < 0 {
+			return 0, 0, fmt.Errorf("invalid after: %q", value)
+		}
+	}
+
+	return afterID, limit, nil
+}
+
+// parseRange reads the "from" and "to" query parameters, defaulting to the last 24 hours
+func parseRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now()
+	if value := r.URL.Query().Get("to"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+
+	from := to.Add(-defaultRange)
+	if value := r.URL.Query().Get("from"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+
+	return from, to, nil
+}
+
+// parseTime accepts RFC3339 timestamps or plain dates in local time
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("expected RFC3339 or 2006-01-02, got %q", value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
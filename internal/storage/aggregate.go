@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+)
+
+// AggFunc is an SQL aggregate function
+type AggFunc string
+
+const (
+	AggCount AggFunc = "COUNT"
+	AggSum   AggFunc = "SUM"
+	AggAvg   AggFunc = "AVG"
+)
+
+// AggSpec selects the aggregate to compute per group. Column may be left
+// empty for AggCount to count rows.
+type AggSpec struct {
+	Func   AggFunc
+	Column string
+}
+
+// AggRow is the aggregated value of one group
+type AggRow struct {
+	GroupValue string
+	Value      float64
+}
+
+// Aggregate groups the records between start and end timestamps by the
+// groupBy column and computes agg for each group in the database. Column
+// names are checked against the fields of T. If start and end are both nil
+// the time range is not restricted.
+func (s *SQLiteStore[T]) Aggregate(groupBy string, agg AggSpec, start, end interface{}) ([]AggRow, error) {
+	if err := checkColumns[T](groupBy); err != nil {
+		return nil, err
+	}
+
+	var expr string
+	switch agg.Func {
+	case AggCount, AggSum, AggAvg:
+		column := agg.Column
+		if column == "" {
+			if agg.Func != AggCount {
+				return nil, fmt.Errorf("%s needs a column", agg.Func)
+			}
+			column = "*"
+		} else if err := checkColumns[T](column); err != nil {
+			return nil, err
+		}
+		expr = fmt.Sprintf("%s(%s)", agg.Func, column)
+	default:
+		return nil, fmt.Errorf("unsupported aggregate function %q", agg.Func)
+	}
+
+	query := fmt.Sprintf("SELECT COALESCE(CAST(%s AS TEXT), ''), COALESCE(%s, 0) FROM %s", groupBy, expr, s.table)
+	var args []interface{}
+	if start != nil || end != nil {
+		query += fmt.Sprintf(" WHERE %s BETWEEN ? AND ?", s.timestampColumn)
+		args = append(args, bindValue(start), bindValue(end))
+	}
+	query += fmt.Sprintf(" GROUP BY %s ORDER BY %s", groupBy, groupBy)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Printf("ERROR: Failed to aggregate data: %v", err)
+		return nil, fmt.Errorf("failed to aggregate data: %w", err)
+	}
+	defer rows.Close()
+
+	var results []AggRow
+	for rows.Next() {
+		var row AggRow
+		if err := rows.Scan(&row.GroupValue, &row.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan aggregate: %w", err)
+		}
+		results = append(results, row)
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,31 @@
+//go:build cgo
+
+package storage
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupConn copies the main database of the driver connection src into
+// dest with SQLite's online backup API
+func backupConn(destRaw, srcRaw any) error {
+	dest, destOK := destRaw.(*sqlite3.SQLiteConn)
+	src, srcOK := srcRaw.(*sqlite3.SQLiteConn)
+	if !destOK || !srcOK {
+		return fmt.Errorf("unexpected driver connection %T", srcRaw)
+	}
+
+	b, err := dest.Backup("main", src, "main")
+	if err != nil {
+		return err
+	}
+
+	// -1 copies every page in a single step
+	if _, err := b.Step(-1); err != nil {
+		b.Close()
+		return err
+	}
+	return b.Finish()
+}
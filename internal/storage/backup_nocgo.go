@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package storage
+
+// backupConn fails, go-sqlite3 only has the backup API in cgo builds, which
+// are the only ones that can open a database in the first place
+func backupConn(_, _ any) error {
+	return ErrUnsupported
+}
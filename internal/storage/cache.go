@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachingStore wraps a Store and remembers the results of time range queries
+// that end before the settle window, whose records are final and don't
+// change anymore. A query reaching into the still changing window, like
+// "today so far", is split: its settled part is cached up to a boundary
+// that moves once per settle window, only the rest goes to the wrapped
+// store every time. Cached results expire after the TTL and at most
+// maxEntries are kept. Any write through the CachingStore clears the cache,
+// writes by other processes are only seen once their results expire. The
+// optional interfaces of SQLiteStore, like Streamer and Backup, are passed
+// through to the wrapped store.
+type CachingStore[T any] struct {
+	Store[T]
+	settle     time.Duration
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry[T]
+	// generation counts the invalidations, so a query that raced a write
+	// doesn't cache what it read from before the write
+	generation uint64
+}
+
+type cacheEntry[T any] struct {
+	records []T
+	expires time.Time
+}
+
+// NewCachingStore caches the range queries of store that end more than
+// settle ago, for ttl and up to maxEntries of them. settle should cover
+// every record that may still be written, e.g. two anonymization intervals
+// for anonymized stats, as the previous bucket is rewritten on restart.
+func NewCachingStore[T any](store Store[T], settle, ttl time.Duration, maxEntries int) *CachingStore[T] {
+	return &CachingStore[T]{
+		Store:      store,
+		settle:     settle,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]cacheEntry[T]),
+	}
+}
+
+// FindBetween returns records between start and end timestamps, from the
+// cache if the range has settled
+func (c *CachingStore[T]) FindBetween(start, end interface{}) ([]any, error) {
+	return c.FindBetweenContext(context.Background(), start, end)
+}
+
+// FindBetweenContext returns records between start and end timestamps, from
+// the cache if the range has settled, aborting if ctx is cancelled
+func (c *CachingStore[T]) FindBetweenContext(ctx context.Context, start, end interface{}) ([]any, error) {
+	records, err := c.cached("between", start, end, func(start, end interface{}) ([]T, error) {
+		results, err := c.Store.FindBetweenContext(ctx, start, end)
+		if err != nil {
+			return nil, err
+		}
+		records := make([]T, len(results))
+		for i, result := range results {
+			record, ok := result.(T)
+			if !ok {
+				return nil, fmt.Errorf("%w: %T", ErrCastFailed, result)
+			}
+			records[i] = record
+		}
+		return records, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]any, len(records))
+	for i, record := range records {
+		results[i] = record
+	}
+	return results, nil
+}
+
+// FindBetweenTyped returns records between start and end timestamps as T,
+// from the cache if the range has settled
+func (c *CachingStore[T]) FindBetweenTyped(start, end interface{}) ([]T, error) {
+	return c.cached("between", start, end, func(start, end interface{}) ([]T, error) {
+		return c.Store.FindBetweenTyped(start, end)
+	})
+}
+
+// Find returns the records matching conds between start and end timestamps,
+// from the cache if the range has settled
+func (c *CachingStore[T]) Find(conds map[string]interface{}, start, end interface{}) ([]T, error) {
+	columns := make([]string, 0, len(conds))
+	for column := range conds {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var kind strings.Builder
+	kind.WriteString("find")
+	for _, column := range columns {
+		fmt.Fprintf(&kind, " %s=%v", column, conds[column])
+	}
+
+	return c.cached(kind.String(), start, end, func(start, end interface{}) ([]T, error) {
+		return c.Store.Find(conds, start, end)
+	})
+}
+
+// cached returns the result of query for the range start to end. A range
+// that hasn't settled is split at a boundary aligned to the settle window:
+// the records before it are looked up in the cache, the rest are queried.
+// query must return records oldest first, like
+// the range queries of Store do, for the two parts to line up.
+func (c *CachingStore[T]) cached(kind string, start, end interface{}, query func(start, end interface{}) ([]T, error)) ([]T, error) {
+	now := time.Now()
+	settled := now.Add(-c.settle)
+	endTime, ok := end.(time.Time)
+	if !ok {
+		return query(start, end)
+	}
+	if endTime.Before(settled) {
+		return c.lookup(kind, start, endTime, now, query)
+	}
+
+	boundary := settled
+	if c.settle > 0 {
+		boundary = settled.Truncate(c.settle)
+	}
+	if startTime, ok := start.(time.Time); ok && !boundary.After(startTime) {
+		return query(start, end)
+	}
+
+	// Range queries include both bounds, so the settled part stops just
+	// before the boundary
+	older, err := c.lookup(kind, start, boundary.Add(-time.Nanosecond), now, query)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := query(boundary, end)
+	if err != nil {
+		return nil, err
+	}
+	return append(older, newer...), nil
+}
+
+// lookup returns the cached result of query for the settled range start to
+// end, running and caching it if it isn't cached yet
+func (c *CachingStore[T]) lookup(kind string, start interface{}, end, now time.Time, query func(start, end interface{}) ([]T, error)) ([]T, error) {
+	key := fmt.Sprintf("%s|%v|%d", kind, rangeBound(start), end.UnixNano())
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		// Callers may sort or modify what they get back
+		return slices.Clone(entry.records), nil
+	}
+
+	records, err := query(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return records, nil
+	}
+	c.makeRoom(now)
+	c.entries[key] = cacheEntry[T]{records: slices.Clone(records), expires: now.Add(c.ttl)}
+
+	return records, nil
+}
+
+// makeRoom drops expired entries, and the one expiring first if the cache
+// is still full
+func (c *CachingStore[T]) makeRoom(now time.Time) {
+	if len(c.entries) < c.maxEntries {
+		return
+	}
+
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+
+	for len(c.entries) >= c.maxEntries && len(c.entries) > 0 {
+		var oldest string
+		var oldestExpires time.Time
+		for key, entry := range c.entries {
+			if oldest == "" || entry.expires.Before(oldestExpires) {
+				oldest, oldestExpires = key, entry.expires
+			}
+		}
+		delete(c.entries, oldest)
+	}
+}
+
+// rangeBound formats a range bound for a cache key, time.Time's String
+// includes the monotonic clock reading which differs between equal times
+func rangeBound(bound interface{}) interface{} {
+	if t, ok := bound.(time.Time); ok {
+		return t.UnixNano()
+	}
+	return bound
+}
+
+// invalidate forgets every cached result, and any result of a query still
+// running
+func (c *CachingStore[T]) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.generation++
+}
+
+// Save saves data and clears the cache
+func (c *CachingStore[T]) Save(data T) error {
+	defer c.invalidate()
+	return c.Store.Save(data)
+}
+
+// SaveContext saves data and clears the cache
+func (c *CachingStore[T]) SaveContext(ctx context.Context, data T) error {
+	defer c.invalidate()
+	return c.Store.SaveContext(ctx, data)
+}
+
+// SaveBatch saves all records and clears the cache
+func (c *CachingStore[T]) SaveBatch(data []T) error {
+	defer c.invalidate()
+	return c.Store.SaveBatch(data)
+}
+
+// Upsert saves data over the record with the same keyColumns if the wrapped
+// store supports it, so SaveUnique works through the cache, and clears the
+// cache
+func (c *CachingStore[T]) Upsert(data T, keyColumns []string) error {
+	defer c.invalidate()
+	if upserter, ok := c.Store.(interface {
+		Upsert(data T, keyColumns []string) error
+	}); ok {
+		return upserter.Upsert(data, keyColumns)
+	}
+	return c.Store.Save(data)
+}
+
+// UpdateBy updates the records matching conds and clears the cache, see
+// Updater
+func (c *CachingStore[T]) UpdateBy(conds map[string]interface{}, data T) (int64, error) {
+	defer c.invalidate()
+	return UpdateBy(c.Store, conds, data)
+}
+
+// Delete deletes the records between start and end and clears the cache
+func (c *CachingStore[T]) Delete(start, end interface{}) (int64, error) {
+	defer c.invalidate()
+	return c.Store.Delete(start, end)
+}
+
+// Truncate removes every record and clears the cache
+func (c *CachingStore[T]) Truncate() error {
+	defer c.invalidate()
+	return c.Store.Truncate()
+}
+
+// StreamAll passes every record to fn one at a time, streaming them if the
+// wrapped store supports it, see Streamer
+func (c *CachingStore[T]) StreamAll(fn func(T) error) error {
+	return forEach(c.Store, fn)
+}
+
+// StreamBetween passes every record between start and end timestamps to fn
+// one at a time, streaming them if the wrapped store supports it, see
+// RangeStreamer
+func (c *CachingStore[T]) StreamBetween(start, end interface{}, fn func(T) error) error {
+	return ForEachBetween(c.Store, start, end, fn)
+}
+
+// Aggregate computes agg per groupBy value in the wrapped store, see
+// SQLiteStore.Aggregate. Results are not cached.
+func (c *CachingStore[T]) Aggregate(groupBy string, agg AggSpec, start, end interface{}) ([]AggRow, error) {
+	aggregator, ok := c.Store.(interface {
+		Aggregate(groupBy string, agg AggSpec, start, end interface{}) ([]AggRow, error)
+	})
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return aggregator.Aggregate(groupBy, agg, start, end)
+}
+
+// Backup copies the wrapped store's database to destPath, see
+// SQLiteStore.Backup
+func (c *CachingStore[T]) Backup(destPath string) error {
+	backuper, ok := c.Store.(interface{ Backup(destPath string) error })
+	if !ok {
+		return ErrUnsupported
+	}
+	return backuper.Backup(destPath)
+}
+
+// Close closes the wrapped store if it needs closing and clears the cache
+func (c *CachingStore[T]) Close() error {
+	defer c.invalidate()
+	if closer, ok := c.Store.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCachingStoreForwardsOptionalInterfaces(t *testing.T) {
+	store := newTestStore[timedRecord](t)
+	cache := NewCachingStore[timedRecord](store, time.Minute, time.Minute, 8)
+
+	var wrapped Store[timedRecord] = cache
+	if _, ok := wrapped.(Streamer[timedRecord]); !ok {
+		t.Error("CachingStore is not a Streamer")
+	}
+	if _, ok := wrapped.(RangeStreamer[timedRecord]); !ok {
+		t.Error("CachingStore is not a RangeStreamer")
+	}
+	if _, ok := wrapped.(Updater[timedRecord]); !ok {
+		t.Error("CachingStore is not an Updater")
+	}
+
+	old := time.Now().Add(-time.Hour)
+	if err := cache.Save(timedRecord{Timestamp: old, Value: 2}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	rows, err := cache.Aggregate("value", AggSpec{Func: AggCount}, nil, nil)
+	if err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+	if len(rows) != 1 || rows[0].GroupValue != "2" || rows[0].Value != 1 {
+		t.Errorf("Aggregate returned %+v", rows)
+	}
+
+	if err := cache.Backup(filepath.Join(t.TempDir(), "backup.db")); err != nil && !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Backup: %v", err)
+	}
+
+	if err := NewCachingStore[timedRecord](NewMemStore[timedRecord](), time.Minute, time.Minute, 8).Backup("x"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Backup of a MemStore returned %v, want ErrUnsupported", err)
+	}
+}
+
+// racingStore saves a record through the cache in the middle of a query,
+// like a write from another goroutine landing while the query runs
+type racingStore struct {
+	Store[timedRecord]
+	cache *CachingStore[timedRecord]
+	race  bool
+}
+
+func (r *racingStore) FindBetweenTyped(start, end interface{}) ([]timedRecord, error) {
+	records, err := r.Store.FindBetweenTyped(start, end)
+	if r.race {
+		r.race = false
+		if err := r.cache.Save(timedRecord{Timestamp: start.(time.Time), Value: 2}); err != nil {
+			return nil, err
+		}
+	}
+	return records, err
+}
+
+func TestCachingStoreDoesNotCacheAcrossWrite(t *testing.T) {
+	racing := &racingStore{Store: NewMemStore[timedRecord]()}
+	cache := NewCachingStore[timedRecord](racing, time.Minute, time.Minute, 8)
+	racing.cache = cache
+
+	start := time.Now().Add(-2 * time.Hour)
+	end := start.Add(time.Hour)
+	if err := cache.Save(timedRecord{Timestamp: start, Value: 1}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	racing.race = true
+	first, err := cache.FindBetweenTyped(start, end)
+	if err != nil {
+		t.Fatalf("FindBetweenTyped: %v", err)
+	}
+	if len(first) != 1 {
+		t.Fatalf("first query returned %d records, want the 1 from before the write", len(first))
+	}
+
+	// The result from before the write must not have been cached
+	second, err := cache.FindBetweenTyped(start, end)
+	if err != nil {
+		t.Fatalf("FindBetweenTyped: %v", err)
+	}
+	if len(second) != 2 {
+		t.Errorf("second query returned %d records, want 2", len(second))
+	}
+}
+
+func TestCachingStoreCachesSettledPartOfOpenRange(t *testing.T) {
+	store := NewMemStore[timedRecord]()
+	cache := NewCachingStore[timedRecord](store, time.Hour, time.Minute, 8)
+
+	// The boundary is between one and two hours ago
+	now := time.Now()
+	start := now.Add(-3 * time.Hour)
+	if err := cache.Save(timedRecord{Timestamp: now.Add(-165 * time.Minute), Value: 1}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := cache.Save(timedRecord{Timestamp: now.Add(-time.Second), Value: 2}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	first, err := cache.FindBetweenTyped(start, time.Now())
+	if err != nil {
+		t.Fatalf("FindBetweenTyped: %v", err)
+	}
+	if got := values(first); !equalInts(got, []int{1, 2}) {
+		t.Fatalf("first query returned values %v, want [1 2]", got)
+	}
+
+	// Writes that bypass the cache are only seen in the unsettled part
+	if err := store.Save(timedRecord{Timestamp: now.Add(-150 * time.Minute), Value: 3}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Save(timedRecord{Timestamp: time.Now(), Value: 4}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	second, err := cache.FindBetweenTyped(start, time.Now())
+	if err != nil {
+		t.Fatalf("FindBetweenTyped: %v", err)
+	}
+	if got := values(second); !equalInts(got, []int{1, 2, 4}) {
+		t.Errorf("second query returned values %v, want [1 2 4]", got)
+	}
+}
+
+func values(records []timedRecord) []int {
+	values := make([]int, len(records))
+	for i, record := range records {
+		values[i] = record.Value
+	}
+	return values
+}
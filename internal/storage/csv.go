@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ExportCSV writes every record in store to w as CSV, with a header row of
+// the struct's field names. time.Time values are formatted as RFC3339.
+func ExportCSV[T any](store Store[T], w io.Writer) error {
+	return writeCSV(w, func(fn func(T) error) error {
+		return forEach(store, fn)
+	})
+}
+
+// ExportCSVBetween writes the records of store between start and end
+// timestamps to w like ExportCSV
+func ExportCSVBetween[T any](store Store[T], start, end interface{}, w io.Writer) error {
+	return writeCSV(w, func(fn func(T) error) error {
+		return ForEachBetween(store, start, end, fn)
+	})
+}
+
+// writeCSV writes the records passed to fn by each to w as CSV
+func writeCSV[T any](w io.Writer, each func(fn func(T) error) error) error {
+	_, _, fields, err := getFieldsAndTypes[T]()
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(fields); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	row := make([]string, len(fields))
+	err = each(func(record T) error {
+		for i, value := range fieldValues(record, fields) {
+			row[i] = formatCSVValue(value)
+		}
+
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Streamer is implemented by stores that can read records one at a time
+type Streamer[T any] interface {
+	StreamAll(fn func(T) error) error
+}
+
+// forEach passes every record in store to fn, streaming them if the store
+// supports it
+func forEach[T any](store Store[T], fn func(T) error) error {
+	if streamer, ok := store.(Streamer[T]); ok {
+		return streamer.StreamAll(fn)
+	}
+
+	records, err := store.Get()
+	if err != nil {
+		return fmt.Errorf("failed to read records: %w", err)
+	}
+	for _, record := range records {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RangeStreamer is implemented by stores that can read the records of a
+// time range one at a time
+type RangeStreamer[T any] interface {
+	StreamBetween(start, end interface{}, fn func(T) error) error
+}
+
+// ForEachBetween passes every record between start and end timestamps to fn,
+// streaming them if the store supports it
+func ForEachBetween[T any](store Store[T], start, end interface{}, fn func(T) error) error {
+	if streamer, ok := store.(RangeStreamer[T]); ok {
+		return streamer.StreamBetween(start, end, fn)
+	}
+
+	records, err := store.FindBetweenTyped(start, end)
+	if err != nil {
+		return fmt.Errorf("failed to read records: %w", err)
+	}
+	for _, record := range records {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatCSVValue(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+
+	return fmt.Sprint(value)
+}
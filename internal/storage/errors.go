@@ -0,0 +1,34 @@
+package storage
+
+import "errors"
+
+// Errors returned by the stores, wrapped with details. Check for them with
+// errors.Is.
+var (
+	// ErrUnsupported is returned for operations a store does not implement
+	ErrUnsupported = errors.New("operation not supported by this store")
+	// ErrNotTimeType is returned when a time range bound or timestamp field
+	// is not a time.Time
+	ErrNotTimeType = errors.New("not a time.Time")
+	// ErrNoTimestamp is returned for record types without a timestamp field
+	ErrNoTimestamp = errors.New("record has no timestamp field")
+	// ErrCastFailed is returned when a stored value can't be converted to
+	// the type of the record field it is read into
+	ErrCastFailed = errors.New("cannot convert stored value")
+	// ErrNoRows is returned when the record to change doesn't exist
+	ErrNoRows = errors.New("no matching record")
+	// ErrUnknownColumn is returned for a column the record type doesn't have
+	ErrUnknownColumn = errors.New("unknown column")
+	// ErrDuplicateColumn is returned for record types with two fields mapping
+	// to the same column, e.g. through an embedded struct
+	ErrDuplicateColumn = errors.New("duplicate column")
+	// ErrUnsupportedType is returned for record types with a field that
+	// can't be stored in a column, like a slice or a map
+	ErrUnsupportedType = errors.New("unsupported field type")
+	// ErrSchemaTooNew is returned when opening a database stamped with a
+	// newer SchemaVersion than this binary's
+	ErrSchemaTooNew = errors.New("database schema is newer than supported")
+	// ErrNoConditions is returned when an update doesn't say which records
+	// to change, which would change all of them
+	ErrNoConditions = errors.New("update conditions must not be empty")
+)
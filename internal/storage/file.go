@@ -1,32 +1,119 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
-// Store defines the interface for data storage
+// Store defines the interface for data storage. Get, FindBetween and Find
+// return records oldest first, records with the same timestamp in the
+// order they were saved.
 type Store[T any] interface {
 	Save(data T) error
+	SaveContext(ctx context.Context, data T) error
+	SaveBatch(data []T) error
 	Get() ([]T, error)
+	GetContext(ctx context.Context) ([]T, error)
 	FindBetween(start, end interface{}) ([]any, error)
+	FindBetweenTyped(start, end interface{}) ([]T, error)
+	FindBetweenContext(ctx context.Context, start, end interface{}) ([]any, error)
+	Delete(start, end interface{}) (int64, error)
+	Count(start, end interface{}) (int64, error)
+	Find(conds map[string]interface{}, start, end interface{}) ([]T, error)
+	FindLatest(n int) ([]T, error)
+	// FindAfter pages through the records in the order they were saved,
+	// see SQLiteStore.FindAfter
+	FindAfter(afterID int64, limit int) ([]T, int64, error)
+	// Truncate removes every record
+	Truncate() error
+	// Flush makes sure every saved record is on disk, e.g. before shutting
+	// down. It is a no-op for stores that write synchronously.
+	Flush() error
 }
 
-// FileStore implements Store interface using file storage
+// Updater can be implemented by stores that can correct stored records
+type Updater[T any] interface {
+	// UpdateBy replaces every record whose columns equal the values in
+	// conds with data and returns the number of records updated
+	UpdateBy(conds map[string]interface{}, data T) (int64, error)
+}
+
+// UpdateBy replaces the records matching conds with data, or returns
+// ErrUnsupported if store is not an Updater
+func UpdateBy[T any](store Store[T], conds map[string]interface{}, data T) (int64, error) {
+	updater, ok := store.(Updater[T])
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	return updater.UpdateBy(conds, data)
+}
+
+// LatestTimestamp returns the timestamp of the newest record in store, or
+// the zero time if it is empty
+func LatestTimestamp[T any](store Store[T]) (time.Time, error) {
+	latest, err := store.FindLatest(1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(latest) == 0 {
+		return time.Time{}, nil
+	}
+	return getTimestamp(latest[0])
+}
+
+// FileStore implements Store interface using file storage. Every change
+// rewrites the whole file, unless saves are buffered with WithBufferedWrites.
 type FileStore[T any] struct {
 	filepath string
 	mu       sync.RWMutex
 	data     []T
+
+	// bufferSaves and bufferInterval delay persisting saves, see
+	// WithBufferedWrites. unsaved counts the records not in the file yet.
+	bufferSaves    int
+	bufferInterval time.Duration
+	unsaved        int
+	flushTimer     *time.Timer
+}
+
+// FileOption configures optional FileStore settings
+type FileOption func(*fileOptions)
+
+type fileOptions struct {
+	bufferSaves    int
+	bufferInterval time.Duration
+}
+
+// WithBufferedWrites keeps saved records in memory until saves of them
+// have piled up or interval has passed since the first, then writes them
+// all at once. Zero disables either limit. Reads see buffered records, but
+// they are lost if the process dies before Flush or Close.
+func WithBufferedWrites(saves int, interval time.Duration) FileOption {
+	return func(o *fileOptions) {
+		o.bufferSaves = saves
+		o.bufferInterval = interval
+	}
 }
 
-func NewFileStore[T any](filepath string) (*FileStore[T], error) {
+func NewFileStore[T any](filepath string, opts ...FileOption) (*FileStore[T], error) {
+	var o fileOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	fs := &FileStore[T]{
-		filepath: filepath,
-		data:     make([]T, 0),
+		filepath:       filepath,
+		data:           make([]T, 0),
+		bufferSaves:    o.bufferSaves,
+		bufferInterval: o.bufferInterval,
 	}
 
 	// Load existing data if file exists
@@ -49,14 +136,111 @@ func (fs *FileStore[T]) Save(data T) error {
 	defer fs.mu.Unlock()
 
 	fs.data = append(fs.data, data)
-	return fs.persist()
+	return fs.saved(1)
+}
+
+// SaveContext saves a record unless ctx is already cancelled
+func (fs *FileStore[T]) SaveContext(ctx context.Context, data T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fs.Save(data)
+}
+
+// SaveBatch appends all records and persists the file once
+func (fs *FileStore[T]) SaveBatch(data []T) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.data = append(fs.data, data...)
+	return fs.saved(len(data))
 }
 
+// saved persists the file after n records were appended, unless buffering
+// allows waiting for more
+func (fs *FileStore[T]) saved(n int) error {
+	fs.unsaved += n
+
+	if fs.bufferSaves <= 0 && fs.bufferInterval <= 0 {
+		return fs.persist()
+	}
+	if fs.bufferSaves > 0 && fs.unsaved >= fs.bufferSaves {
+		return fs.persist()
+	}
+	if fs.bufferInterval > 0 && fs.flushTimer == nil {
+		fs.flushTimer = time.AfterFunc(fs.bufferInterval, fs.flushBuffered)
+	}
+	return nil
+}
+
+// flushBuffered persists the buffered records once bufferInterval is over
+func (fs *FileStore[T]) flushBuffered() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.flushTimer = nil
+	if fs.unsaved == 0 {
+		return
+	}
+	// The next save schedules another attempt
+	if err := fs.persist(); err != nil {
+		log.Printf("ERROR: Failed to write buffered records to %s: %v", fs.filepath, err)
+	}
+}
+
+// Flush writes buffered records to the file and syncs it to disk
+func (fs *FileStore[T]) Flush() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.unsaved > 0 {
+		if err := fs.persist(); err != nil {
+			return err
+		}
+	}
+
+	// Windows only syncs files opened for writing
+	f, err := os.OpenFile(fs.filepath, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		// Nothing was ever saved
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", fs.filepath, err)
+	}
+	return nil
+}
+
+// Close writes buffered records to the file. The store stays usable.
+func (fs *FileStore[T]) Close() error {
+	return fs.Flush()
+}
+
+// Get returns a copy of all records, oldest first
 func (fs *FileStore[T]) Get() ([]T, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 
-	return fs.data, nil
+	results := make([]T, len(fs.data))
+	copy(results, fs.data)
+	return results, sortByTimestamp(results)
+}
+
+// GetContext returns all records unless ctx is already cancelled
+func (fs *FileStore[T]) GetContext(ctx context.Context) ([]T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.Get()
 }
 
 // FindBetween returns records between start and end timestamps
@@ -64,50 +248,438 @@ func (fs *FileStore[T]) FindBetween(start, end interface{}) ([]any, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 
-	// Convert start and end to time.Time
+	startTime, endTime, err := toTimeRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []any
+
+	for _, item := range fs.data {
+		timestamp, err := getTimestamp(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if inRange(timestamp, startTime, endTime) {
+			results = append(results, item)
+		}
+	}
+
+	return results, sortByTimestamp(results)
+}
+
+// FindBetweenTyped returns records between start and end timestamps as T
+func (fs *FileStore[T]) FindBetweenTyped(start, end interface{}) ([]T, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return findMatching(fs.data, nil, start, end)
+}
+
+// FindBetweenContext returns records between start and end timestamps unless ctx is already cancelled
+func (fs *FileStore[T]) FindBetweenContext(ctx context.Context, start, end interface{}) ([]any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.FindBetween(start, end)
+}
+
+// Count returns the number of records between start and end timestamps.
+// If start and end are both nil every record is counted.
+func (fs *FileStore[T]) Count(start, end interface{}) (int64, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if start == nil && end == nil {
+		return int64(len(fs.data)), nil
+	}
+
+	startTime, endTime, err := toTimeRange(start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, item := range fs.data {
+		timestamp, err := getTimestamp(item)
+		if err != nil {
+			return 0, err
+		}
+
+		if inRange(timestamp, startTime, endTime) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Find returns records between start and end timestamps whose columns equal
+// the values in conds. If start and end are both nil the time range is not
+// restricted.
+func (fs *FileStore[T]) Find(conds map[string]interface{}, start, end interface{}) ([]T, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return findMatching(fs.data, conds, start, end)
+}
+
+// FindLatest returns the n most recent records, newest first
+func (fs *FileStore[T]) FindLatest(n int) ([]T, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return latest(fs.data, n)
+}
+
+// FindAfter returns up to limit records after afterID and the id to pass
+// for the next page. The ids are positions in the file counted from 1, so
+// deleting records between calls can skip some.
+func (fs *FileStore[T]) FindAfter(afterID int64, limit int) ([]T, int64, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return after(fs.data, afterID, limit)
+}
+
+// UpdateBy replaces every record whose columns equal the values in conds
+// with data and returns the number of records updated. conds must not be
+// empty.
+func (fs *FileStore[T]) UpdateBy(conds map[string]interface{}, data T) (int64, error) {
+	if len(conds) == 0 {
+		return 0, ErrNoConditions
+	}
+	if err := checkColumns[T](condColumns(conds)...); err != nil {
+		return 0, err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var updated int64
+	for i, item := range fs.data {
+		if matchConds(item, conds) {
+			fs.data[i] = data
+			updated++
+		}
+	}
+
+	if updated == 0 {
+		return 0, nil
+	}
+	if err := fs.persist(); err != nil {
+		return 0, err
+	}
+
+	return updated, nil
+}
+
+// Delete removes records between start and end timestamps and returns the number removed
+func (fs *FileStore[T]) Delete(start, end interface{}) (int64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	startTime, endTime, err := toTimeRange(start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := make([]T, 0, len(fs.data))
+	for _, item := range fs.data {
+		timestamp, err := getTimestamp(item)
+		if err != nil {
+			return 0, err
+		}
+
+		if !inRange(timestamp, startTime, endTime) {
+			kept = append(kept, item)
+		}
+	}
+
+	removed := int64(len(fs.data) - len(kept))
+	if removed == 0 {
+		return 0, nil
+	}
+
+	fs.data = kept
+	if err := fs.persist(); err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// Truncate removes every record and persists the empty store
+func (fs *FileStore[T]) Truncate() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.data = []T{}
+	return fs.persist()
+}
+
+// Vacuum rewrites the file without indentation to reduce its size
+func (fs *FileStore[T]) Vacuum() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, err := json.Marshal(fs.data)
+	if err != nil {
+		return err
+	}
+	return fs.write(data)
+}
+
+func (fs *FileStore[T]) persist() error {
+	data, err := json.MarshalIndent(fs.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fs.write(data)
+}
+
+// write replaces the file with data, which holds every record, so nothing
+// is left buffered
+func (fs *FileStore[T]) write(data []byte) error {
+	if err := os.WriteFile(fs.filepath, data, 0644); err != nil {
+		return err
+	}
+
+	fs.unsaved = 0
+	if fs.flushTimer != nil {
+		fs.flushTimer.Stop()
+		fs.flushTimer = nil
+	}
+	return nil
+}
+
+// toTimeRange converts start and end to time.Time
+func toTimeRange(start, end interface{}) (time.Time, time.Time, error) {
 	startTime, ok := start.(time.Time)
 	if !ok {
-		return nil, fmt.Errorf("start time must be time.Time, got %T", start)
+		return time.Time{}, time.Time{}, fmt.Errorf("start time: %w, got %T", ErrNotTimeType, start)
 	}
 
 	endTime, ok := end.(time.Time)
 	if !ok {
-		return nil, fmt.Errorf("end time must be time.Time, got %T", end)
+		return time.Time{}, time.Time{}, fmt.Errorf("end time: %w, got %T", ErrNotTimeType, end)
 	}
 
-	var results []any
+	return startTime, endTime, nil
+}
 
-	for _, item := range fs.data {
-		// Use reflection to get the Timestamp field
-		v := reflect.ValueOf(item)
-		if v.Kind() == reflect.Ptr {
-			v = v.Elem()
-		}
+// getTimestamp uses reflection to read the timestamp field of a record,
+// Timestamp unless the type implements TimestampColumn
+func getTimestamp(item any) (time.Time, error) {
+	v := reflect.ValueOf(item)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	// Honor a custom timestamp column the same way SQLiteStore does
+	name := "Timestamp"
+	if tc, ok := v.Interface().(TimestampColumn); ok {
+		name = tc.TimestampColumn()
+	}
 
-		timestampField := v.FieldByName("Timestamp")
-		if !timestampField.IsValid() {
-			return nil, fmt.Errorf("struct must have Timestamp field")
+	timestampField := v.FieldByNameFunc(func(field string) bool {
+		return strings.EqualFold(field, name)
+	})
+	if !timestampField.IsValid() {
+		return time.Time{}, fmt.Errorf("%w: struct must have %s field", ErrNoTimestamp, name)
+	}
+
+	timestamp, ok := timestampField.Interface().(time.Time)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s field: %w", name, ErrNotTimeType)
+	}
+
+	return timestamp, nil
+}
+
+// findMatching filters data by conds and, unless both are nil, by the time range
+func findMatching[T any](data []T, conds map[string]interface{}, start, end interface{}) ([]T, error) {
+	if err := checkColumns[T](condColumns(conds)...); err != nil {
+		return nil, err
+	}
+
+	filterTime := start != nil || end != nil
+	var startTime, endTime time.Time
+	if filterTime {
+		var err error
+		if startTime, endTime, err = toTimeRange(start, end); err != nil {
+			return nil, err
 		}
+	}
 
-		timestamp, ok := timestampField.Interface().(time.Time)
-		if !ok {
-			return nil, fmt.Errorf("Timestamp field must be time.Time")
+	var results []T
+	for _, item := range data {
+		if filterTime {
+			timestamp, err := getTimestamp(item)
+			if err != nil {
+				return nil, err
+			}
+			if !inRange(timestamp, startTime, endTime) {
+				continue
+			}
 		}
 
-		// Check if timestamp is within range
-		if (timestamp.Equal(startTime) || timestamp.After(startTime)) &&
-			(timestamp.Equal(endTime) || timestamp.Before(endTime)) {
+		if matchConds(item, conds) {
 			results = append(results, item)
 		}
 	}
 
+	return results, sortByTimestamp(results)
+}
+
+// sortByTimestamp sorts records oldest first, keeping the order of records
+// with the same timestamp
+func sortByTimestamp[T any](records []T) error {
+	type timed struct {
+		timestamp time.Time
+		record    T
+	}
+
+	sorted := make([]timed, len(records))
+	for i, record := range records {
+		timestamp, err := getTimestamp(record)
+		if err != nil {
+			return err
+		}
+		sorted[i] = timed{timestamp: timestamp, record: record}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].timestamp.Before(sorted[j].timestamp)
+	})
+
+	for i := range sorted {
+		records[i] = sorted[i].record
+	}
+	return nil
+}
+
+// after returns up to limit records of data following position afterID,
+// counted from 1, and the position of the last one returned
+func after[T any](data []T, afterID int64, limit int) ([]T, int64, error) {
+	if limit < 0 {
+		return nil, afterID, fmt.Errorf("limit must not be negative, got %d", limit)
+	}
+
+	start := min(max(afterID, 0), int64(len(data)))
+	end := min(start+int64(limit), int64(len(data)))
+
+	return append([]T(nil), data[start:end]...), max(end, afterID), nil
+}
+
+// latest returns the n records of data with the newest timestamps, newest
+// first. Records are usually saved in time order, so the sort is stable and
+// ties keep the record saved last first.
+func latest[T any](data []T, n int) ([]T, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("n must not be negative, got %d", n)
+	}
+
+	timestamps := make([]time.Time, len(data))
+	order := make([]int, len(data))
+	for i, item := range data {
+		timestamp, err := getTimestamp(item)
+		if err != nil {
+			return nil, err
+		}
+		timestamps[i] = timestamp
+		order[i] = len(data) - 1 - i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return timestamps[order[i]].After(timestamps[order[j]])
+	})
+
+	results := make([]T, 0, min(n, len(data)))
+	for _, i := range order[:min(n, len(order))] {
+		results = append(results, data[i])
+	}
+
 	return results, nil
 }
 
-func (fs *FileStore[T]) persist() error {
-	data, err := json.MarshalIndent(fs.data, "", "  ")
+// condColumns returns the column names of conds in sorted order
+func condColumns(conds map[string]interface{}) []string {
+	columns := make([]string, 0, len(conds))
+	for column := range conds {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// checkColumns makes sure every name is a column of T
+func checkColumns[T any](names ...string) error {
+	columns, _, _, err := getFieldsAndTypes[T]()
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(fs.filepath, data, 0644)
+
+	known := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		known[column] = true
+	}
+
+	for _, name := range names {
+		if !known[name] {
+			return fmt.Errorf("%w %q", ErrUnknownColumn, name)
+		}
+	}
+
+	return nil
+}
+
+// matchConds reports whether every column named in conds equals its value
+func matchConds(item any, conds map[string]interface{}) bool {
+	v := reflect.ValueOf(item)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	for column, want := range conds {
+		field := v.FieldByNameFunc(func(name string) bool {
+			return strings.ToLower(name) == column
+		})
+		if !field.IsValid() || !equalValue(field, want) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalValue compares a struct field with a condition value, converting
+// between numeric types so e.g. an int matches an int64 field
+func equalValue(field reflect.Value, want interface{}) bool {
+	w := reflect.ValueOf(want)
+	if !w.IsValid() {
+		return false
+	}
+
+	// Refuse conversions like int to string, which Go would allow
+	if (field.Kind() == reflect.String) != (w.Kind() == reflect.String) {
+		return false
+	}
+	if !w.Type().ConvertibleTo(field.Type()) {
+		return false
+	}
+	w = w.Convert(field.Type())
+
+	if t, ok := field.Interface().(time.Time); ok {
+		return t.Equal(w.Interface().(time.Time))
+	}
+
+	return field.Interface() == w.Interface()
+}
+
+// inRange reports whether timestamp lies within [start, end]
+func inRange(timestamp, start, end time.Time) bool {
+	return (timestamp.Equal(start) || timestamp.After(start)) &&
+		(timestamp.Equal(end) || timestamp.Before(end))
 }
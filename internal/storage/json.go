@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ExportJSON writes every record in store to w as a JSON array. Records are
+// encoded one at a time, so stores implementing Streamer are never loaded
+// into memory as a whole.
+func ExportJSON[T any](store Store[T], w io.Writer) error {
+	return writeJSON(w, func(fn func(T) error) error {
+		return forEach(store, fn)
+	})
+}
+
+// ExportJSONBetween writes the records of store between start and end
+// timestamps to w like ExportJSON
+func ExportJSONBetween[T any](store Store[T], start, end interface{}, w io.Writer) error {
+	return writeJSON(w, func(fn func(T) error) error {
+		return ForEachBetween(store, start, end, fn)
+	})
+}
+
+// writeJSON writes the records passed to fn by each to w as a JSON array
+func writeJSON[T any](w io.Writer, each func(fn func(T) error) error) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	first := true
+	err := each(func(record T) error {
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
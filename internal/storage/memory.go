@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// MemStore implements Store interface entirely in memory, mainly for testing
+type MemStore[T any] struct {
+	mu   sync.RWMutex
+	data []T
+}
+
+// NewMemStore creates an empty in-memory store
+func NewMemStore[T any]() *MemStore[T] {
+	return &MemStore[T]{
+		data: make([]T, 0),
+	}
+}
+
+func (ms *MemStore[T]) Save(data T) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.data = append(ms.data, data)
+	return nil
+}
+
+// SaveContext saves a record unless ctx is already cancelled
+func (ms *MemStore[T]) SaveContext(ctx context.Context, data T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ms.Save(data)
+}
+
+// SaveBatch appends all records
+func (ms *MemStore[T]) SaveBatch(data []T) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.data = append(ms.data, data...)
+	return nil
+}
+
+// Get returns a copy of all records, oldest first
+func (ms *MemStore[T]) Get() ([]T, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	results := make([]T, len(ms.data))
+	copy(results, ms.data)
+	return results, sortByTimestamp(results)
+}
+
+// GetContext returns all records unless ctx is already cancelled
+func (ms *MemStore[T]) GetContext(ctx context.Context) ([]T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ms.Get()
+}
+
+// FindBetween returns records between start and end timestamps
+func (ms *MemStore[T]) FindBetween(start, end interface{}) ([]any, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	startTime, endTime, err := toTimeRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []any
+	for _, item := range ms.data {
+		timestamp, err := getTimestamp(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if inRange(timestamp, startTime, endTime) {
+			results = append(results, item)
+		}
+	}
+
+	return results, sortByTimestamp(results)
+}
+
+// FindBetweenTyped returns records between start and end timestamps as T
+func (ms *MemStore[T]) FindBetweenTyped(start, end interface{}) ([]T, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return findMatching(ms.data, nil, start, end)
+}
+
+// FindBetweenContext returns records between start and end timestamps unless ctx is already cancelled
+func (ms *MemStore[T]) FindBetweenContext(ctx context.Context, start, end interface{}) ([]any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ms.FindBetween(start, end)
+}
+
+// Count returns the number of records between start and end timestamps.
+// If start and end are both nil every record is counted.
+func (ms *MemStore[T]) Count(start, end interface{}) (int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if start == nil && end == nil {
+		return int64(len(ms.data)), nil
+	}
+
+	startTime, endTime, err := toTimeRange(start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, item := range ms.data {
+		timestamp, err := getTimestamp(item)
+		if err != nil {
+			return 0, err
+		}
+
+		if inRange(timestamp, startTime, endTime) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Find returns records between start and end timestamps whose columns equal
+// the values in conds. If start and end are both nil the time range is not
+// restricted.
+func (ms *MemStore[T]) Find(conds map[string]interface{}, start, end interface{}) ([]T, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return findMatching(ms.data, conds, start, end)
+}
+
+// FindLatest returns the n most recent records, newest first
+func (ms *MemStore[T]) FindLatest(n int) ([]T, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return latest(ms.data, n)
+}
+
+// FindAfter returns up to limit records after afterID and the id to pass
+// for the next page. The ids are positions counted from 1, like FileStore's.
+func (ms *MemStore[T]) FindAfter(afterID int64, limit int) ([]T, int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return after(ms.data, afterID, limit)
+}
+
+// Delete removes records between start and end timestamps and returns the number removed
+func (ms *MemStore[T]) Delete(start, end interface{}) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	startTime, endTime, err := toTimeRange(start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := make([]T, 0, len(ms.data))
+	for _, item := range ms.data {
+		timestamp, err := getTimestamp(item)
+		if err != nil {
+			return 0, err
+		}
+
+		if !inRange(timestamp, startTime, endTime) {
+			kept = append(kept, item)
+		}
+	}
+
+	removed := int64(len(ms.data) - len(kept))
+	ms.data = kept
+	return removed, nil
+}
+
+// Truncate removes every record
+func (ms *MemStore[T]) Truncate() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.data = nil
+	return nil
+}
+
+// Flush does nothing, there is no disk to write to
+func (ms *MemStore[T]) Flush() error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package storage
+
+import "fmt"
+
+// migrateBatchSize is the number of records saved to the destination at once
+const migrateBatchSize = 500
+
+// Migrate copies every record of src into dst, e.g. to move data saved by a
+// FileStore into SQLite. Records are appended, so migrating the same data
+// twice saves it twice.
+func Migrate[T any](src Store[T], dst Store[T]) error {
+	batch := make([]T, 0, migrateBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := dst.SaveBatch(batch); err != nil {
+			return fmt.Errorf("failed to save records: %w", err)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := forEach(src, func(record T) error {
+		batch = append(batch, record)
+		if len(batch) >= migrateBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
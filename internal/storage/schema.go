@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SchemaVersion is the version of the database layout this binary writes.
+// Adding a field to a record type needs no bump, the column is added when
+// the store is opened. Bump it for changes older binaries would misread,
+// like a renamed column or a field whose meaning changed. Version 2 stores
+// times in UTC, older binaries would write them with the local offset.
+const SchemaVersion = 2
+
+// checkSchemaVersion stamps the database with SchemaVersion, raising but
+// never lowering the stored version, and fails with ErrSchemaTooNew if a
+// newer binary has already written it
+func checkSchemaVersion(db *sql.DB) error {
+	// A single row, so two stores opening the database at once can't
+	// stamp it twice
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		version INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO schema_version (id, version) VALUES (1, ?)
+		ON CONFLICT(id) DO UPDATE SET version = excluded.version WHERE excluded.version > version`, SchemaVersion); err != nil {
+		return fmt.Errorf("failed to stamp schema version: %w", err)
+	}
+
+	var version int
+	if err := db.QueryRow("SELECT version FROM schema_version WHERE id = 1").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: version %d, this binary supports up to %d, upgrade devstats to open it", ErrSchemaTooNew, version, SchemaVersion)
+	}
+
+	return nil
+}
@@ -1,21 +1,31 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // SQLiteStore implements Store interface using SQLite
 type SQLiteStore[T any] struct {
-	db    *sql.DB
-	mu    sync.RWMutex
-	table string
+	db              *sql.DB
+	mu              sync.RWMutex
+	table           string
+	timestampColumn string
+
+	// The schema is fixed per type, so the INSERT is built and prepared once
+	insertSQL    string
+	insertFields []string
+	insertStmt   *sql.Stmt
 }
 
 // TableName interface can be implemented to override table name
@@ -23,19 +33,107 @@ type TableName interface {
 	TableName() string
 }
 
-func NewSQLiteStore[T any](dbPath string) (*SQLiteStore[T], error) {
-	db, err := sql.Open("sqlite3", dbPath)
+// TimestampColumn interface can be implemented to override the column used for time range queries
+type TimestampColumn interface {
+	TimestampColumn() string
+}
+
+// UniqueKey interface can be implemented to declare the columns that identify
+// a record. A UNIQUE index is created on them so Upsert can replace records.
+type UniqueKey interface {
+	UniqueKey() []string
+}
+
+// defaultBusyTimeout is how long SQLite waits on a locked database before giving up
+const defaultBusyTimeout = 5 * time.Second
+
+// Option configures optional SQLiteStore settings
+type Option func(*options)
+
+type options struct {
+	busyTimeout     time.Duration
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+}
+
+// WithBusyTimeout sets how long a connection waits for a lock before
+// failing with "database is locked". Raise it on slow disks.
+func WithBusyTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.busyTimeout = timeout
+	}
+}
+
+// WithMaxOpenConns sets how many connections the store may open. Defaults
+// to 1: SQLite allows a single writer at a time, so more connections mostly
+// wait on each other's locks. Raising it only helps read-heavy stores.
+func WithMaxOpenConns(n int) Option {
+	return func(o *options) {
+		o.maxOpenConns = n
+	}
+}
+
+// WithMaxIdleConns sets how many connections are kept open while unused.
+// Defaults to 1.
+func WithMaxIdleConns(n int) Option {
+	return func(o *options) {
+		o.maxIdleConns = n
+	}
+}
+
+// WithConnMaxLifetime closes connections once they are older than d. Zero,
+// the default, keeps them open.
+func WithConnMaxLifetime(d time.Duration) Option {
+	return func(o *options) {
+		o.connMaxLifetime = d
+	}
+}
+
+func NewSQLiteStore[T any](dbPath string, opts ...Option) (*SQLiteStore[T], error) {
+	o := options{
+		busyTimeout:  defaultBusyTimeout,
+		maxOpenConns: 1,
+		maxIdleConns: 1,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Catch fields the driver can't store before touching the database,
+	// rather than failing on the first Save
+	if err := checkFieldTypes[T](); err != nil {
+		log.Printf("ERROR: Unsupported record type: %v", err)
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", dsn(dbPath, o))
 	if err != nil {
 		log.Printf("ERROR: Failed to open database: %v", err)
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	// SQLite allows a single writer at a time, so by default a single
+	// connection avoids lock contention between pooled connections of the
+	// same store
+	db.SetMaxOpenConns(o.maxOpenConns)
+	db.SetMaxIdleConns(o.maxIdleConns)
+	db.SetConnMaxLifetime(o.connMaxLifetime)
+
 	var zero T
 	table := getTableName(zero)
 
 	store := &SQLiteStore[T]{
-		db:    db,
-		table: table,
+		db:              db,
+		table:           table,
+		timestampColumn: getTimestampColumn(zero),
+	}
+
+	// Refuse databases written by a newer binary before changing anything
+	if err := checkSchemaVersion(db); err != nil {
+		db.Close()
+		log.Printf("ERROR: Failed to check schema version: %v", err)
+		return nil, fmt.Errorf("failed to open %s: %w", dbPath, err)
 	}
 
 	// Create table if it doesn't exist
@@ -45,9 +143,25 @@ func NewSQLiteStore[T any](dbPath string) (*SQLiteStore[T], error) {
 		return nil, fmt.Errorf("failed to initialize table: %w", err)
 	}
 
+	if err := store.prepareInsert(); err != nil {
+		db.Close()
+		log.Printf("ERROR: Failed to prepare insert: %v", err)
+		return nil, fmt.Errorf("failed to prepare insert: %w", err)
+	}
+
 	return store, nil
 }
 
+// dsn builds the connection string. The pragmas are passed as DSN parameters
+// so the driver applies them to every connection the pool opens, not just one.
+func dsn(dbPath string, o options) string {
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_journal_mode=WAL&_busy_timeout=%d", dbPath, sep, o.busyTimeout.Milliseconds())
+}
+
 func getTableName[T any](data T) string {
 	// Check if type implements TableName interface
 	if tn, ok := any(data).(TableName); ok {
@@ -62,6 +176,14 @@ func getTableName[T any](data T) string {
 	return strings.ToLower(t.Name()) + "s"
 }
 
+func getTimestampColumn[T any](data T) string {
+	// Check if type implements TimestampColumn interface
+	if tc, ok := any(data).(TimestampColumn); ok {
+		return tc.TimestampColumn()
+	}
+	return "timestamp"
+}
+
 func getFieldsAndTypes[T any]() ([]string, []string, []string, error) {
 	var data T
 	t := reflect.TypeOf(data)
@@ -69,25 +191,18 @@ func getFieldsAndTypes[T any]() ([]string, []string, []string, error) {
 		t = t.Elem()
 	}
 
-	var columns, types, fields []string
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-
-		// Skip unexported fields
-		if !field.IsExported() {
-			continue
-		}
-
-		sqlTag := field.Tag.Get("sql")
-		if sqlTag == "-" {
-			continue
-		}
+	structFields, err := columnFields(t)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
+	var columns, types, fields []string
+	for _, field := range structFields {
 		columns = append(columns, strings.ToLower(field.Name))
 		fields = append(fields, field.Name)
 
 		// Parse SQL type from tag or infer from Go type
-		if sqlTag != "" {
+		if sqlTag := field.Tag.Get("sql"); sqlTag != "" {
 			types = append(types, sqlTag)
 		} else {
 			sqlType := getSQLType(field.Type)
@@ -98,14 +213,108 @@ func getFieldsAndTypes[T any]() ([]string, []string, []string, error) {
 	return columns, types, fields, nil
 }
 
+// columnFields returns the fields of struct type t that are stored as
+// columns. The fields of embedded structs are flattened into t's, so a
+// shared struct like a timestamp can be embedded in several types. Two
+// fields mapping to the same column are an error, since only one of them
+// could be read back.
+func columnFields(t reflect.Type) ([]reflect.StructField, error) {
+	var fields []reflect.StructField
+	seen := make(map[string]string)
+
+	var walk func(st reflect.Type, path string) error
+	walk = func(st reflect.Type, path string) error {
+		for i := 0; i < st.NumField(); i++ {
+			field := st.Field(i)
+			if field.Tag.Get("sql") == "-" {
+				continue
+			}
+
+			// Descend into embedded structs, even unexported ones, whose
+			// exported fields are promoted
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				if err := walk(field.Type, path+field.Name+"."); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Skip unexported fields
+			if !field.IsExported() {
+				continue
+			}
+
+			column := strings.ToLower(field.Name)
+			if other, ok := seen[column]; ok {
+				return fmt.Errorf("%w %q: fields %s and %s%s of %s both map to it", ErrDuplicateColumn, column, other, path, field.Name, t.Name())
+			}
+			seen[column] = path + field.Name
+			fields = append(fields, field)
+		}
+		return nil
+	}
+
+	if err := walk(t, ""); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// timeType is the reflect.Type of time.Time, the only struct stored as a column
+var timeType = reflect.TypeOf(time.Time{})
+
+// checkFieldTypes makes sure every column field of T has a type that can be
+// written to and read back from SQLite, see supportedFieldType
+func checkFieldTypes[T any]() error {
+	var data T
+	t := reflect.TypeOf(data)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fields, err := columnFields(t)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		if !supportedFieldType(field.Type) {
+			return fmt.Errorf("%w: field %s of %s is a %s, tag it `sql:\"-\"` to skip it", ErrUnsupportedType, field.Name, t.Name(), field.Type)
+		}
+	}
+	return nil
+}
+
+// supportedFieldType reports whether values of t can be stored in a column:
+// strings, bools, numbers, []byte and time.Time. Slices, maps, pointers and
+// other structs would be inserted as raw Go values, which the driver rejects.
+func supportedFieldType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	case reflect.Struct:
+		return t == timeType
+	default:
+		return false
+	}
+}
+
 func getSQLType(t reflect.Type) string {
 	switch t.Kind() {
 	case reflect.String:
 		return "TEXT"
-	case reflect.Int, reflect.Int64:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		return "INTEGER"
-	case reflect.Float64:
+	case reflect.Float32, reflect.Float64:
 		return "REAL"
+	case reflect.Slice:
+		return "BLOB"
 	case reflect.Bool:
 		return "BOOLEAN"
 	default:
@@ -132,146 +341,1104 @@ func (s *SQLiteStore[T]) initTable() error {
 		%s
 	)`, s.table, strings.Join(fields, ",\n\t\t"))
 
-	_, err = s.db.Exec(schema)
-	return err
-}
+	if _, err = s.db.Exec(schema); err != nil {
+		return err
+	}
 
-func (s *SQLiteStore[T]) Save(data T) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if err := s.migrateTable(columns, types); err != nil {
+		return err
+	}
 
-	columns, _, fields, err := getFieldsAndTypes[T]()
+	if err := s.convertTimesToUTC(); err != nil {
+		return err
+	}
+
+	return s.createIndexes(columns)
+}
+
+// createIndexes indexes the timestamp column used for range queries and any
+// column whose field is tagged `index:"true"`
+func (s *SQLiteStore[T]) createIndexes(columns []string) error {
+	var indexed []string
+	if slices.Contains(columns, s.timestampColumn) {
+		indexed = append(indexed, s.timestampColumn)
+	}
+	indexedColumns, err := getIndexedColumns[T]()
 	if err != nil {
-		log.Printf("ERROR: Failed to get fields and types: %v", err)
 		return err
 	}
+	indexed = append(indexed, indexedColumns...)
 
-	// Create placeholders
-	placeholders := make([]string, len(columns))
-	for i := range placeholders {
-		placeholders[i] = "?"
+	for _, column := range indexed {
+		query := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_%s ON %s(%s)", s.table, column, s.table, column)
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create index on %s: %w", column, err)
+		}
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-		s.table,
-		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "))
+	var zero T
+	if uk, ok := any(zero).(UniqueKey); ok {
+		return s.createUniqueIndex(uk.UniqueKey())
+	}
 
-	// Extract values using reflection
-	values := make([]interface{}, len(fields))
-	v := reflect.ValueOf(data)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
+	return nil
+}
+
+// createUniqueIndex adds a UNIQUE index on keyColumns. Tables written before
+// the index existed may hold duplicates, so only the newest row of each key
+// is kept.
+func (s *SQLiteStore[T]) createUniqueIndex(keyColumns []string) error {
+	if err := checkColumns[T](keyColumns...); err != nil {
+		return err
 	}
+	keys := strings.Join(keyColumns, ", ")
+	name := fmt.Sprintf("uniq_%s_%s", s.table, strings.Join(keyColumns, "_"))
 
-	for i, field := range fields {
-		values[i] = v.FieldByName(field).Interface()
+	if err := s.dropUniqueIndexes(name, true); err != nil {
+		return err
 	}
 
-	_, err = s.db.Exec(query, values...)
+	dedupe := fmt.Sprintf("DELETE FROM %s WHERE id NOT IN (SELECT MAX(id) FROM %s GROUP BY %s)", s.table, s.table, keys)
+	result, err := s.db.Exec(dedupe)
 	if err != nil {
-		log.Printf("ERROR: Failed to insert data: %v", err)
-		return fmt.Errorf("failed to insert data: %w", err)
+		return fmt.Errorf("failed to remove duplicate rows: %w", err)
+	}
+	if removed, _ := result.RowsAffected(); removed > 0 {
+		log.Printf("Removed %d duplicate rows from table %s", removed, s.table)
+	}
+
+	query := fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s(%s)", name, s.table, keys)
+	if _, err := s.db.Exec(query); err != nil {
+		return fmt.Errorf("failed to create unique index: %w", err)
 	}
 
 	return nil
 }
 
-// FindBetween returns records between start and end timestamps
-func (s *SQLiteStore[T]) FindBetween(start, end interface{}) ([]any, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	query := fmt.Sprintf("SELECT * FROM %s WHERE timestamp BETWEEN ? AND ?", s.table)
-	rows, err := s.db.Query(query, start, end)
+// dropUniqueIndexes drops the unique indexes of the table other than keep.
+// Stale ones are left behind when a type's UniqueKey gained a column, and
+// would reject rows that differ only in the new column. logStale logs each
+// one dropped.
+func (s *SQLiteStore[T]) dropUniqueIndexes(keep string, logStale bool) error {
+	rows, err := s.db.Query("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name GLOB 'uniq_*'", s.table)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query data: %w", err)
+		return fmt.Errorf("failed to list indexes: %w", err)
 	}
-	defer rows.Close()
 
-	var results []any
+	var stale []string
 	for rows.Next() {
-		var data T
-		v := reflect.ValueOf(&data).Elem()
-
-		columns, err := rows.Columns()
-		if err != nil {
-			return nil, err
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list indexes: %w", err)
 		}
+		if name != keep {
+			stale = append(stale, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list indexes: %w", err)
+	}
 
-		// Create a slice of interface{} to hold the values
-		values := make([]interface{}, len(columns))
-		for i := range values {
-			values[i] = new(interface{})
+	for _, name := range stale {
+		if _, err := s.db.Exec(fmt.Sprintf("DROP INDEX IF EXISTS %s", name)); err != nil {
+			return fmt.Errorf("failed to drop index %s: %w", name, err)
+		}
+		if logStale {
+			log.Printf("Dropped outdated unique index %s", name)
 		}
+	}
 
-		err = rows.Scan(values...)
-		if err != nil {
-			return nil, err
+	return nil
+}
+
+// getIndexedColumns returns the columns of fields tagged `index:"true"`
+func getIndexedColumns[T any]() ([]string, error) {
+	var data T
+	t := reflect.TypeOf(data)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fields, err := columnFields(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	for _, field := range fields {
+		if field.Tag.Get("index") == "true" {
+			columns = append(columns, strings.ToLower(field.Name))
 		}
+	}
 
-		// Skip the ID column
-		for i := 1; i < len(columns); i++ {
-			field := v.FieldByName(strings.Title(columns[i]))
-			if field.IsValid() {
-				val := reflect.ValueOf(*(values[i].(*interface{})))
-				field.Set(val.Convert(field.Type()))
-			}
+	return columns, nil
+}
+
+// migrateTable adds any reflected columns missing from an existing table.
+// Columns that no longer have a matching field are left in place.
+func (s *SQLiteStore[T]) migrateTable(columns, types []string) error {
+	existing, err := s.existingColumns()
+	if err != nil {
+		return err
+	}
+
+	for i, column := range columns {
+		if existing[column] {
+			continue
 		}
 
-		results = append(results, data)
+		// Existing rows get NULL for the new column, so a NOT NULL
+		// constraint without a default would make SQLite reject the ALTER
+		columnType := strings.TrimSpace(strings.Replace(types[i], "NOT NULL", "", 1))
+
+		alter := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", s.table, column, columnType)
+		if _, err := s.db.Exec(alter); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", column, err)
+		}
+		log.Printf("Added column %s to table %s", column, s.table)
 	}
 
-	return results, nil
+	return nil
 }
 
-func (s *SQLiteStore[T]) Get() ([]T, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// utcBatchSize is the number of rows convertTimesToUTC rewrites per query
+const utcBatchSize = 1000
 
-	query := fmt.Sprintf("SELECT * FROM %s", s.table)
-	rows, err := s.db.Query(query)
+// convertTimesToUTC rewrites the times of a table written before times were
+// stored in UTC, when they were stored with the local offset. SQLite
+// compares them as text, so mixed offsets break range queries and ordering.
+// Converted tables are recorded in utc_tables so this runs once per table.
+func (s *SQLiteStore[T]) convertTimesToUTC() error {
+	if _, err := s.db.Exec("CREATE TABLE IF NOT EXISTS utc_tables (name TEXT PRIMARY KEY)"); err != nil {
+		return fmt.Errorf("failed to create utc_tables table: %w", err)
+	}
+
+	var converted int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM utc_tables WHERE name = ?", s.table).Scan(&converted); err != nil {
+		return fmt.Errorf("failed to read utc_tables: %w", err)
+	}
+	if converted > 0 {
+		return nil
+	}
+
+	var data T
+	t := reflect.TypeOf(data)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fields, err := columnFields(t)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query data: %w", err)
+		return err
 	}
-	defer rows.Close()
 
-	var results []T
-	for rows.Next() {
-		var data T
-		v := reflect.ValueOf(&data).Elem()
+	// Times of the same instant written with different offsets become
+	// equal, so the unique indexes go until createIndexes dedupes the rows
+	// and creates them again
+	if err := s.dropUniqueIndexes("", false); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-		columns, err := rows.Columns()
+	var rewritten int64
+	for _, field := range fields {
+		if field.Type != timeType {
+			continue
+		}
+		n, err := convertColumnToUTC(tx, s.table, strings.ToLower(field.Name))
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to convert %s to UTC: %w", field.Name, err)
 		}
+		rewritten += n
+	}
 
-		// Create a slice of interface{} to hold the values
-		values := make([]interface{}, len(columns))
-		for i := range values {
-			values[i] = new(interface{})
-		}
+	if _, err := tx.Exec("INSERT INTO utc_tables (name) VALUES (?)", s.table); err != nil {
+		return fmt.Errorf("failed to record UTC conversion: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if rewritten > 0 {
+		log.Printf("Converted %d times in table %s to UTC", rewritten, s.table)
+	}
+	return nil
+}
+
+// convertColumnToUTC rewrites every time in column that isn't in UTC yet,
+// a batch of rows at a time, and returns the number of rows rewritten
+func convertColumnToUTC(tx *sql.Tx, table, column string) (int64, error) {
+	query := fmt.Sprintf("SELECT id, %s FROM %s WHERE id > ? AND %s IS NOT NULL ORDER BY id LIMIT ?", column, table, column)
+	update := fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, column)
 
-		err = rows.Scan(values...)
+	var rewritten int64
+	var afterID int64
+	for {
+		rows, err := tx.Query(query, afterID, utcBatchSize)
 		if err != nil {
-			return nil, err
+			return rewritten, err
 		}
 
-		// Skip the ID column
-		for i := 1; i < len(columns); i++ {
-			field := v.FieldByName(strings.Title(columns[i]))
-			if field.IsValid() {
-				val := reflect.ValueOf(*(values[i].(*interface{})))
-				field.Set(val.Convert(field.Type()))
+		times := make(map[int64]time.Time)
+		var scanned int
+		for rows.Next() {
+			var id int64
+			var raw interface{}
+			if err := rows.Scan(&id, &raw); err != nil {
+				rows.Close()
+				return rewritten, err
+			}
+			scanned++
+			afterID = id
+
+			// Leave values that don't parse as they are, they can't be
+			// read back either way
+			t, err := parseTime(raw)
+			if err != nil {
+				continue
+			}
+			if _, offset := t.Zone(); offset != 0 {
+				times[id] = t
 			}
 		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rewritten, err
+		}
 
-		results = append(results, data)
+		for id, t := range times {
+			if _, err := tx.Exec(update, t.UTC(), id); err != nil {
+				return rewritten, err
+			}
+			rewritten++
+		}
+
+		if scanned < utcBatchSize {
+			return rewritten, nil
+		}
 	}
+}
 
-	return results, nil
+// existingColumns returns the set of columns currently in the table
+func (s *SQLiteStore[T]) existingColumns() (map[string]bool, error) {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", s.table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    bool
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+
+	return columns, rows.Err()
+}
+
+func (s *SQLiteStore[T]) Save(data T) error {
+	return s.SaveContext(context.Background(), data)
+}
+
+// SaveContext inserts a record, aborting if ctx is cancelled
+func (s *SQLiteStore[T]) SaveContext(ctx context.Context, data T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.insertStmt.ExecContext(ctx, fieldValues(data, s.insertFields)...)
+	if err != nil {
+		log.Printf("ERROR: Failed to insert data: %v", err)
+		return fmt.Errorf("failed to insert data: %w", err)
+	}
+
+	return nil
+}
+
+// Upsert inserts data, or updates the existing record with the same values in
+// keyColumns. The table needs a UNIQUE index on exactly those columns, which
+// is created for types implementing UniqueKey.
+func (s *SQLiteStore[T]) Upsert(data T, keyColumns []string) error {
+	if err := checkColumns[T](keyColumns...); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query, fields := s.insertSQL, s.insertFields
+
+	columns, _, _, err := getFieldsAndTypes[T]()
+	if err != nil {
+		return err
+	}
+
+	var updates []string
+	for _, column := range columns {
+		if !slices.Contains(keyColumns, column) {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", column, column))
+		}
+	}
+
+	query += fmt.Sprintf(" ON CONFLICT(%s)", strings.Join(keyColumns, ", "))
+	if len(updates) == 0 {
+		query += " DO NOTHING"
+	} else {
+		query += " DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+
+	if _, err := s.db.Exec(query, fieldValues(data, fields)...); err != nil {
+		log.Printf("ERROR: Failed to upsert data: %v", err)
+		return fmt.Errorf("failed to upsert data: %w", err)
+	}
+
+	return nil
+}
+
+// SaveUnique upserts data on its UniqueKey columns when both the type and
+// the store support it, and saves it normally otherwise
+func SaveUnique[T any](store Store[T], data T) error {
+	upserter, ok := store.(interface {
+		Upsert(data T, keyColumns []string) error
+	})
+	if uk, isKeyed := any(data).(UniqueKey); ok && isKeyed {
+		return upserter.Upsert(data, uk.UniqueKey())
+	}
+
+	return store.Save(data)
+}
+
+// SaveBatch inserts all records in a single transaction using one prepared statement
+func (s *SQLiteStore[T]) SaveBatch(data []T) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	stmt := tx.Stmt(s.insertStmt)
+	defer stmt.Close()
+
+	for _, item := range data {
+		if _, err := stmt.Exec(fieldValues(item, s.insertFields)...); err != nil {
+			tx.Rollback()
+			log.Printf("ERROR: Failed to insert data: %v", err)
+			return fmt.Errorf("failed to insert data: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// prepareInsert builds and prepares the INSERT statement for T, with the
+// field names in column order, for every save to reuse
+func (s *SQLiteStore[T]) prepareInsert() error {
+	query, fields, err := s.insertQuery()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	s.insertSQL = query
+	s.insertFields = fields
+	s.insertStmt = stmt
+	return nil
+}
+
+// insertQuery builds the INSERT statement for T and returns it with the field names in column order
+func (s *SQLiteStore[T]) insertQuery() (string, []string, error) {
+	columns, _, fields, err := getFieldsAndTypes[T]()
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Create placeholders
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		s.table,
+		strings.Join(columns, ", "),
+		strings.Join(placeholders, ", "))
+
+	return query, fields, nil
+}
+
+// bindValue converts a value for a query argument. Times are bound in UTC:
+// the driver writes them as text with their offset, which SQLite compares
+// as text, so times in different zones would sort and match wrongly.
+func bindValue(v interface{}) interface{} {
+	if t, ok := v.(time.Time); ok {
+		return t.UTC()
+	}
+	return v
+}
+
+// fieldValues extracts the values of the given fields using reflection,
+// converted for binding by bindValue
+func fieldValues[T any](data T, fields []string) []interface{} {
+	values := make([]interface{}, len(fields))
+	v := reflect.ValueOf(data)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	for i, field := range fields {
+		values[i] = bindValue(v.FieldByName(field).Interface())
+	}
+
+	return values
+}
+
+// FindBetween returns records between start and end timestamps
+func (s *SQLiteStore[T]) FindBetween(start, end interface{}) ([]any, error) {
+	return s.FindBetweenContext(context.Background(), start, end)
+}
+
+// FindBetweenContext returns records between start and end timestamps, aborting if ctx is cancelled
+func (s *SQLiteStore[T]) FindBetweenContext(ctx context.Context, start, end interface{}) ([]any, error) {
+	records, err := s.findBetween(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]any, len(records))
+	for i, record := range records {
+		results[i] = record
+	}
+
+	return results, nil
+}
+
+// FindBetweenTyped returns records between start and end timestamps as T,
+// oldest first
+func (s *SQLiteStore[T]) FindBetweenTyped(start, end interface{}) ([]T, error) {
+	return s.findBetween(context.Background(), start, end)
+}
+
+func (s *SQLiteStore[T]) findBetween(ctx context.Context, start, end interface{}) ([]T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s BETWEEN ? AND ? ORDER BY %s, id", s.table, s.timestampColumn, s.timestampColumn)
+	rows, err := s.db.QueryContext(ctx, query, bindValue(start), bindValue(end))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRows[T](rows)
+}
+
+// Count returns the number of records between start and end timestamps.
+// If start and end are both nil the whole table is counted.
+func (s *SQLiteStore[T]) Count(start, end interface{}) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", s.table)
+	var args []interface{}
+	if start != nil || end != nil {
+		query += fmt.Sprintf(" WHERE %s BETWEEN ? AND ?", s.timestampColumn)
+		args = append(args, bindValue(start), bindValue(end))
+	}
+
+	var count int64
+	if err := s.db.QueryRow(query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count data: %w", err)
+	}
+
+	return count, nil
+}
+
+// Find returns records between start and end timestamps whose columns equal
+// the values in conds. Column names are checked against the fields of T
+// before they are put into the query. If start and end are both nil the
+// time range is not restricted.
+func (s *SQLiteStore[T]) Find(conds map[string]interface{}, start, end interface{}) ([]T, error) {
+	// Sorted so the same conditions always build the same query
+	columns := condColumns(conds)
+	if err := checkColumns[T](columns...); err != nil {
+		return nil, err
+	}
+
+	var where []string
+	var args []interface{}
+	for _, column := range columns {
+		where = append(where, column+" = ?")
+		args = append(args, bindValue(conds[column]))
+	}
+	if start != nil || end != nil {
+		where = append(where, s.timestampColumn+" BETWEEN ? AND ?")
+		args = append(args, bindValue(start), bindValue(end))
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s", s.table)
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s, id", s.timestampColumn)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRows[T](rows)
+}
+
+// FindLatest returns the n most recent records, newest first. Records with
+// the same timestamp are returned in reverse insertion order.
+func (s *SQLiteStore[T]) FindLatest(n int) ([]T, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("n must not be negative, got %d", n)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := fmt.Sprintf("SELECT * FROM %s ORDER BY %s DESC, id DESC LIMIT ?", s.table, s.timestampColumn)
+	rows, err := s.db.Query(query, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRows[T](rows)
+}
+
+// FindAfter returns up to limit records with a row id greater than afterID
+// in id order, and the id of the last one to pass as afterID for the next
+// page. Unlike an offset this stays fast however deep the page is. At the
+// end of the table no records and afterID are returned.
+func (s *SQLiteStore[T]) FindAfter(afterID int64, limit int) ([]T, int64, error) {
+	if limit < 0 {
+		return nil, afterID, fmt.Errorf("limit must not be negative, got %d", limit)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id > ? ORDER BY id LIMIT ?", s.table)
+	rows, err := s.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, afterID, fmt.Errorf("failed to query data: %w", err)
+	}
+	defer rows.Close()
+
+	var results []T
+	lastID := afterID
+	err = streamRowsWithID(rows, func(id int64, data T) error {
+		results = append(results, data)
+		lastID = id
+		return nil
+	})
+	if err != nil {
+		return nil, afterID, err
+	}
+
+	return results, lastID, nil
+}
+
+// Update replaces the record with the given row id with data
+func (s *SQLiteStore[T]) Update(id int64, data T) error {
+	updated, err := s.update("id = ?", []interface{}{id}, data)
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("%w with id %d", ErrNoRows, id)
+	}
+	return nil
+}
+
+// UpdateBy replaces every record whose columns equal the values in conds
+// with data and returns the number of rows updated. Column names are checked
+// against the fields of T. conds must not be empty.
+func (s *SQLiteStore[T]) UpdateBy(conds map[string]interface{}, data T) (int64, error) {
+	if len(conds) == 0 {
+		return 0, ErrNoConditions
+	}
+
+	// Sorted so the same conditions always build the same query
+	columns := condColumns(conds)
+	if err := checkColumns[T](columns...); err != nil {
+		return 0, err
+	}
+
+	var where []string
+	var args []interface{}
+	for _, column := range columns {
+		where = append(where, column+" = ?")
+		args = append(args, bindValue(conds[column]))
+	}
+
+	return s.update(strings.Join(where, " AND "), args, data)
+}
+
+// update sets every column of the rows matching where to the fields of data
+func (s *SQLiteStore[T]) update(where string, args []interface{}, data T) (int64, error) {
+	columns, _, fields, err := getFieldsAndTypes[T]()
+	if err != nil {
+		log.Printf("ERROR: Failed to get fields and types: %v", err)
+		return 0, err
+	}
+
+	sets := make([]string, len(columns))
+	for i, column := range columns {
+		sets[i] = column + " = ?"
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", s.table, strings.Join(sets, ", "), where)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(query, append(fieldValues(data, fields), args...)...)
+	if err != nil {
+		log.Printf("ERROR: Failed to update data: %v", err)
+		return 0, fmt.Errorf("failed to update data: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Delete removes records between start and end timestamps and returns the number of rows removed
+func (s *SQLiteStore[T]) Delete(start, end interface{}) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s BETWEEN ? AND ?", s.table, s.timestampColumn)
+	result, err := s.db.Exec(query, bindValue(start), bindValue(end))
+	if err != nil {
+		log.Printf("ERROR: Failed to delete data: %v", err)
+		return 0, fmt.Errorf("failed to delete data: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Truncate removes every record and restarts the ids at 1. Other tables in
+// the same database are left alone.
+func (s *SQLiteStore[T]) Truncate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", s.table)); err != nil {
+		tx.Rollback()
+		log.Printf("ERROR: Failed to truncate %s: %v", s.table, err)
+		return fmt.Errorf("failed to truncate %s: %w", s.table, err)
+	}
+
+	// sqlite_sequence holds the last id of every AUTOINCREMENT table
+	if _, err := tx.Exec("DELETE FROM sqlite_sequence WHERE name = ?", s.table); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to reset ids of %s: %w", s.table, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// StreamAll passes every record to fn one row at a time, so the table never
+// has to fit in memory. It stops at the first error fn returns. The store is
+// locked while streaming, so fn must not use it.
+func (s *SQLiteStore[T]) StreamAll(fn func(T) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := fmt.Sprintf("SELECT * FROM %s", s.table)
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query data: %w", err)
+	}
+	defer rows.Close()
+
+	return streamRows(rows, fn)
+}
+
+// StreamBetween passes every record between start and end timestamps to fn
+// one row at a time, oldest first. Like StreamAll, fn must not use the store.
+func (s *SQLiteStore[T]) StreamBetween(start, end interface{}, fn func(T) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s BETWEEN ? AND ? ORDER BY %s, id", s.table, s.timestampColumn, s.timestampColumn)
+	rows, err := s.db.Query(query, bindValue(start), bindValue(end))
+	if err != nil {
+		return fmt.Errorf("failed to query data: %w", err)
+	}
+	defer rows.Close()
+
+	return streamRows(rows, fn)
+}
+
+// Get returns all records, oldest first
+func (s *SQLiteStore[T]) Get() ([]T, error) {
+	return s.GetContext(context.Background())
+}
+
+// GetContext returns all records oldest first, aborting if ctx is cancelled
+func (s *SQLiteStore[T]) GetContext(ctx context.Context) ([]T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := fmt.Sprintf("SELECT * FROM %s ORDER BY %s, id", s.table, s.timestampColumn)
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRows[T](rows)
+}
+
+// scanRows reads every row into a T, mapping each column back to the
+// struct field it was created from
+func scanRows[T any](rows *sql.Rows) ([]T, error) {
+	var results []T
+	err := streamRows(rows, func(data T) error {
+		results = append(results, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// streamRows scans rows one at a time and passes each record to fn
+func streamRows[T any](rows *sql.Rows, fn func(T) error) error {
+	return streamRowsWithID(rows, func(_ int64, data T) error {
+		return fn(data)
+	})
+}
+
+// streamRowsWithID is streamRows passing each record's row id along, zero
+// if the query didn't select the id column
+func streamRowsWithID[T any](rows *sql.Rows, fn func(int64, T) error) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	fieldColumns, _, fields, err := getFieldsAndTypes[T]()
+	if err != nil {
+		return err
+	}
+
+	fieldByColumn := make(map[string]string, len(fields))
+	for i, column := range fieldColumns {
+		fieldByColumn[column] = fields[i]
+	}
+
+	for rows.Next() {
+		var data T
+		v := reflect.ValueOf(&data).Elem()
+
+		// Create a slice of interface{} to hold the values
+		values := make([]interface{}, len(columns))
+		for i := range values {
+			values[i] = new(interface{})
+		}
+
+		if err := rows.Scan(values...); err != nil {
+			return err
+		}
+
+		var id int64
+		for i, column := range columns {
+			if column == "id" {
+				id, _ = (*(values[i].(*interface{}))).(int64)
+				continue
+			}
+
+			// Skips any column without a matching field
+			name, ok := fieldByColumn[column]
+			if !ok {
+				continue
+			}
+
+			field := v.FieldByName(name)
+			if err := assignValue(field, *(values[i].(*interface{}))); err != nil {
+				return fmt.Errorf("failed to read column %s: %w", column, err)
+			}
+		}
+
+		if err := fn(id, data); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// assignValue sets field to a value scanned from SQLite. The driver returns
+// TEXT as []byte or string and DATETIME as time.Time or string depending on
+// how the column was declared and written, so those are converted explicitly.
+// NULL, e.g. in a column added without a default, leaves the zero value.
+// Times are stored in UTC and read back in the local zone, like time.Now.
+func assignValue(field reflect.Value, raw interface{}) error {
+	if raw == nil {
+		field.SetZero()
+		return nil
+	}
+
+	if field.Type() == timeType {
+		t, err := parseTime(raw)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t.Local()))
+		return nil
+	}
+
+	if b, ok := raw.([]byte); ok && field.Kind() == reflect.String {
+		field.SetString(string(b))
+		return nil
+	}
+
+	// SQLite has no boolean type, bools are written as 0/1 and only come
+	// back as bool for columns declared BOOLEAN
+	if field.Kind() == reflect.Bool {
+		switch v := raw.(type) {
+		case bool:
+			field.SetBool(v)
+			return nil
+		case int64:
+			field.SetBool(v != 0)
+			return nil
+		}
+	}
+	if b, ok := raw.(bool); ok && field.CanInt() {
+		var i int64
+		if b {
+			i = 1
+		}
+		field.SetInt(i)
+		return nil
+	}
+
+	val := reflect.ValueOf(raw)
+	// Go allows converting integers to strings as runes, which is never what we want
+	if (val.Kind() == reflect.String) != (field.Kind() == reflect.String) || !val.Type().ConvertibleTo(field.Type()) {
+		return fmt.Errorf("%w: %T to %s", ErrCastFailed, raw, field.Type())
+	}
+
+	field.Set(val.Convert(field.Type()))
+	return nil
+}
+
+// timestampFormats are the formats go-sqlite3 writes DATETIME values in,
+// its SQLiteTimestampFormats, which only exists in cgo builds
+var timestampFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseTime reads a time.Time from a DATETIME value, which may come back as
+// text in any of the formats go-sqlite3 writes
+func parseTime(raw interface{}) (time.Time, error) {
+	var s string
+	switch v := raw.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return time.Time{}, fmt.Errorf("%w: %T to time.Time", ErrCastFailed, raw)
+	}
+
+	s = strings.TrimSuffix(s, "Z")
+	for _, format := range timestampFormats {
+		if t, err := time.ParseInLocation(format, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: cannot parse %q as time", ErrCastFailed, s)
+}
+
+// Flush checkpoints the write-ahead log, so every committed record is in
+// the main database file. The checkpoint covers the whole database, not
+// just this store's table.
+func (s *SQLiteStore[T]) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		log.Printf("ERROR: Failed to checkpoint database: %v", err)
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// Vacuum rebuilds the database file to reclaim the space left by deleted
+// rows. SQLite never shrinks the file on its own.
+func (s *SQLiteStore[T]) Vacuum() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return vacuum(s.db)
+}
+
+// Backup writes a consistent copy of the whole database to destPath, which
+// is overwritten if it exists. It uses SQLite's online backup API, so it is
+// safe while another process writes to the database. In WAL mode the backup
+// only reads, so writers are not blocked while it runs.
+func (s *SQLiteStore[T]) Backup(destPath string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return backup(s.db, destPath)
+}
+
+// Vacuum is SQLiteStore.Vacuum for the whole database at dbPath, without a
+// store, so no table is created in it
+func Vacuum(dbPath string) error {
+	db, err := openExisting(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return vacuum(db)
+}
+
+// Backup is SQLiteStore.Backup for the whole database at dbPath, without a
+// store, so no table is created in it
+func Backup(dbPath, destPath string) error {
+	db, err := openExisting(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return backup(db, destPath)
+}
+
+// openExisting opens the database at dbPath like NewSQLiteStore does, but
+// fails instead of creating an empty database if there is none
+func openExisting(dbPath string) (*sql.DB, error) {
+	file, _, _ := strings.Cut(dbPath, "?")
+	if _, err := os.Stat(file); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", dsn(dbPath, options{busyTimeout: defaultBusyTimeout}))
+	if err != nil {
+		log.Printf("ERROR: Failed to open database: %v", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func vacuum(db *sql.DB) error {
+	if _, err := db.Exec("VACUUM"); err != nil {
+		log.Printf("ERROR: Failed to vacuum database: %v", err)
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+
+	// In WAL mode the rebuilt pages only reach the main file on checkpoint
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		log.Printf("ERROR: Failed to checkpoint database: %v", err)
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+
+	return nil
+}
+
+func backup(db *sql.DB, destPath string) error {
+	if err := backupTo(db, destPath); err != nil {
+		log.Printf("ERROR: Failed to back up database: %v", err)
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+func backupTo(db *sql.DB, destPath string) error {
+	ctx := context.Background()
+
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	destDB, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			return backupConn(destRaw, srcRaw)
+		})
+	})
 }
 
 func (s *SQLiteStore[T]) Close() error {
+	s.insertStmt.Close()
 	return s.db.Close()
 }
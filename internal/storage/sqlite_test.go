@@ -0,0 +1,539 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nilszeilon/devstats/internal/domain"
+)
+
+type timedRecord struct {
+	Timestamp time.Time
+	Value     int
+}
+
+func (timedRecord) TableName() string { return "timed_records" }
+
+func newTestStore[T any](t *testing.T) *SQLiteStore[T] {
+	t.Helper()
+	store, err := NewSQLiteStore[T](filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+// A day in Stockholm built in its own zone must find the records saved in
+// any other zone, on the 25 hour day the clocks go back
+func TestFindBetweenAcrossZonesOnDSTChange(t *testing.T) {
+	stockholm := mustLoadLocation(t, "Europe/Stockholm")
+	newYork := mustLoadLocation(t, "America/New_York")
+	store := newTestStore[timedRecord](t)
+
+	dayStart := time.Date(2024, 10, 27, 0, 0, 0, 0, stockholm)
+	dayEnd := dayStart.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	if hours := dayEnd.Sub(dayStart).Round(time.Hour); hours != 25*time.Hour {
+		t.Fatalf("expected a 25 hour day, got %s", hours)
+	}
+
+	records := []timedRecord{
+		// 23:59 on the day before in Stockholm
+		{Timestamp: time.Date(2024, 10, 26, 21, 59, 0, 0, time.UTC), Value: 0},
+		// 00:30 in Stockholm, the day before in UTC
+		{Timestamp: time.Date(2024, 10, 26, 22, 30, 0, 0, time.UTC), Value: 1},
+		// 02:30 in Stockholm before and after the clocks go back
+		{Timestamp: time.Date(2024, 10, 27, 2, 30, 0, 0, stockholm).Add(-time.Hour), Value: 2},
+		{Timestamp: time.Date(2024, 10, 26, 20, 30, 0, 0, newYork), Value: 3},
+		// 23:30 in Stockholm, after midnight in UTC minus an hour
+		{Timestamp: time.Date(2024, 10, 27, 23, 30, 0, 0, stockholm), Value: 4},
+		// 00:30 the next day in Stockholm, still the 27th in New York
+		{Timestamp: time.Date(2024, 10, 27, 19, 30, 0, 0, newYork), Value: 5},
+	}
+	for _, record := range records {
+		if err := store.Save(record); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	found, err := store.FindBetweenTyped(dayStart, dayEnd)
+	if err != nil {
+		t.Fatalf("FindBetweenTyped: %v", err)
+	}
+	var values []int
+	for _, record := range found {
+		values = append(values, record.Value)
+	}
+	if want := []int{1, 2, 3, 4}; !equalInts(values, want) {
+		t.Errorf("found values %v, want %v", values, want)
+	}
+
+	deleted, err := store.Delete(dayStart, dayEnd)
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if deleted != 4 {
+		t.Errorf("deleted %d records, want 4", deleted)
+	}
+	if count, _ := store.Count(nil, nil); count != 2 {
+		t.Errorf("%d records left, want 2", count)
+	}
+}
+
+// Tables written before times were stored in UTC hold them with the local
+// offset, and are converted when opened
+func TestConvertTimesToUTC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	store, err := NewSQLiteStore[timedRecord](path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	for i, ts := range []string{"2024-10-27 02:30:00+02:00", "2024-10-27 01:50:00+00:00", "2024-10-27 02:10:00+01:00"} {
+		if _, err := store.db.Exec("INSERT INTO timed_records (timestamp, value) VALUES (?, ?)", ts, i); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	if _, err := store.db.Exec("DELETE FROM utc_tables"); err != nil {
+		t.Fatalf("delete from utc_tables: %v", err)
+	}
+	store.Close()
+
+	store, err = NewSQLiteStore[timedRecord](path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	rows, err := store.db.Query("SELECT CAST(timestamp AS TEXT) FROM timed_records ORDER BY id")
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ts string
+		if err := rows.Scan(&ts); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		if !strings.HasSuffix(ts, "+00:00") {
+			t.Errorf("timestamp %s wasn't converted to UTC", ts)
+		}
+	}
+
+	// In text order the times are now in time order
+	records, err := store.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	var values []int
+	for _, record := range records {
+		values = append(values, record.Value)
+	}
+	if want := []int{0, 2, 1}; !equalInts(values, want) {
+		t.Errorf("got values %v in time order, want %v", values, want)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func BenchmarkSQLiteStoreSave(b *testing.B) {
+	store, err := NewSQLiteStore[timedRecord](filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	record := timedRecord{Timestamp: time.Now(), Value: 1}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := store.Save(record); err != nil {
+			b.Fatalf("Save: %v", err)
+		}
+	}
+}
+
+// BenchmarkSQLiteStoreSaveUnprepared saves like Save did before the INSERT
+// was prepared once per store, building and parsing it on every call, to
+// compare against BenchmarkSQLiteStoreSave
+func BenchmarkSQLiteStoreSaveUnprepared(b *testing.B) {
+	store, err := NewSQLiteStore[timedRecord](filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	record := timedRecord{Timestamp: time.Now(), Value: 1}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		query, fields, err := store.insertQuery()
+		if err != nil {
+			b.Fatalf("insertQuery: %v", err)
+		}
+		if _, err := store.db.Exec(query, fieldValues(record, fields)...); err != nil {
+			b.Fatalf("insert: %v", err)
+		}
+	}
+}
+
+func TestFileChangeDataRoundTrip(t *testing.T) {
+	store := newTestStore[domain.FileChangeData](t)
+
+	want := domain.FileChangeData{
+		Project:      "devstats",
+		Language:     "go",
+		ChangeType:   domain.ChangeWrite,
+		LinesChanged: 12,
+		Host:         "laptop",
+		Timestamp:    time.Date(2024, 6, 1, 12, 30, 15, 123456789, time.UTC),
+	}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// Written by other tools, DATETIME can be any text the driver accepts
+	if _, err := store.db.Exec("INSERT INTO file_changes (project, language, changetype, lineschanged, host, timestamp) VALUES ('other', 'rust', 'create', 3, 'desktop', '2024-06-01T13:00:00Z')"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	got, err := store.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d records, want 2", len(got))
+	}
+
+	if !got[0].Timestamp.Equal(want.Timestamp) {
+		t.Errorf("timestamp %s, want %s", got[0].Timestamp, want.Timestamp)
+	}
+	got[0].Timestamp = want.Timestamp
+	if got[0] != want {
+		t.Errorf("got %+v, want %+v", got[0], want)
+	}
+
+	if want := time.Date(2024, 6, 1, 13, 0, 0, 0, time.UTC); !got[1].Timestamp.Equal(want) {
+		t.Errorf("text timestamp read as %s, want %s", got[1].Timestamp, want)
+	}
+	if got[1].Language != "rust" || got[1].LinesChanged != 3 {
+		t.Errorf("got %+v for the row inserted as text", got[1])
+	}
+}
+
+// A value that can't be converted to its field fails the read instead of
+// panicking
+func TestReadIncompatibleValue(t *testing.T) {
+	store := newTestStore[domain.FileChangeData](t)
+
+	if _, err := store.db.Exec("INSERT INTO file_changes (language, lineschanged, timestamp) VALUES ('go', 'many', '2024-06-01 12:00:00+00:00')"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	if _, err := store.Get(); !errors.Is(err, ErrCastFailed) {
+		t.Errorf("Get returned %v, want ErrCastFailed", err)
+	}
+}
+
+// flagRecord has a bool in a BOOLEAN column, which the driver reads back as
+// bool, and one in an INTEGER column, read back as int64
+type flagRecord struct {
+	Timestamp time.Time
+	Enabled   bool
+	Archived  bool `sql:"INTEGER NOT NULL DEFAULT 0"`
+}
+
+func (flagRecord) TableName() string { return "flag_records" }
+
+func TestBoolRoundTrip(t *testing.T) {
+	store := newTestStore[flagRecord](t)
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	want := []flagRecord{
+		{Timestamp: now, Enabled: true, Archived: false},
+		{Timestamp: now.Add(time.Second), Enabled: false, Archived: true},
+		{Timestamp: now.Add(2 * time.Second), Enabled: true, Archived: true},
+	}
+	if err := store.SaveBatch(want); err != nil {
+		t.Fatalf("SaveBatch: %v", err)
+	}
+
+	// Bools are stored as 0 and 1
+	var enabled, archived int64
+	if err := store.db.QueryRow("SELECT CAST(enabled AS INTEGER), archived FROM flag_records WHERE id = 2").Scan(&enabled, &archived); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if enabled != 0 || archived != 1 {
+		t.Errorf("stored enabled=%d archived=%d, want 0 and 1", enabled, archived)
+	}
+
+	got, err := store.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Enabled != want[i].Enabled || got[i].Archived != want[i].Archived {
+			t.Errorf("record %d: got enabled=%t archived=%t, want %t and %t", i, got[i].Enabled, got[i].Archived, want[i].Enabled, want[i].Archived)
+		}
+	}
+
+	// Bools can be matched like any other column
+	found, err := store.Find(map[string]interface{}{"archived": true}, nil, nil)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if len(found) != 2 {
+		t.Errorf("found %d archived records, want 2", len(found))
+	}
+}
+
+// sparseRecord has columns that allow NULL, like columns added to an
+// existing table without a default
+type sparseRecord struct {
+	Timestamp time.Time
+	Name      string    `sql:"TEXT"`
+	Count     int       `sql:"INTEGER"`
+	Ratio     float64   `sql:"REAL"`
+	Done      bool      `sql:"BOOLEAN"`
+	Seen      time.Time `sql:"DATETIME"`
+}
+
+func (sparseRecord) TableName() string { return "sparse_records" }
+
+func TestReadNullAsZeroValue(t *testing.T) {
+	store := newTestStore[sparseRecord](t)
+
+	timestamp := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := store.db.Exec("INSERT INTO sparse_records (timestamp, name, count, ratio, done, seen) VALUES (?, NULL, NULL, NULL, NULL, NULL)", timestamp); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	got, err := store.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d records, want 1", len(got))
+	}
+
+	if !got[0].Timestamp.Equal(timestamp) {
+		t.Errorf("timestamp %s, want %s", got[0].Timestamp, timestamp)
+	}
+	got[0].Timestamp = time.Time{}
+	if got[0] != (sparseRecord{}) {
+		t.Errorf("NULL columns read as %+v, want zero values", got[0])
+	}
+}
+
+func TestRecordsOrderedByTimestampThenID(t *testing.T) {
+	store := newTestStore[timedRecord](t)
+
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// Value is the expected position, records with the same timestamp
+	// keep the order they were saved in
+	saved := []timedRecord{
+		{Timestamp: base.Add(3 * time.Minute), Value: 4},
+		{Timestamp: base.Add(time.Minute), Value: 1},
+		{Timestamp: base.Add(2 * time.Minute), Value: 2},
+		{Timestamp: base, Value: 0},
+		{Timestamp: base.Add(2 * time.Minute), Value: 3},
+	}
+	for _, record := range saved {
+		if err := store.Save(record); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	want := []int{0, 1, 2, 3, 4}
+
+	values := func(records []timedRecord) []int {
+		var values []int
+		for _, record := range records {
+			values = append(values, record.Value)
+		}
+		return values
+	}
+
+	all, err := store.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got := values(all); !equalInts(got, want) {
+		t.Errorf("Get returned %v, want %v", got, want)
+	}
+
+	between, err := store.FindBetweenTyped(base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("FindBetweenTyped: %v", err)
+	}
+	if got := values(between); !equalInts(got, want) {
+		t.Errorf("FindBetweenTyped returned %v, want %v", got, want)
+	}
+
+	found, err := store.Find(nil, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if got := values(found); !equalInts(got, want) {
+		t.Errorf("Find returned %v, want %v", got, want)
+	}
+
+	var streamed []timedRecord
+	if err := store.StreamBetween(base, base.Add(time.Hour), func(record timedRecord) error {
+		streamed = append(streamed, record)
+		return nil
+	}); err != nil {
+		t.Fatalf("StreamBetween: %v", err)
+	}
+	if got := values(streamed); !equalInts(got, want) {
+		t.Errorf("StreamBetween returned %v, want %v", got, want)
+	}
+}
+
+// meta is shared by embedding, its fields become columns of the embedding type
+type meta struct {
+	Timestamp time.Time
+	Host      string
+}
+
+type embeddedRecord struct {
+	meta
+	Key   string
+	Count int
+}
+
+func (embeddedRecord) TableName() string { return "embedded_records" }
+
+type collidingRecord struct {
+	meta
+	Host string
+}
+
+func TestEmbeddedStructRoundTrip(t *testing.T) {
+	store := newTestStore[embeddedRecord](t)
+
+	columns, _, _, err := getFieldsAndTypes[embeddedRecord]()
+	if err != nil {
+		t.Fatalf("getFieldsAndTypes: %v", err)
+	}
+	if want := []string{"timestamp", "host", "key", "count"}; strings.Join(columns, ",") != strings.Join(want, ",") {
+		t.Errorf("columns %v, want %v", columns, want)
+	}
+
+	want := embeddedRecord{
+		meta:  meta{Timestamp: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), Host: "laptop"},
+		Key:   "a",
+		Count: 3,
+	}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := store.Find(map[string]interface{}{"host": "laptop"}, nil, nil)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d records, want 1", len(got))
+	}
+	if !got[0].Timestamp.Equal(want.Timestamp) {
+		t.Errorf("timestamp %s, want %s", got[0].Timestamp, want.Timestamp)
+	}
+	got[0].Timestamp = want.Timestamp
+	if got[0] != want {
+		t.Errorf("got %+v, want %+v", got[0], want)
+	}
+}
+
+func TestEmbeddedStructColumnCollision(t *testing.T) {
+	_, err := NewSQLiteStore[collidingRecord](filepath.Join(t.TempDir(), "test.db"))
+	if !errors.Is(err, ErrDuplicateColumn) {
+		t.Errorf("NewSQLiteStore returned %v, want ErrDuplicateColumn", err)
+	}
+}
+
+func TestVacuumAndBackupWithoutStore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	store, err := NewSQLiteStore[timedRecord](dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	if err := store.Save(timedRecord{Timestamp: time.Now(), Value: 1}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	store.Close()
+
+	tables := func(path string) []string {
+		t.Helper()
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatalf("sql.Open: %v", err)
+		}
+		defer db.Close()
+
+		rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name")
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		defer rows.Close()
+
+		var names []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			names = append(names, name)
+		}
+		return names
+	}
+	want := tables(dbPath)
+
+	if err := Vacuum(dbPath); err != nil {
+		t.Fatalf("Vacuum: %v", err)
+	}
+	if got := tables(dbPath); !slices.Equal(got, want) {
+		t.Errorf("tables after Vacuum = %v, want %v", got, want)
+	}
+
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := Backup(dbPath, backupPath); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if got := tables(backupPath); !slices.Equal(got, want) {
+		t.Errorf("tables in the backup = %v, want %v", got, want)
+	}
+
+	missing := filepath.Join(dir, "missing.db")
+	if err := Vacuum(missing); err == nil {
+		t.Error("Vacuum of a missing database succeeded")
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Vacuum created %s", missing)
+	}
+}
@@ -0,0 +1,239 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/nilszeilon/devstats/internal/anon"
+	"github.com/nilszeilon/devstats/internal/domain"
+	"github.com/nilszeilon/devstats/internal/storage"
+)
+
+const (
+	// refreshInterval is how often the dashboard reloads the stores
+	refreshInterval = 5 * time.Second
+	// sparklineBars is the number of sparkline bars, one per anonymized
+	// keypress interval
+	sparklineBars = 6
+	// maxBarWidth is the width of the longest language bar
+	maxBarWidth = 40
+)
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+var (
+	titleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	labelStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	valueStyle = lipgloss.NewStyle().Bold(true)
+	barStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	sparkStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("14"))
+	errorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	boxStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+)
+
+// Stores are the anonymized stores the dashboard reads from
+type Stores struct {
+	Keypresses  storage.Store[domain.KeypressAnonymousStats]
+	FileChanges storage.Store[domain.FileChangeAnonymousStats]
+}
+
+// languageCount is the number of changes for one language
+type languageCount struct {
+	language string
+	changes  int64
+}
+
+// snapshot is the data shown on one refresh
+type snapshot struct {
+	updated    time.Time
+	keypresses int64
+	languages  []languageCount
+	activity   []int64
+}
+
+type snapshotMsg struct {
+	snapshot snapshot
+	err      error
+}
+
+type tickMsg time.Time
+
+// Model is the bubbletea model of the dashboard
+type Model struct {
+	stores   Stores
+	interval time.Duration
+	loc      *time.Location
+	snapshot snapshot
+	err      error
+	loaded   bool
+}
+
+// New creates a dashboard over stores whose keypress stats are anonymized
+// every interval. Today starts at midnight in loc.
+func New(stores Stores, interval time.Duration, loc *time.Location) Model {
+	return Model{stores: stores, interval: interval, loc: loc}
+}
+
+// Run shows the dashboard until the user quits
+func Run(stores Stores, interval time.Duration, loc *time.Location) error {
+	_, err := tea.NewProgram(New(stores, interval, loc), tea.WithAltScreen()).Run()
+	return err
+}
+
+func (m Model) Init() tea.Cmd {
+	return m.load
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c", "esc":
+			return m, tea.Quit
+		}
+	case snapshotMsg:
+		m.loaded = true
+		m.err = msg.err
+		if msg.err == nil {
+			m.snapshot = msg.snapshot
+		}
+		return m, tea.Tick(refreshInterval, func(t time.Time) tea.Msg {
+			return tickMsg(t)
+		})
+	case tickMsg:
+		return m, m.load
+	}
+
+	return m, nil
+}
+
+func (m Model) View() string {
+	if !m.loaded {
+		return "Loading stats...\n"
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("devstats") + "  " + labelStyle.Render("press q to quit") + "\n\n")
+
+	if m.err != nil {
+		b.WriteString(errorStyle.Render("Error loading stats: "+m.err.Error()) + "\n\n")
+	}
+
+	s := m.snapshot
+	b.WriteString(boxStyle.Render(labelStyle.Render("Keypresses today ") + valueStyle.Render(fmt.Sprint(s.keypresses))))
+	b.WriteString("\n")
+
+	b.WriteString(boxStyle.Render(labelStyle.Render("Last "+formatSpan(sparklineBars*m.interval)+" ") + sparkStyle.Render(sparkline(s.activity))))
+	b.WriteString("\n")
+
+	b.WriteString(boxStyle.Render(languageBars(s.languages)))
+	b.WriteString("\n")
+
+	if !s.updated.IsZero() {
+		b.WriteString(labelStyle.Render("Updated " + s.updated.Format("15:04:05")))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// load reads today's stats and the last sparklineBars intervals of activity
+func (m Model) load() tea.Msg {
+	now := time.Now().In(m.loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	s := snapshot{updated: now}
+
+	keypresses, err := m.stores.Keypresses.FindBetweenTyped(today, now)
+	if err != nil {
+		return snapshotMsg{err: err}
+	}
+	for _, stats := range keypresses {
+		s.keypresses += stats.KeypressesCount
+	}
+
+	// One bar per interval, oldest first, the last one still filling up
+	first := anon.IntervalStart(now, m.interval, m.loc).Add(-(sparklineBars - 1) * m.interval)
+	recent, err := m.stores.Keypresses.FindBetweenTyped(first, now)
+	if err != nil {
+		return snapshotMsg{err: err}
+	}
+	s.activity = make([]int64, sparklineBars)
+	for _, stats := range recent {
+		i := int(anon.IntervalStart(stats.Timestamp, m.interval, m.loc).Sub(first) / m.interval)
+		if i >= 0 && i < len(s.activity) {
+			s.activity[i] += stats.KeypressesCount
+		}
+	}
+
+	fileChanges, err := m.stores.FileChanges.FindBetweenTyped(today, now)
+	if err != nil {
+		return snapshotMsg{err: err}
+	}
+	perLanguage := make(map[string]int64)
+	for _, stats := range fileChanges {
+		perLanguage[stats.Language] += stats.ChangesInSpan
+	}
+	for language, changes := range perLanguage {
+		s.languages = append(s.languages, languageCount{language, changes})
+	}
+	sort.Slice(s.languages, func(i, j int) bool {
+		if s.languages[i].changes != s.languages[j].changes {
+			return s.languages[i].changes > s.languages[j].changes
+		}
+		return s.languages[i].language < s.languages[j].language
+	})
+
+	return snapshotMsg{snapshot: s}
+}
+
+// sparkline renders values as a row of block characters scaled to the largest
+func sparkline(values []int64) string {
+	var peak int64
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	if peak == 0 {
+		return labelStyle.Render("no activity")
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		b.WriteRune(sparkChars[int(v*int64(len(sparkChars)-1)/peak)])
+	}
+	return b.String()
+}
+
+// formatSpan formats whole hours and minutes the short way, e.g. 1h or 30min
+func formatSpan(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dmin", d/time.Minute)
+	}
+	return d.String()
+}
+
+// languageBars renders a horizontal bar per language scaled to the largest
+func languageBars(languages []languageCount) string {
+	if len(languages) == 0 {
+		return labelStyle.Render("No file changes today")
+	}
+
+	width := 0
+	for _, l := range languages {
+		width = max(width, len(l.language))
+	}
+	peak := languages[0].changes
+
+	lines := []string{labelStyle.Render("Changes per language")}
+	for _, l := range languages {
+		bar := strings.Repeat("█", max(1, int(l.changes*maxBarWidth/peak)))
+		lines = append(lines, fmt.Sprintf("%-*s %s %d", width, l.language, barStyle.Render(bar), l.changes))
+	}
+	return strings.Join(lines, "\n")
+}
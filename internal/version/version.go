@@ -0,0 +1,61 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time with -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/nilszeilon/devstats/internal/version.Version=v1.2.0 -X github.com/nilszeilon/devstats/internal/version.Commit=$(git rev-parse HEAD) -X github.com/nilszeilon/devstats/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/cli
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the running build's info. Without -ldflags, the commit and
+// date fall back to the VCS stamp go build adds when building in a checkout,
+// and to "unknown" if there is none.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.Date == "":
+				info.Date = setting.Value
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+// String formats the info on one line, e.g.
+// "devstats v1.2.0 (commit 3f2a9c1, built 2024-05-01T12:00:00Z, go1.23.2)"
+func (i Info) String() string {
+	return fmt.Sprintf("devstats %s (commit %s, built %s, %s)", i.Version, i.Commit, i.Date, i.GoVersion)
+}